@@ -1,566 +1,521 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"text/tabwriter"
 	"time"
 
+	"github.com/portworx/torpedo/config"
+	"github.com/portworx/torpedo/drivers/node"
+	// Registers the IPMI power driver.
+	_ "github.com/portworx/torpedo/drivers/node/ipmi"
+	// Registers the libvirt power driver.
+	_ "github.com/portworx/torpedo/drivers/node/libvirt"
+	// Registers the SSH power driver.
+	_ "github.com/portworx/torpedo/drivers/node/ssh"
 	"github.com/portworx/torpedo/drivers/scheduler"
+	// Also registers the in-memory fake scheduler driver.
+	fakescheduler "github.com/portworx/torpedo/drivers/scheduler/fake"
+	// Registers the Kubernetes scheduler driver.
+	_ "github.com/portworx/torpedo/drivers/scheduler/kubernetes"
+	// Registers the Marathon based Mesosphere scheduler driver.
+	_ "github.com/portworx/torpedo/drivers/scheduler/mesosphere"
+	// Registers the Nomad scheduler driver.
+	_ "github.com/portworx/torpedo/drivers/scheduler/nomad"
+	// Registers the swarm scheduler driver.
+	_ "github.com/portworx/torpedo/drivers/scheduler/swarm"
 	"github.com/portworx/torpedo/drivers/volume"
-
-	"github.com/giantswarm/yochu/systemd"
+	// Also registers the CSI volume driver, used by the csi-sanity command.
+	"github.com/portworx/torpedo/drivers/volume/csi"
+	"github.com/portworx/torpedo/drivers/volume/csi/sanity"
+	// Also registers the generic Docker volume plugin driver, used by the
+	// dvdi-conformance command.
+	"github.com/portworx/torpedo/drivers/volume/dvdi"
+	"github.com/portworx/torpedo/drivers/volume/dvdi/conformance"
+	"github.com/portworx/torpedo/drivers/volume/dvdi/reference"
+	// Registers the in-memory fake volume driver.
+	_ "github.com/portworx/torpedo/drivers/volume/fake"
+	// Registers the generic openstorage volume driver.
+	_ "github.com/portworx/torpedo/drivers/volume/osd"
+	// Registers the Portworx volume driver.
+	_ "github.com/portworx/torpedo/drivers/volume/portworx"
+	"github.com/portworx/torpedo/report"
+	"github.com/portworx/torpedo/tests"
+	"github.com/portworx/torpedo/tests/scenarios"
 )
 
-// testDriverFunc runs a specific external storage test case.  It takes
-// in a scheduler driver and an external volume provider as arguments.
-type testDriverFunc func(scheduler.Driver, volume.Driver) error
-
 const (
-	dockerServiceName = "docker.service"
-
-	// Name of the external volume for the Torpedo tests.
-	volName = "torpedo_vol"
-
-	// Use the inline volume specification so that we can test
-	// volume options being dynamically parsed and used inline.
-	dynName = "size=10G,repl=2,name=" + volName
+	// Exit code when at least one test failed.
+	exitFailed = 1
+	// Exit code when no test failed, but some tests were skipped or are
+	// not implemented.
+	exitIncomplete = 2
 )
 
 var (
-	// Docker image to use as the test workload.
-	testImage = "torpedo/fio"
-
-	// Test image command line arguments.  This is passed into the testImage.
-	testArgs = []string{
-		"fio",
-		"--blocksize=64k",
-		"--directory=/mnt/",
-		"--ioengine=libaio",
-		"--readwrite=write",
-		"--size=1G",
-		"--name=test",
-		"--verify=meta",
-		"--do_verify=1",
-		"--verify_pattern=0xDeadBeef",
-		"--direct=1",
-		"--gtod_reduce=1",
-		"--iodepth=1",
-		"--randrepeat=1",
-	}
+	// env is the environment the scenarios run in.  It is set up once the
+	// drivers are initialized.
+	env = &scenarios.Environment{}
 )
 
-// Create dynamic volumes.  Make sure that a task can use the dynamic volume
-// in the inline format as size=x,repl=x,compress=x,name=foo.
-// This test will fail if the storage driver is not able to parse the size correctly.
-func testDynamicVolume(
-	s scheduler.Driver,
-	v volume.Driver,
-) error {
-	taskName := "testDynamicVolume"
-
-	// Pick the first node to start the task
-	nodes, err := s.GetNodes()
-	if err != nil {
-		return err
-	}
-
-	host := nodes[0]
-
-	// Remove any container and volume for this test - previous run may have failed.
-	s.DestroyByName(host, taskName)
-	v.CleanupVolume(volName)
-
-	t := scheduler.Task{
-		Name: taskName,
-		IP:   host,
-		Img:  testImage,
-		Tag:  "latest",
-		Cmd:  testArgs,
-		Vol: scheduler.Volume{
-			Driver: v.String(),
-			Name:   dynName,
-			Path:   "/mnt/",
-			Size:   10240,
-		},
-	}
-
-	ctx, err := s.Create(t)
-	if err != nil {
-		return err
-	}
-
-	defer func() {
-		if ctx != nil {
-			s.Destroy(ctx)
+// registerTests adds all the Torpedo test cases to the test registry.
+// Tests are executed in the order in which they are registered.
+func registerTests() error {
+	for _, spec := range scenarios.Specs(env) {
+		if err := tests.Register(spec); err != nil {
+			return err
 		}
-		v.CleanupVolume(volName)
-	}()
-
-	// Run the task and wait for completion.  This task will exit and
-	// must not be re-started by the scheduler.
-	if err = s.Run(ctx); err != nil {
-		return err
-	}
-
-	if ctx.Status != 0 {
-		return fmt.Errorf("exit status %v\nStdout: %v\nStderr: %v",
-			ctx.Status,
-			ctx.Stdout,
-			ctx.Stderr,
-		)
-	}
-
-	// Verify that the volume properties are honored.
-	vol, err := s.InspectVolume(host, dynName)
-	if err != nil {
-		return err
 	}
+	return nil
+}
 
-	if vol.Driver != v.String() {
-		return fmt.Errorf(
-			"dynamic volume creation failed, incorrect volume driver (driver = %v)",
-			vol.Driver,
+// list prints all the registered tests.
+func list() error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "NAME\tCATEGORY\tNODES\tDESCRIPTION\n")
+	for _, spec := range tests.List() {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n",
+			spec.Name,
+			spec.Category,
+			spec.MinNodes,
+			spec.Description,
 		)
 	}
-	return nil
+	return w.Flush()
 }
 
-// Volume Driver Plugin is down, unavailable - and the client container should
-// not be impacted.
-func testDriverDown(
+func run(
 	s scheduler.Driver,
 	v volume.Driver,
-) error {
-	taskName := "testDriverDown"
-
-	// Pick the first node to start the task
-	nodes, err := s.GetNodes()
-	if err != nil {
-		return err
+	cfg *config.Config,
+	testName string,
+) ([]tests.Result, error) {
+	if err := s.Init(cfg); err != nil {
+		log.Fatalf("Error initializing schedule driver")
+		return nil, err
 	}
 
-	host := nodes[0]
-
-	// Remove any container and volume for this test - previous run may have failed.
-	s.DestroyByName(host, taskName)
-	v.CleanupVolume(volName)
-
-	t := scheduler.Task{
-		Name: taskName,
-		IP:   host,
-		Img:  testImage,
-		Tag:  "latest",
-		Cmd:  testArgs,
-		Vol: scheduler.Volume{
-			Driver: v.String(),
-			Name:   dynName,
-			Path:   "/mnt/",
-			Size:   10240,
-		},
+	if err := v.Init(cfg); err != nil {
+		log.Fatalf("Error initializing volume driver")
+		return nil, err
 	}
 
-	ctx, err := s.Create(t)
-
-	if err != nil {
-		return err
+	// The fake scheduler manages task volumes with the volume driver under
+	// test, whatever volume driver name it reports.
+	if f, ok := s.(fakescheduler.Driver); ok {
+		if managed, ok := v.(fakescheduler.VolumeDriver); ok {
+			f.UseVolumeDriver(managed)
+		}
 	}
 
-	defer func() {
-		if ctx != nil {
-			s.Destroy(ctx)
+	var power node.Power
+	if cfg.Power.Driver != "" {
+		p, err := node.GetPower(cfg.Power.Driver)
+		if err != nil {
+			return nil, err
 		}
-		v.CleanupVolume(volName)
-	}()
-
-	if err = s.Schedule(ctx); err != nil {
-		return err
+		if err := p.Init(cfg); err != nil {
+			return nil, err
+		}
+		power = p
 	}
+	*env = scenarios.NewEnvironment(cfg, power)
 
-	// Sleep for fio to get going...
-	time.Sleep(20 * time.Second)
-
-	// Stop the volume driver.
-	log.Printf("Stopping the %v volume driver\n", v.String())
-	if err = v.StopDriver(ctx.Task.IP); err != nil {
-		return err
+	specs := tests.List()
+	if testName != "" {
+		log.Printf("Executing single test %v\n", testName)
+		spec, err := tests.Get(testName)
+		if err != nil {
+			return nil, err
+		}
+		specs = []tests.TestSpec{spec}
+	}
+
+	results := make([]tests.Result, 0, len(specs))
+	for _, spec := range specs {
+		log.Printf("Executing test %v\n", spec.Name)
+		result := tests.Run(spec, s, v)
+		switch result.Status {
+		case tests.Failed:
+			log.Printf("\tTest %v Failed with Error: %v.\n", spec.Name, result.Err)
+		case tests.Skipped:
+			log.Printf("\tTest %v Skipped: %v.\n", spec.Name, result.Reason)
+		default:
+			log.Printf("\tTest %v %v.\n", spec.Name, result.Status)
+		}
+		results = append(results, result)
 	}
 
-	// Sleep for fio to keep going...
-	time.Sleep(20 * time.Second)
+	return results, nil
+}
 
-	// Restart the volume driver.
-	log.Printf("Starting the %v volume driver\n", v.String())
-	if err = v.StartDriver(ctx.Task.IP); err != nil {
-		return err
+// summarize prints a table with the result of each test and returns the
+// process exit code for the results.  Tests that were skipped or are not
+// implemented do not count towards qualification, so they result in a
+// non-zero exit code.
+func summarize(results []tests.Result) int {
+	counts := make(map[tests.Status]int)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "TEST\tSTATUS\tDURATION\tERROR\n")
+	for _, result := range results {
+		counts[result.Status]++
+
+		errString := ""
+		switch {
+		case result.Err != nil:
+			errString = result.Err.Error()
+		case result.Reason != "":
+			errString = result.Reason
+		}
+		// Only print the first line of an error, the rest has
+		// already been logged when the test failed.
+		errString = strings.SplitN(errString, "\n", 2)[0]
+
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n",
+			result.Name,
+			result.Status,
+			(result.Duration/time.Second)*time.Second,
+			errString,
+		)
 	}
-
-	log.Printf("Waiting for the test task to exit\n")
-	if err = s.WaitDone(ctx); err != nil {
-		return err
+	if err := w.Flush(); err != nil {
+		log.Printf("Error while printing the test summary: %v\n", err)
 	}
 
-	if ctx.Status != 0 {
-		return fmt.Errorf("exit status %v\nStdout: %v\nStderr: %v",
-			ctx.Status,
-			ctx.Stdout,
-			ctx.Stderr,
-		)
+	log.Printf("%v: %v, %v: %v, %v: %v, %v: %v\n",
+		tests.Passed, counts[tests.Passed],
+		tests.Failed, counts[tests.Failed],
+		tests.Skipped, counts[tests.Skipped],
+		tests.NotImplemented, counts[tests.NotImplemented],
+	)
+
+	switch {
+	case counts[tests.Failed] > 0:
+		return exitFailed
+	case counts[tests.Skipped] > 0 || counts[tests.NotImplemented] > 0:
+		return exitIncomplete
 	}
-	return nil
+	return 0
 }
 
-// Volume driver plugin is down and the client container gets terminated.
-// There is a lost unmount call in this case. When the volume driver is
-// back up, we should be able to detach and delete the volume.
-func testDriverDownContainerDown(
-	s scheduler.Driver,
-	v volume.Driver,
+// writeReport writes the suite results to the given file using the writer
+// function.
+func writeReport(
+	path string,
+	suite *report.Suite,
+	writer func(io.Writer, *report.Suite) error,
 ) error {
-	taskName := "testDriverDownContainerDown"
-
-	// Pick the first node to start the task
-	nodes, err := s.GetNodes()
+	f, err := os.Create(path)
 	if err != nil {
 		return err
 	}
-
-	host := nodes[0]
-
-	// Remove any container and volume for this test - previous run may have failed.
-	s.DestroyByName(host, taskName)
-	v.CleanupVolume(volName)
-
-	t := scheduler.Task{
-		Name: taskName,
-		IP:   host,
-		Img:  testImage,
-		Tag:  "latest",
-		Cmd:  testArgs,
-		Vol: scheduler.Volume{
-			Driver: v.String(),
-			Name:   dynName,
-			Path:   "/mnt/",
-			Size:   10240,
-		},
+	err = writer(f, suite)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
 	}
+	return err
+}
 
-	ctx, err := s.Create(t)
-	if err != nil {
-		return err
-	}
-
-	defer func() {
-		if ctx != nil {
-			s.Destroy(ctx)
-		}
-		v.CleanupVolume(volName)
-	}()
-
-	if err = s.Schedule(ctx); err != nil {
-		return err
+// csiSanity runs the CSI spec conformance checks against the plugin at the
+// endpoint.  The endpoint defaults to the one in the volume configuration.
+func csiSanity(cfg *config.Config, endpoint string) (*report.Suite, error) {
+	if endpoint == "" {
+		endpoint = cfg.Volume.Endpoint
 	}
-
-	// Sleep for fio to get going...
-	time.Sleep(20 * time.Second)
-
-	// Stop the volume driver.
-	log.Printf("Stopping the %v volume driver\n", v.String())
-	if err = v.StopDriver(ctx.Task.IP); err != nil {
-		return err
+	if endpoint == "" {
+		endpoint = csi.DefaultEndpoint
 	}
 
-	// Wait for the task to exit. This will lead to a lost Unmount/Detach call.
-	log.Printf("Waiting for the test task to exit\n")
-	if err = s.WaitDone(ctx); err != nil {
-		return err
+	plugin, results, err := sanity.Run(sanity.Config{
+		Endpoint:    endpoint,
+		StagingPath: cfg.Volume.Options["stagingDir"],
+		TargetPath:  cfg.Volume.Options["targetDir"],
+	})
+	if err != nil {
+		return nil, err
 	}
+	logChecks(results)
 
-	if ctx.Status == 0 {
-		return fmt.Errorf("unexpected success exit status %v\nStdout: %v\nStderr: %v",
-			ctx.Status,
-			ctx.Stdout,
-			ctx.Stderr,
-		)
-	}
+	return &report.Suite{
+		Scheduler: "csi-sanity",
+		Volume:    plugin,
+		Timestamp: time.Now(),
+		Results:   results,
+	}, nil
+}
 
-	// Restart the volume driver.
-	log.Printf("Starting the %v volume driver\n", v.String())
-	if err = v.StartDriver(ctx.Task.IP); err != nil {
-		return err
-	}
+// dvdiConformance runs the Docker volume plugin protocol checks against the
+// plugin at the endpoint, or against the reference plugin.  An endpoint that
+// contains {address} or {id} is expanded for every node, and the plugin on
+// the other nodes is used to check that it honors its scope.
+func dvdiConformance(
+	cfg *config.Config,
+	endpoint string,
+	useReference bool,
+) (*report.Suite, error) {
+	conformanceCfg := conformance.Config{}
+	pluginName := endpoint
+	if useReference {
+		dir, err := ioutil.TempDir("", "torpedo-reference")
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if err := os.RemoveAll(dir); err != nil {
+				log.Printf("Could not remove %v: %v\n", dir, err)
+			}
+		}()
+
+		// Two nodes share the volumes of a global plugin.
+		plugin := reference.New(reference.Config{
+			Root:  filepath.Join(dir, "volumes"),
+			Scope: dvdi.ScopeGlobal,
+		})
+		defer plugin.Close()
+		for i := 0; i < 2; i++ {
+			id := "node-" + strconv.Itoa(i)
+			nodeEndpoint := "unix://" + filepath.Join(dir, id+".sock")
+			if err := plugin.Serve(node.Node{ID: id}, nodeEndpoint); err != nil {
+				return nil, err
+			}
+			if i == 0 {
+				conformanceCfg.Endpoint = nodeEndpoint
+			} else {
+				conformanceCfg.Peers = append(conformanceCfg.Peers, nodeEndpoint)
+			}
+		}
+		pluginName = reference.PluginName
+	} else {
+		if endpoint == "" {
+			endpoint = cfg.Volume.Endpoint
+			pluginName = cfg.Volume.Options["plugin"]
+		}
+		if endpoint == "" {
+			return nil, fmt.Errorf("the plugin endpoint is not set")
+		}
+		if pluginName == "" {
+			pluginName = endpoint
+		}
 
-	// Check to see if you can delete the volume from another node
-	log.Printf("Deleting the attached volume: %v from %v\n", volName, nodes[1])
-	if err = s.DeleteVolume(nodes[1], volName); err != nil {
-		return err
+		for _, n := range cfg.Nodes {
+			expanded := strings.Replace(endpoint, "{address}", n.Address, -1)
+			expanded = strings.Replace(expanded, "{id}", n.ID, -1)
+			if conformanceCfg.Endpoint == "" {
+				conformanceCfg.Endpoint = expanded
+			} else if expanded != conformanceCfg.Endpoint {
+				conformanceCfg.Peers = append(conformanceCfg.Peers, expanded)
+			}
+		}
+		if conformanceCfg.Endpoint == "" {
+			conformanceCfg.Endpoint = endpoint
+		}
 	}
 
-	return nil
-}
-
-// Verify that the volume driver can deal with an event where Docker and the
-// client container crash on this system.  The volume should be able
-// to get moounted on another node.
-func testRemoteForceMount(
-	s scheduler.Driver,
-	v volume.Driver,
-) error {
-	taskName := "testRemoteForceMount"
-
-	// Pick the first node to start the task
-	nodes, err := s.GetNodes()
+	results, err := conformance.Run(conformanceCfg)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	logChecks(results)
 
-	host := nodes[0]
-
-	// Remove any container and volume for this test - previous run may have failed.
-	s.DestroyByName(host, taskName)
-	v.CleanupVolume(volName)
-
-	t := scheduler.Task{
-		Name: taskName,
-		Img:  testImage,
-		IP:   host,
-		Tag:  "latest",
-		Cmd:  testArgs,
-		Vol: scheduler.Volume{
-			Driver: v.String(),
-			Name:   dynName,
-			Path:   "/mnt/",
-			Size:   10240,
-		},
-	}
+	return &report.Suite{
+		Scheduler: "dvdi-conformance",
+		Volume:    pluginName,
+		Timestamp: time.Now(),
+		Results:   results,
+	}, nil
+}
 
-	ctx, err := s.Create(t)
-	if err != nil {
-		return err
+// logChecks logs the result of each conformance check.
+func logChecks(results []tests.Result) {
+	for _, result := range results {
+		switch result.Status {
+		case tests.Failed:
+			log.Printf("\tCheck %v Failed with Error: %v.\n", result.Name, result.Err)
+		case tests.Skipped:
+			log.Printf("\tCheck %v Skipped: %v.\n", result.Name, result.Reason)
+		default:
+			log.Printf("\tCheck %v %v.\n", result.Name, result.Status)
+		}
 	}
+}
 
-	sc, err := systemd.NewSystemdClient()
-	if err != nil {
-		return err
-	}
-	defer func() {
-		if err = sc.Start(dockerServiceName); err != nil {
-			log.Printf("Error while restarting Docker: %v\n", err)
+// writeResults writes the suite results as JUnit XML and JSON to the given
+// files, if any.
+func writeResults(suite *report.Suite, junitPath, jsonPath string) {
+	if junitPath != "" {
+		if err := writeReport(junitPath, suite, report.WriteJUnit); err != nil {
+			log.Fatalf("Error writing JUnit report to %v: %v\n", junitPath, err)
 		}
-		if ctx != nil {
-			s.Destroy(ctx)
-		}
-		v.CleanupVolume(volName)
-	}()
-
-	log.Printf("Starting test task on local node.\n")
-	if err = s.Schedule(ctx); err != nil {
-		return err
 	}
-
-	// Sleep for fio to get going...
-	time.Sleep(20 * time.Second)
-
-	// Kill Docker.
-	log.Printf("Stopping Docker.\n")
-	if err = sc.Stop(dockerServiceName); err != nil {
-		return err
+	if jsonPath != "" {
+		if err := writeReport(jsonPath, suite, report.WriteJSON); err != nil {
+			log.Fatalf("Error writing JSON report to %v: %v\n", jsonPath, err)
+		}
 	}
+}
 
-	// 40 second grace period before we try to use the volume elsewhere.
-	time.Sleep(40 * time.Second)
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %v [options] <scheduler> <volume driver> [testName]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %v [options] report <scheduler> <volume driver>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %v [options] csi-sanity [endpoint]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %v [options] dvdi-conformance [endpoint]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %v list\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Options:\n")
+	flag.PrintDefaults()
+}
 
-	// Start a task on a new system with this same volume.
-	log.Printf("Creating the test task on a new host.\n")
-	t.IP = scheduler.ExternalHost
-	if ctx, err = s.Create(t); err != nil {
-		log.Printf("Error while creating remote task: %v\n", err)
-		return err
+func main() {
+	configPath := flag.String("config", "", "YAML or JSON file that describes the cluster nodes")
+	junitPath := flag.String("junit", "", "Write the test results as JUnit XML to this file")
+	jsonPath := flag.String("json", "", "Write the test results as JSON to this file")
+	formatName := flag.String("format", "markdown", "Format of the qualification report: markdown or html")
+	outputPath := flag.String("output", "", "Write the qualification report to this file instead of stdout")
+	useReference := flag.Bool("reference", false, "Run dvdi-conformance against the in-tree reference plugin")
+	flag.Usage = usage
+	flag.Parse()
+
+	if err := registerTests(); err != nil {
+		log.Fatalf("Error registering tests: %v\n", err)
+	}
+
+	args := flag.Args()
+	if len(args) > 0 && args[0] == "list" {
+		if err := list(); err != nil {
+			os.Exit(-1)
+		}
+		return
+	}
+
+	qualify := false
+	checkCSI := false
+	checkDVDI := false
+	switch {
+	case len(args) > 0 && args[0] == "report":
+		qualify = true
+		args = args[1:]
+	case len(args) > 0 && args[0] == "csi-sanity":
+		checkCSI = true
+		args = args[1:]
+	case len(args) > 0 && args[0] == "dvdi-conformance":
+		checkDVDI = true
+		args = args[1:]
+	}
+
+	if checkCSI || checkDVDI {
+		if len(args) > 1 {
+			usage()
+			os.Exit(-1)
+		}
+	} else if len(args) < 2 || (qualify && len(args) > 2) {
+		usage()
+		os.Exit(-1)
 	}
 
-	if err = s.Schedule(ctx); err != nil {
-		return err
+	format := report.Markdown
+	switch *formatName {
+	case "markdown":
+	case "html":
+		format = report.HTML
+	default:
+		log.Fatalf("Unknown report format %v\n", *formatName)
 	}
 
-	// Sleep for fio to get going...
-	time.Sleep(20 * time.Second)
-
-	// Wait for the task to exit. This will lead to a lost Unmount/Detach call.
-	log.Printf("Waiting for the test task to exit\n")
-	if err = s.WaitDone(ctx); err != nil {
-		return err
-	}
-
-	if ctx.Status != 0 {
-		return fmt.Errorf("exit status %v\nStdout: %v\nStderr: %v",
-			ctx.Status,
-			ctx.Stdout,
-			ctx.Stderr,
-		)
+	var cfg *config.Config
+	if *configPath != "" {
+		var err error
+		if cfg, err = config.Load(*configPath); err != nil {
+			log.Fatalf("Error loading the cluster configuration: %v\n", err)
+		}
+	} else {
+		cfg = config.FromAddresses(strings.Split(os.Getenv("CLUSTER_NODES"), ","))
 	}
 
-	// Restart Docker.
-	log.Printf("Restarting Docker.\n")
-	for i, err := 0, sc.Start(dockerServiceName); err != nil; i, err = i+1, sc.Start(dockerServiceName) {
-		if err.Error() == systemd.JobExecutionTookTooLongError.Error() {
-			if i < 20 {
-				log.Printf("Docker taking too long to start... retry attempt %v\n", i)
-			} else {
-				return fmt.Errorf("could not restart Docker")
-			}
+	if checkCSI || checkDVDI {
+		endpoint := ""
+		if len(args) > 0 {
+			endpoint = args[0]
+		}
+		var suite *report.Suite
+		var err error
+		if checkCSI {
+			suite, err = csiSanity(cfg, endpoint)
 		} else {
-			return err
+			suite, err = dvdiConformance(cfg, endpoint, *useReference)
+		}
+		if err != nil {
+			log.Fatalf("Error checking the plugin: %v\n", err)
+		}
+		writeResults(suite, *junitPath, *jsonPath)
+		if code := summarize(suite.Results); code != 0 {
+			os.Exit(code)
 		}
+		log.Printf("%v checks complete with this plugin: %v\n", suite.Scheduler, suite.Volume)
+		return
 	}
 
-	// Wait for the volume driver to start.
-	log.Printf("Waiting for the %v volume driver to start back up\n", v.String())
-	if err = v.WaitStart(ctx.Task.IP); err != nil {
-		return err
+	if len(cfg.Nodes) < 3 {
+		log.Printf("There are not enough nodes in this cluster.  Most tests will fail.\n")
+		log.Printf("Describe the cluster nodes with --config or use 'export CLUSTER_NODES=\"192.168.1.100,192.168.1.101,192.168.1.102\"'")
 	}
 
-	// Check to see if you can delete the volume.
-	log.Printf("Deleting the attached volume: %v from this host\n", volName)
-	if err = s.DeleteVolume("localhost", volName); err != nil {
-		return err
+	testName := ""
+	if len(args) > 2 {
+		testName = args[2]
 	}
-	return nil
-}
-
-// A container is using a volume on node X.  Node X is now powered off.
-func testNodePowerOff(
-	s scheduler.Driver,
-	v volume.Driver,
-) error {
-	return nil
-}
-
-// Storage plugin is down.  Scheduler tries to create a container using the
-// provider’s volume.
-func testPluginDown(
-	d scheduler.Driver,
-	v volume.Driver,
-) error {
-	return nil
-}
 
-// A container is running on node X.  Node X loses network access and is
-// partitioned away.  Node Y that is in the cluster can use the volume for
-// another container.
-func testNetworkDown(
-	d scheduler.Driver,
-	v volume.Driver,
-) error {
-	return nil
-}
-
-// A container is running on node X.  Node X can only see a subset of the
-// storage cluster.  That is, it can see the entire DC/OS cluster, but just the
-// storage cluster gets a network partition. Node Y that is in the cluster
-// can use the volume for another container.
-func testNetworkPartition(
-	s scheduler.Driver,
-	v volume.Driver,
-) error {
-	return nil
-}
-
-// Docker daemon crashes and live restore is enabled.
-func testDockerDownLiveRestore(
-	s scheduler.Driver,
-	v volume.Driver,
-) error {
-	return nil
-}
-
-func run(
-	s scheduler.Driver,
-	v volume.Driver,
-	testName string,
-) error {
-	if err := s.Init(); err != nil {
-		log.Fatalf("Error initializing schedule driver")
-		return err
+	s, err := scheduler.Get(args[0])
+	if err != nil {
+		log.Fatalf("Cannot find scheduler driver %v\n", args[0])
 	}
-
-	if err := v.Init(); err != nil {
-		log.Fatalf("Error initializing volume driver")
-		return err
+	v, err := volume.Get(args[1])
+	if err != nil {
+		log.Fatalf("Cannot find volume driver %v\n", args[1])
 	}
 
-	// Add new test functions here.
-	testFuncs := map[string]testDriverFunc{
-		"testDynamicVolume":           testDynamicVolume,
-		"testRemoteForceMount":        testRemoteForceMount,
-		"testDriverDown":              testDriverDown,
-		"testDriverDownContainerDown": testDriverDownContainerDown,
-		"testNodePowerOff":            testNodePowerOff,
-		"testPluginDown":              testPluginDown,
-		"testNetworkDown":             testNetworkDown,
-		"testNetworkPartition":        testNetworkPartition,
-		"testDockerDownLiveRestore":   testDockerDownLiveRestore,
+	suite := &report.Suite{
+		Scheduler: args[0],
+		Volume:    args[1],
+		Timestamp: time.Now(),
+	}
+	if suite.Results, err = run(s, v, cfg, testName); err != nil {
+		log.Printf("%v\n", err)
+		os.Exit(-1)
 	}
 
-	if testName != "" {
-		log.Printf("Executing single test %v\n", testName)
-		f, ok := testFuncs[testName]
-
-		if !ok {
-			return fmt.Errorf("unknown test function %v", testName)
+	if qualify {
+		if suite.Environment, err = report.Fingerprint(cfg, s, v); err != nil {
+			log.Fatalf("Error collecting the environment specifics: %v\n", err)
 		}
-
-		if err := f(s, v); err != nil {
-			log.Printf("\tTest %v Failed with Error: %v.\n", testName, err)
-			return err
+		writer := func(w io.Writer, suite *report.Suite) error {
+			return report.WriteQualification(w, suite, format)
 		}
-		log.Printf("\tTest %v Passed.\n", testName)
-		return nil
-	}
-
-	for n, f := range testFuncs {
-		log.Printf("Executing test %v\n", n)
-		if err := f(s, v); err != nil {
-			log.Printf("\tTest %v Failed with Error: %v.\n", n, err)
+		if *outputPath == "" {
+			err = writer(os.Stdout, suite)
 		} else {
-			log.Printf("\tTest %v Passed.\n", n)
+			err = writeReport(*outputPath, suite, writer)
+		}
+		if err != nil {
+			log.Fatalf("Error writing the qualification report: %v\n", err)
 		}
 	}
 
-	return nil
-}
-
-func main() {
-	if len(os.Args) < 2 {
-		fmt.Printf("Usage: %v <scheduler> <volume driver> [testName]\n", os.Args[0])
-		os.Exit(-1)
-	}
-
-	nodes := strings.Split(os.Getenv("CLUSTER_NODES"), ",")
-	if len(nodes) < 3 {
-		log.Printf("There are not enough nodes in this cluster.  Most tests will fail.\n")
-		log.Printf("Use 'export CLUSTER_NODES=\"192.168.1.100,192.168.1.101,192.168.1.102\"'")
-	}
-
-	testName := ""
-	if len(os.Args) > 3 {
-		testName = os.Args[3]
-	}
+	writeResults(suite, *junitPath, *jsonPath)
 
-	if s, err := scheduler.Get(os.Args[1]); err != nil {
-		log.Fatalf("Cannot find scheduler driver %v\n", os.Args[1])
-		os.Exit(-1)
-	} else if v, err := volume.Get(os.Args[2]); err != nil {
-		log.Fatalf("Cannot find scheduler driver %v\n", os.Args[1])
-		os.Exit(-1)
-	} else {
-		if run(s, v, testName) != nil {
-			os.Exit(-1)
-		}
+	if code := summarize(suite.Results); code != 0 {
+		os.Exit(code)
 	}
 
 	log.Printf("Test suite complete with this driver: %v, and this scheduler: %v\n",
-		os.Args[2],
-		os.Args[1],
+		args[1],
+		args[0],
 	)
 }
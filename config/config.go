@@ -0,0 +1,261 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// DefaultDockerPort is the TCP port Docker daemons listen on.
+	DefaultDockerPort = 2375
+	// DefaultVolumePort is the management port of the volume driver.  This
+	// is the openstorage REST port.
+	DefaultVolumePort = 9001
+	// DefaultSSHPort is the port the SSH daemon listens on.
+	DefaultSSHPort = 22
+
+	// RoleStorage is the role of a node that is part of the storage cluster.
+	RoleStorage = "storage"
+	// RoleScheduler is the role of a node that runs scheduler tasks.
+	RoleScheduler = "scheduler"
+)
+
+// Config describes the cluster Torpedo runs the tests against.
+type Config struct {
+	// Nodes is the list of nodes in the cluster.
+	Nodes []Node `yaml:"nodes"`
+	// Docker holds the default port and TLS material for the Docker daemon
+	// on each node.
+	Docker Docker `yaml:"docker"`
+	// Scheduler holds the scheduler driver settings.
+	Scheduler Scheduler `yaml:"scheduler"`
+	// Volume holds the volume driver settings.
+	Volume Volume `yaml:"volume"`
+	// Power holds the settings of the driver that powers the nodes off and
+	// on.
+	Power Power `yaml:"power"`
+}
+
+// Node describes a single node in the cluster.
+type Node struct {
+	// ID uniquely identifies the node.  Defaults to the address.
+	ID string `yaml:"id"`
+	// Hostname of the node.  Defaults to the address.
+	Hostname string `yaml:"hostname"`
+	// Address is the management IP address or hostname of the node.
+	Address string `yaml:"address"`
+	// DataAddress is the IP address of the node on the data network.
+	// Defaults to the address.
+	DataAddress string `yaml:"dataAddress"`
+	// Labels are arbitrary key value pairs that describe the node.
+	Labels map[string]string `yaml:"labels"`
+	// Docker describes how to reach the Docker daemon on this node.
+	Docker Docker `yaml:"docker"`
+	// SSH describes how to log into this node.
+	SSH SSH `yaml:"ssh"`
+	// Roles is a list of the roles of this node.  A node without any
+	// roles is both a storage and a scheduler node.
+	Roles []string `yaml:"roles"`
+	// Power are power driver settings for this node, such as its libvirt
+	// domain or the address of its BMC.  They override the power driver
+	// options.
+	Power map[string]string `yaml:"power"`
+}
+
+// Docker describes how to reach a Docker daemon.
+type Docker struct {
+	// Endpoint of the Docker daemon, for example tcp://192.168.1.100:2375.
+	Endpoint string `yaml:"endpoint"`
+	// Port of the Docker daemon, used if the endpoint is not specified.
+	Port int `yaml:"port"`
+	// TLS material used to connect to the Docker daemon.
+	TLS TLS `yaml:"tls"`
+}
+
+// TLS holds the paths to the TLS material used to connect to a service.
+type TLS struct {
+	CA   string `yaml:"ca"`
+	Cert string `yaml:"cert"`
+	Key  string `yaml:"key"`
+}
+
+// SSH holds the credentials to log into a node.
+type SSH struct {
+	User    string `yaml:"user"`
+	Port    int    `yaml:"port"`
+	KeyFile string `yaml:"keyFile"`
+	// InsecureHostKey accepts any host key from the node.  By default the
+	// host key of the node must already be in the known hosts.
+	InsecureHostKey bool `yaml:"insecureHostKey"`
+}
+
+// Scheduler holds the scheduler driver settings.
+type Scheduler struct {
+	// Endpoint of the scheduler API, for example http://marathon:8080.
+	Endpoint string `yaml:"endpoint"`
+	// Options are scheduler driver specific settings.
+	Options map[string]string `yaml:"options"`
+}
+
+// Volume holds the volume driver settings.
+type Volume struct {
+	// Port is the management port of the volume driver.
+	Port int `yaml:"port"`
+	// Endpoint of the volume driver API, for example the unix socket of a
+	// CSI plugin.
+	Endpoint string `yaml:"endpoint"`
+	// Options are volume driver specific settings.
+	Options map[string]string `yaml:"options"`
+	// Ports are the ports the storage nodes talk to each other on, such
+	// as 9001-9022 or 9002/udp.  Storage network partitions drop the
+	// traffic on these ports.
+	Ports []string `yaml:"ports"`
+}
+
+// Power holds the power driver settings.
+type Power struct {
+	// Driver is the name of the power driver, such as libvirt, ipmi or ssh.
+	Driver string `yaml:"driver"`
+	// Options are power driver specific settings.
+	Options map[string]string `yaml:"options"`
+}
+
+// Load reads a cluster configuration from a YAML or JSON file.
+func Load(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &Config{}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("could not parse %v: %v", path, err)
+	}
+
+	for i, node := range config.Nodes {
+		if node.Address == "" {
+			return nil, fmt.Errorf("node %v in %v does not have an address", i, path)
+		}
+	}
+	config.setDefaults()
+	return config, nil
+}
+
+// FromAddresses returns a configuration with the default settings for a list
+// of node addresses.
+func FromAddresses(addresses []string) *Config {
+	config := &Config{}
+	for _, address := range addresses {
+		if address = strings.TrimSpace(address); address != "" {
+			config.Nodes = append(config.Nodes, Node{Address: address})
+		}
+	}
+	config.setDefaults()
+	return config
+}
+
+// Addresses returns the addresses of all nodes in the cluster.
+func (c *Config) Addresses() []string {
+	addresses := make([]string, 0, len(c.Nodes))
+	for _, node := range c.Nodes {
+		addresses = append(addresses, node.Address)
+	}
+	return addresses
+}
+
+// Lookup returns the node with the given address.  A node that is not in
+// the configuration gets the default settings.
+func (c *Config) Lookup(address string) Node {
+	for _, node := range c.Nodes {
+		if node.Address == address {
+			return node
+		}
+	}
+	node := Node{Address: address}
+	c.setNodeDefaults(&node)
+	return node
+}
+
+// PowerOptions returns the power driver options for the node with the given
+// address.  The settings of the node override the power driver options.
+func (c *Config) PowerOptions(address string) map[string]string {
+	opts := make(map[string]string)
+	for k, v := range c.Power.Options {
+		opts[k] = v
+	}
+	for k, v := range c.Lookup(address).Power {
+		opts[k] = v
+	}
+	return opts
+}
+
+// HasRole returns true if the node has the given role.
+func (n *Node) HasRole(role string) bool {
+	for _, r := range n.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// DockerClient returns a client for the Docker daemon on this node.
+func (n *Node) DockerClient() (*dockerclient.Client, error) {
+	if n.Docker.TLS.Cert != "" {
+		return dockerclient.NewTLSClient(
+			n.Docker.Endpoint,
+			n.Docker.TLS.Cert,
+			n.Docker.TLS.Key,
+			n.Docker.TLS.CA,
+		)
+	}
+	return dockerclient.NewClient(n.Docker.Endpoint)
+}
+
+func (c *Config) setDefaults() {
+	if c.Docker.Port == 0 {
+		c.Docker.Port = DefaultDockerPort
+	}
+	if c.Volume.Port == 0 {
+		c.Volume.Port = DefaultVolumePort
+	}
+
+	for i := range c.Nodes {
+		c.setNodeDefaults(&c.Nodes[i])
+	}
+}
+
+func (c *Config) setNodeDefaults(node *Node) {
+	if node.ID == "" {
+		node.ID = node.Address
+	}
+	if node.Hostname == "" {
+		node.Hostname = node.Address
+	}
+	if node.DataAddress == "" {
+		node.DataAddress = node.Address
+	}
+	if node.Docker.Port == 0 {
+		node.Docker.Port = c.Docker.Port
+	}
+	if node.Docker.Endpoint == "" {
+		node.Docker.Endpoint = "tcp://" + node.Address + ":" + strconv.Itoa(node.Docker.Port)
+	}
+	if node.Docker.TLS == (TLS{}) {
+		node.Docker.TLS = c.Docker.TLS
+	}
+	if node.SSH.Port == 0 {
+		node.SSH.Port = DefaultSSHPort
+	}
+	if node.SSH.User == "" {
+		node.SSH.User = "root"
+	}
+	if len(node.Roles) == 0 {
+		node.Roles = []string{RoleStorage, RoleScheduler}
+	}
+}
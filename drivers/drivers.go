@@ -1,7 +1,11 @@
 package drivers
 
+import (
+	"github.com/portworx/torpedo/config"
+)
+
 // Driver specifies the most basic methods to be implemented by a Torpedo driver.
 type Driver interface {
-	// Init the driver.
-	Init() error
+	// Init the driver with the cluster configuration.
+	Init(*config.Config) error
 }
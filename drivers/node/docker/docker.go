@@ -0,0 +1,49 @@
+package docker
+
+import (
+	dockerclient "github.com/fsouza/go-dockerclient"
+
+	"github.com/portworx/torpedo/config"
+	"github.com/portworx/torpedo/drivers/node"
+)
+
+const (
+	// ConfigFile is the configuration file of the Docker daemon.
+	ConfigFile = "/etc/docker/daemon.json"
+	// Unit is the systemd unit of the Docker daemon.
+	Unit = "docker.service"
+)
+
+// Daemon manipulates the Docker daemon of the nodes, to simulate a Docker
+// daemon that crashes.  The daemon is configured and controlled over the
+// node executors, and inspected with the Docker client of each node.
+type Daemon interface {
+	// SetLiveRestore enables or disables live restore in the daemon
+	// configuration of a node, and reloads the daemon.  The configuration
+	// the node had before is kept, so that RestoreConfig can put it back.
+	// The configuration is left alone if the daemon already has live
+	// restore set as requested.
+	SetLiveRestore(n node.Node, enabled bool) error
+
+	// RestoreConfig puts back the daemon configuration a node had before
+	// SetLiveRestore, and reloads the daemon.  It does nothing if the
+	// configuration was not changed.
+	RestoreConfig(n node.Node) error
+
+	// Kill kills the daemon of a node with SIGKILL, as if it crashed.  The
+	// containers and their shims are not killed.
+	Kill(n node.Node) error
+
+	// Start starts the daemon of a node and waits for it to answer.
+	Start(n node.Node) error
+
+	// VolumeContainer returns the running container on a node that has a
+	// volume of the volume driver mounted at the given path.
+	VolumeContainer(n node.Node, volumeDriver, path string) (*dockerclient.Container, error)
+}
+
+// New returns a Docker daemon controller for the nodes in the cluster
+// configuration.
+func New(cfg *config.Config) Daemon {
+	return newDaemon(cfg)
+}
@@ -0,0 +1,266 @@
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+
+	"github.com/portworx/torpedo/config"
+	"github.com/portworx/torpedo/drivers/node"
+)
+
+const (
+	// liveRestoreKey is the daemon configuration key of live restore.
+	liveRestoreKey = "live-restore"
+	// reloadTimeout is how long to wait for the daemon to apply its
+	// configuration after a reload.
+	reloadTimeout = 30 * time.Second
+	// startTimeout is how long to wait for the daemon to answer after it
+	// is started.
+	startTimeout = time.Minute
+)
+
+// original is the daemon configuration a node had before it was changed.
+type original struct {
+	// exists is false if the node had no configuration file.
+	exists      bool
+	content     string
+	liveRestore bool
+}
+
+type daemon struct {
+	sync.Mutex
+	config *config.Config
+	// originals holds the original daemon configurations by node ID.
+	originals map[string]*original
+}
+
+func newDaemon(cfg *config.Config) *daemon {
+	return &daemon{
+		config:    cfg,
+		originals: make(map[string]*original),
+	}
+}
+
+func (d *daemon) SetLiveRestore(n node.Node, enabled bool) error {
+	enabledNow, err := d.liveRestore(n)
+	if err != nil {
+		return err
+	}
+	if enabledNow == enabled {
+		log.Printf("Live restore is already set to %v on %v\n", enabled, n.MgmtIP)
+		return nil
+	}
+
+	orig, err := d.readConfig(n)
+	if err != nil {
+		return err
+	}
+	settings := make(map[string]interface{})
+	if strings.TrimSpace(orig.content) != "" {
+		if err = json.Unmarshal([]byte(orig.content), &settings); err != nil {
+			return fmt.Errorf("invalid Docker daemon configuration %v on %v: %v", ConfigFile, n.MgmtIP, err)
+		}
+	}
+	orig.liveRestore = enabledNow
+	settings[liveRestoreKey] = enabled
+
+	content, err := json.MarshalIndent(settings, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	// Only the first change is kept, since it holds the configuration the
+	// node had before Torpedo touched it.
+	d.Lock()
+	if _, ok := d.originals[n.ID]; !ok {
+		d.originals[n.ID] = orig
+	}
+	d.Unlock()
+
+	log.Printf("Setting live restore to %v in %v on %v\n", enabled, ConfigFile, n.MgmtIP)
+	if err = d.writeConfig(n, string(content)+"\n"); err != nil {
+		return err
+	}
+	return d.reload(n, enabled)
+}
+
+func (d *daemon) RestoreConfig(n node.Node) error {
+	d.Lock()
+	orig, ok := d.originals[n.ID]
+	delete(d.originals, n.ID)
+	d.Unlock()
+	if !ok {
+		return nil
+	}
+
+	log.Printf("Restoring %v on %v\n", ConfigFile, n.MgmtIP)
+	var err error
+	if orig.exists {
+		err = d.writeConfig(n, orig.content)
+	} else {
+		_, err = node.NewExecutor(d.config, n).RunCommand("rm -f " + ConfigFile)
+	}
+	if err != nil {
+		return err
+	}
+	return d.reload(n, orig.liveRestore)
+}
+
+func (d *daemon) Kill(n node.Node) error {
+	// Only the main process is killed.  Without live restore, it is the
+	// daemon that stops the containers when it starts again.
+	log.Printf("Killing the Docker daemon on %v\n", n.MgmtIP)
+	_, err := node.NewExecutor(d.config, n).RunCommand(
+		"systemctl kill --kill-who=main --signal=SIGKILL " + Unit,
+	)
+	return err
+}
+
+func (d *daemon) Start(n node.Node) error {
+	log.Printf("Starting the Docker daemon on %v\n", n.MgmtIP)
+	if err := node.NewExecutor(d.config, n).StartService(Unit); err != nil {
+		return err
+	}
+
+	cfgNode := d.config.Lookup(n.MgmtIP)
+	docker, err := cfgNode.DockerClient()
+	if err != nil {
+		return err
+	}
+	for start := time.Now(); time.Since(start) < startTimeout; time.Sleep(time.Second) {
+		if err = docker.Ping(); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("the Docker daemon did not start up on %v in time: %v", n.MgmtIP, err)
+}
+
+func (d *daemon) VolumeContainer(
+	n node.Node,
+	volumeDriver string,
+	path string,
+) (*dockerclient.Container, error) {
+	cfgNode := d.config.Lookup(n.MgmtIP)
+	docker, err := cfgNode.DockerClient()
+	if err != nil {
+		return nil, err
+	}
+
+	containers, err := docker.ListContainers(dockerclient.ListContainersOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range containers {
+		for _, m := range c.Mounts {
+			if m.Driver == volumeDriver && filepath.Clean(m.Destination) == filepath.Clean(path) {
+				return docker.InspectContainer(c.ID)
+			}
+		}
+	}
+	return nil, fmt.Errorf(
+		"there is no running container with a %v volume mounted at %v on %v",
+		volumeDriver,
+		path,
+		n.MgmtIP,
+	)
+}
+
+// liveRestore returns true if the daemon of a node has live restore
+// enabled.
+func (d *daemon) liveRestore(n node.Node) (bool, error) {
+	cfgNode := d.config.Lookup(n.MgmtIP)
+	docker, err := cfgNode.DockerClient()
+	if err != nil {
+		return false, err
+	}
+	info, err := docker.Info()
+	if err != nil {
+		return false, err
+	}
+	return info.LiveRestoreEnabled, nil
+}
+
+// readConfig returns the daemon configuration of a node.
+func (d *daemon) readConfig(n node.Node) (*original, error) {
+	e := node.NewExecutor(d.config, n)
+	exists, err := e.RunCommand("if [ -e " + ConfigFile + " ]; then echo yes; fi")
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(exists) != "yes" {
+		return &original{}, nil
+	}
+
+	content, err := e.RunCommand("cat " + ConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	return &original{exists: true, content: content}, nil
+}
+
+// writeConfig replaces the daemon configuration of a node.  The file is
+// copied next to the configuration and moved over it, so that the daemon
+// never reads a partial configuration.
+func (d *daemon) writeConfig(n node.Node, content string) error {
+	f, err := ioutil.TempFile("", "daemon.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err = f.WriteString(content); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(f.Name(), 0644); err != nil {
+		return err
+	}
+
+	e := node.NewExecutor(d.config, n)
+	if _, err = e.RunCommand("mkdir -p " + filepath.Dir(ConfigFile)); err != nil {
+		return err
+	}
+	tmp := ConfigFile + ".torpedo"
+	if err = e.CopyFile(f.Name(), tmp); err != nil {
+		return err
+	}
+	_, err = e.RunCommand("mv -f " + tmp + " " + ConfigFile)
+	return err
+}
+
+// reload makes the daemon of a node read its configuration again, and waits
+// for it to report live restore as expected.
+func (d *daemon) reload(n node.Node, liveRestore bool) error {
+	if _, err := node.NewExecutor(d.config, n).RunCommand("systemctl reload " + Unit); err != nil {
+		return err
+	}
+
+	var enabled bool
+	var err error
+	for start := time.Now(); time.Since(start) < reloadTimeout; time.Sleep(time.Second) {
+		if enabled, err = d.liveRestore(n); err == nil && enabled == liveRestore {
+			return nil
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("the Docker daemon on %v did not reload in time: %v", n.MgmtIP, err)
+	}
+	return fmt.Errorf(
+		"the Docker daemon on %v did not apply live restore %v, check %v and the daemon flags",
+		n.MgmtIP,
+		liveRestore,
+		ConfigFile,
+	)
+}
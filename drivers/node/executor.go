@@ -0,0 +1,161 @@
+package node
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/portworx/torpedo/config"
+)
+
+const (
+	// sshConnectTimeout is how long to wait for an SSH connection, in
+	// seconds.
+	sshConnectTimeout = 10
+)
+
+// localExecutor runs commands on the node Torpedo runs on.
+type localExecutor struct{}
+
+// sshExecutor runs commands on a node over SSH.
+type sshExecutor struct {
+	node config.Node
+}
+
+func newLocalExecutor() *localExecutor {
+	return &localExecutor{}
+}
+
+func newSSHExecutor(cfgNode config.Node) *sshExecutor {
+	return &sshExecutor{node: cfgNode}
+}
+
+func (e *localExecutor) RunCommand(command string) (string, error) {
+	return run(exec.Command("sh", "-c", command), command, "localhost")
+}
+
+func (e *localExecutor) StartService(unit string) error {
+	return startService(e, unit)
+}
+
+func (e *localExecutor) StopService(unit string) error {
+	return stopService(e, unit)
+}
+
+func (e *localExecutor) ServiceStatus(unit string) (string, error) {
+	return serviceStatus(e, unit)
+}
+
+func (e *localExecutor) CopyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode())
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func (e *localExecutor) IsReachable() error {
+	return nil
+}
+
+func (e *sshExecutor) RunCommand(command string) (string, error) {
+	args := append(e.options("-p"), e.node.SSH.User+"@"+e.node.Address, "--", command)
+	return run(exec.Command("ssh", args...), command, e.node.Address)
+}
+
+func (e *sshExecutor) StartService(unit string) error {
+	return startService(e, unit)
+}
+
+func (e *sshExecutor) StopService(unit string) error {
+	return stopService(e, unit)
+}
+
+func (e *sshExecutor) ServiceStatus(unit string) (string, error) {
+	return serviceStatus(e, unit)
+}
+
+func (e *sshExecutor) CopyFile(src, dst string) error {
+	args := append(e.options("-P"), src, e.node.SSH.User+"@"+e.node.Address+":"+dst)
+	_, err := run(exec.Command("scp", args...), "copy "+src+" to "+dst, e.node.Address)
+	return err
+}
+
+func (e *sshExecutor) IsReachable() error {
+	_, err := e.RunCommand("true")
+	return err
+}
+
+// options returns the options of ssh or scp to log into the node without
+// prompting.  ssh and scp take the port with different flags.
+func (e *sshExecutor) options(portFlag string) []string {
+	args := []string{
+		"-o", "BatchMode=yes",
+		"-o", "ConnectTimeout=" + strconv.Itoa(sshConnectTimeout),
+		portFlag, strconv.Itoa(e.node.SSH.Port),
+	}
+	if e.node.SSH.InsecureHostKey {
+		args = append(args, "-o", "StrictHostKeyChecking=no")
+	}
+	if e.node.SSH.KeyFile != "" {
+		args = append(args, "-i", e.node.SSH.KeyFile)
+	}
+	return args
+}
+
+func startService(e Executor, unit string) error {
+	_, err := e.RunCommand("systemctl start " + unit)
+	return err
+}
+
+func stopService(e Executor, unit string) error {
+	_, err := e.RunCommand("systemctl stop " + unit)
+	return err
+}
+
+// serviceStatus returns the state systemctl is-active reports.  is-active
+// exits with a non-zero status for units that are not active, so its output
+// is the status even when it fails.
+func serviceStatus(e Executor, unit string) (string, error) {
+	status, err := e.RunCommand("systemctl is-active " + unit)
+	if status = strings.TrimSpace(status); status != "" {
+		return status, nil
+	}
+	return "", err
+}
+
+// run runs a command and returns its standard output.  description and
+// address describe the command in errors.
+func run(cmd *exec.Cmd, description, address string) (string, error) {
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return string(output), fmt.Errorf(
+			"%v on %v failed: %v: %v",
+			description,
+			address,
+			err,
+			strings.TrimSpace(stderr.String()),
+		)
+	}
+	return string(output), nil
+}
@@ -0,0 +1,100 @@
+package ipmi
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/portworx/torpedo/config"
+	"github.com/portworx/torpedo/drivers/node"
+)
+
+type power struct {
+	config *config.Config
+}
+
+func newPower() *power {
+	return &power{}
+}
+
+func (p *power) String() string {
+	return Name
+}
+
+func (p *power) Init(cfg *config.Config) error {
+	if _, err := exec.LookPath("ipmitool"); err != nil {
+		return fmt.Errorf("the IPMI power driver needs ipmitool: %v", err)
+	}
+	for _, n := range cfg.Nodes {
+		if cfg.PowerOptions(n.Address)["address"] == "" {
+			return fmt.Errorf("the BMC address of %v is not set", n.Address)
+		}
+	}
+	p.config = cfg
+	return nil
+}
+
+func (p *power) PowerOff(n node.Node) error {
+	_, err := p.chassisPower(n, "off")
+	return err
+}
+
+func (p *power) PowerOn(n node.Node) error {
+	_, err := p.chassisPower(n, "on")
+	return err
+}
+
+func (p *power) CanPowerOn() bool {
+	return true
+}
+
+func (p *power) Reboot(n node.Node) error {
+	_, err := p.chassisPower(n, "reset")
+	return err
+}
+
+func (p *power) IsUp(n node.Node) (bool, error) {
+	status, err := p.chassisPower(n, "status")
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(status) == "Chassis Power is on", nil
+}
+
+// chassisPower runs an ipmitool chassis power command against the BMC of a
+// node and returns its output.  The password is passed in the environment,
+// so that it does not show up in the process list.
+func (p *power) chassisPower(n node.Node, command string) (string, error) {
+	opts := p.config.PowerOptions(n.MgmtIP)
+	iface := opts["interface"]
+	if iface == "" {
+		iface = DefaultInterface
+	}
+
+	args := []string{"-I", iface, "-H", opts["address"]}
+	if opts["user"] != "" {
+		args = append(args, "-U", opts["user"])
+	}
+	if opts["password"] != "" {
+		args = append(args, "-E")
+	}
+	args = append(args, "chassis", "power", command)
+
+	cmd := exec.Command("ipmitool", args...)
+	cmd.Env = append(os.Environ(), "IPMI_PASSWORD="+opts["password"])
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf(
+			"ipmitool chassis power %v for %v failed: %v: %v",
+			command,
+			n.MgmtIP,
+			err,
+			strings.TrimSpace(stderr.String()),
+		)
+	}
+	return string(output), nil
+}
@@ -0,0 +1,31 @@
+package ipmi
+
+import (
+	"github.com/portworx/torpedo/drivers/node"
+)
+
+const (
+	// Name is the name the IPMI power driver is registered under.
+	Name = "ipmi"
+	// DefaultInterface is the ipmitool interface used by default.
+	DefaultInterface = "lanplus"
+)
+
+// New returns a power driver for physical nodes with an IPMI BMC.  It
+// controls the chassis power with ipmitool from the host Torpedo runs on.
+//
+// The driver is configured with the power options:
+//
+//	address    address of the BMC of a node, required
+//	user       BMC user
+//	password   BMC password
+//	interface  ipmitool interface, defaults to DefaultInterface
+//
+// The address is usually set in the power settings of each node.
+func New() node.Power {
+	return newPower()
+}
+
+func init() {
+	node.RegisterPower(Name, New())
+}
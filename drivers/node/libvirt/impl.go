@@ -0,0 +1,89 @@
+package libvirt
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/portworx/torpedo/config"
+	"github.com/portworx/torpedo/drivers/node"
+)
+
+type power struct {
+	config *config.Config
+}
+
+func newPower() *power {
+	return &power{}
+}
+
+func (p *power) String() string {
+	return Name
+}
+
+func (p *power) Init(cfg *config.Config) error {
+	if _, err := exec.LookPath("virsh"); err != nil {
+		return fmt.Errorf("the libvirt power driver needs virsh: %v", err)
+	}
+	p.config = cfg
+	return nil
+}
+
+// PowerOff destroys the domain, which pulls its plug.
+func (p *power) PowerOff(n node.Node) error {
+	_, err := p.virsh(n, "destroy")
+	return err
+}
+
+func (p *power) PowerOn(n node.Node) error {
+	_, err := p.virsh(n, "start")
+	return err
+}
+
+func (p *power) CanPowerOn() bool {
+	return true
+}
+
+// Reboot resets the domain, like pressing its reset button.
+func (p *power) Reboot(n node.Node) error {
+	_, err := p.virsh(n, "reset")
+	return err
+}
+
+func (p *power) IsUp(n node.Node) (bool, error) {
+	state, err := p.virsh(n, "domstate")
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(state) == "running", nil
+}
+
+// virsh runs a virsh command on the domain of a node and returns its output.
+func (p *power) virsh(n node.Node, command string) (string, error) {
+	opts := p.config.PowerOptions(n.MgmtIP)
+	uri := opts["uri"]
+	if uri == "" {
+		uri = DefaultURI
+	}
+	domain := opts["domain"]
+	if domain == "" {
+		domain = n.Hostname
+	}
+
+	cmd := exec.Command("virsh", "--connect", uri, command, domain)
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf(
+			"virsh %v %v for %v failed: %v: %v",
+			command,
+			domain,
+			n.MgmtIP,
+			err,
+			strings.TrimSpace(stderr.String()),
+		)
+	}
+	return string(output), nil
+}
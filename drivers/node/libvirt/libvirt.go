@@ -0,0 +1,30 @@
+package libvirt
+
+import (
+	"github.com/portworx/torpedo/drivers/node"
+)
+
+const (
+	// Name is the name the libvirt power driver is registered under.
+	Name = "libvirt"
+	// DefaultURI is the libvirt connection URI used by default.
+	DefaultURI = "qemu:///system"
+)
+
+// New returns a power driver for nodes that are libvirt domains, such as
+// QEMU/KVM virtual machines.  It controls the domains with virsh, on the
+// host Torpedo runs on or through a remote connection URI.
+//
+// The driver is configured with the power options:
+//
+//	uri     libvirt connection URI, defaults to DefaultURI
+//	domain  name of the domain of a node, defaults to the node hostname
+//
+// The domain is usually set in the power settings of each node.
+func New() node.Power {
+	return newPower()
+}
+
+func init() {
+	node.RegisterPower(Name, New())
+}
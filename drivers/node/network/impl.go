@@ -0,0 +1,206 @@
+package network
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/portworx/torpedo/config"
+	"github.com/portworx/torpedo/drivers/node"
+)
+
+// The chains the faults are kept in, and the built-in chain each is hooked
+// into.
+var chains = []struct {
+	name    string
+	builtin string
+}{
+	{ChainPrefix + "-INPUT", "INPUT"},
+	{ChainPrefix + "-OUTPUT", "OUTPUT"},
+	{ChainPrefix + "-FORWARD", "FORWARD"},
+}
+
+type fault struct {
+	config *config.Config
+}
+
+func newFault(cfg *config.Config) *fault {
+	return &fault{config: cfg}
+}
+
+func (f *fault) Isolate(n node.Node) error {
+	// Isolating the node Torpedo runs on would cut Torpedo off from the
+	// rest of the cluster, and from the node it has to heal.
+	if n.Local {
+		return fmt.Errorf("cannot isolate %v, the node Torpedo runs on", n.MgmtIP)
+	}
+
+	// Accept the control channel before dropping anything, so that the
+	// SSH session that sets up the rules is not cut off.  Over SSH, the
+	// node Torpedo runs on is the client of the session, and only its SSH
+	// traffic is accepted: the rest of its traffic, such as the traffic of
+	// the scheduler or the volume driver, is dropped like any other.
+	sshPort := strconv.Itoa(f.config.Lookup(n.MgmtIP).SSH.Port)
+	rules := []string{
+		"iptables -A " + ChainPrefix + "-INPUT -i lo -j ACCEPT",
+		"iptables -A " + ChainPrefix + "-OUTPUT -o lo -j ACCEPT",
+		`if [ -n "$SSH_CLIENT" ]; then ` +
+			"iptables -A " + ChainPrefix + `-INPUT -s "${SSH_CLIENT%% *}" -p tcp --dport ` + sshPort + " -j ACCEPT && " +
+			"iptables -A " + ChainPrefix + `-OUTPUT -d "${SSH_CLIENT%% *}" -p tcp --sport ` + sshPort + " -j ACCEPT; fi",
+		"iptables -A " + ChainPrefix + "-INPUT -j DROP",
+		"iptables -A " + ChainPrefix + "-OUTPUT -j DROP",
+		"iptables -A " + ChainPrefix + "-FORWARD -j DROP",
+	}
+
+	log.Printf("Isolating %v from the network\n", n.MgmtIP)
+	return f.apply(n, rules)
+}
+
+func (f *fault) Partition(a, b []node.Node, ports []string) error {
+	parsed, err := parsePorts(ports)
+	if err != nil {
+		return err
+	}
+	for _, n := range a {
+		for _, other := range b {
+			if n.ID == other.ID {
+				return fmt.Errorf("%v is on both sides of the partition", n.MgmtIP)
+			}
+		}
+	}
+
+	for _, side := range []struct{ nodes, peers []node.Node }{{a, b}, {b, a}} {
+		for _, n := range side.nodes {
+			var rules []string
+			for _, peer := range side.peers {
+				for _, address := range addresses(peer) {
+					rules = append(rules, dropRules(address, parsed)...)
+				}
+			}
+
+			log.Printf(
+				"Partitioning %v from %v on the storage ports %v\n",
+				n.MgmtIP,
+				mgmtIPs(side.peers),
+				strings.Join(ports, ", "),
+			)
+			if err := f.apply(n, rules); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (f *fault) Heal(n node.Node) error {
+	log.Printf("Healing the network of %v\n", n.MgmtIP)
+	_, err := node.NewExecutor(f.config, n).RunCommand(strings.Join(removeChains(), "; "))
+	return err
+}
+
+// apply replaces the faults on a node with the given rules, and hooks them
+// into the built-in chains.  The rules are set up by a single command, so
+// that a node is never left half isolated by a lost SSH session.
+func (f *fault) apply(n node.Node, rules []string) error {
+	commands := removeChains()
+	for _, chain := range chains {
+		commands = append(commands, "iptables -N "+chain.name)
+	}
+	commands = append(commands, rules...)
+	for _, chain := range chains {
+		commands = append(commands, "iptables -I "+chain.builtin+" 1 -j "+chain.name)
+	}
+
+	executor := node.NewExecutor(f.config, n)
+	if _, err := executor.RunCommand(strings.Join(commands, " && ")); err != nil {
+		return fmt.Errorf("could not set up the network faults on %v: %v", n.MgmtIP, err)
+	}
+	return nil
+}
+
+// removeChains returns the commands that unhook and remove the chains of
+// the faults, if any.  They always succeed, so that they can be chained.
+func removeChains() []string {
+	var commands []string
+	for _, chain := range chains {
+		commands = append(commands, fmt.Sprintf(
+			"{ while iptables -D %v -j %v 2>/dev/null; do :; done; "+
+				"iptables -F %v 2>/dev/null; iptables -X %v 2>/dev/null; true; }",
+			chain.builtin,
+			chain.name,
+			chain.name,
+			chain.name,
+		))
+	}
+	return commands
+}
+
+// port is a port or a range of ports of a protocol.
+type port struct {
+	protocol string
+	// ports is a port, or a range in iptables syntax, such as 9001:9022.
+	ports string
+}
+
+// parsePorts parses ports such as 9001-9022 or 9002/udp.
+func parsePorts(specs []string) ([]port, error) {
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("no storage ports to partition")
+	}
+
+	var ports []port
+	for _, spec := range specs {
+		p := port{protocol: "tcp", ports: spec}
+		if i := strings.Index(spec, "/"); i >= 0 {
+			p.ports, p.protocol = spec[:i], spec[i+1:]
+		}
+		if p.protocol != "tcp" && p.protocol != "udp" {
+			return nil, fmt.Errorf("invalid protocol in storage port %v", spec)
+		}
+
+		bounds := strings.SplitN(p.ports, "-", 2)
+		for _, bound := range bounds {
+			if n, err := strconv.Atoi(bound); err != nil || n <= 0 || n > 65535 {
+				return nil, fmt.Errorf("invalid storage port %v", spec)
+			}
+		}
+		p.ports = strings.Join(bounds, ":")
+		ports = append(ports, p)
+	}
+	return ports, nil
+}
+
+// dropRules returns the rules that drop the traffic on the ports between a
+// node and a peer address: connections from the peer to the ports of the
+// node, and from the node to the ports of the peer.
+func dropRules(address string, ports []port) []string {
+	var rules []string
+	for _, p := range ports {
+		for _, rule := range []string{
+			"-INPUT -s %v -p %v --dport %v -j DROP",
+			"-INPUT -s %v -p %v --sport %v -j DROP",
+			"-OUTPUT -d %v -p %v --dport %v -j DROP",
+			"-OUTPUT -d %v -p %v --sport %v -j DROP",
+		} {
+			rules = append(rules, "iptables -A "+ChainPrefix+fmt.Sprintf(rule, address, p.protocol, p.ports))
+		}
+	}
+	return rules
+}
+
+// addresses returns the management and data addresses of a node.
+func addresses(n node.Node) []string {
+	if n.DataIP == "" || n.DataIP == n.MgmtIP {
+		return []string{n.MgmtIP}
+	}
+	return []string{n.MgmtIP, n.DataIP}
+}
+
+func mgmtIPs(nodes []node.Node) []string {
+	ips := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		ips = append(ips, n.MgmtIP)
+	}
+	return ips
+}
@@ -0,0 +1,66 @@
+package network
+
+import (
+	"strconv"
+
+	"github.com/portworx/torpedo/config"
+	"github.com/portworx/torpedo/drivers/node"
+)
+
+const (
+	// ChainPrefix is the prefix of the iptables chains that hold the
+	// network faults.  Removing the chains heals a node.
+	ChainPrefix = "TORPEDO"
+)
+
+var (
+	// DefaultPorts are the storage ports of the volume drivers, by volume
+	// driver name.  They are used when the volume ports are not set in the
+	// cluster configuration.
+	DefaultPorts = map[string][]string{
+		"pxd": {"9001-9022", "9002/udp"},
+	}
+)
+
+// Fault injects network faults on the nodes.  The faults are iptables
+// rules, which are set up over the node executors.  The SSH session between
+// a node and the node Torpedo runs on, which is the control channel, is
+// never dropped, so that the node can still be reached to heal it.  Only
+// IPv4 traffic is dropped.
+type Fault interface {
+	// Isolate drops all the traffic of a node, except on its loopback
+	// interface and on the control channel.  The node is isolated from the
+	// node Torpedo runs on too, except for SSH.  The node Torpedo runs on
+	// cannot be isolated.
+	Isolate(n node.Node) error
+
+	// Partition drops the traffic on the storage ports between the nodes
+	// of two sets, in both directions.  The other traffic, such as the
+	// traffic of the scheduler, keeps flowing.  Ports are given as in
+	// StoragePorts.
+	Partition(a, b []node.Node, ports []string) error
+
+	// Heal removes all the network faults from a node.
+	Heal(n node.Node) error
+}
+
+// New returns a network fault injector for the nodes in the cluster
+// configuration.
+func New(cfg *config.Config) Fault {
+	return newFault(cfg)
+}
+
+// StoragePorts returns the storage ports of a volume driver: the volume
+// ports of the cluster configuration, or else the default ports of the
+// driver, or else the volume port.  A port is a number or a range such as
+// 9001-9022, optionally followed by /tcp or /udp.  Ports are TCP by
+// default.
+func StoragePorts(cfg *config.Config, volumeDriver string) []string {
+	if len(cfg.Volume.Ports) > 0 {
+		return cfg.Volume.Ports
+	}
+	if ports, ok := DefaultPorts[volumeDriver]; ok {
+		return ports
+	}
+	return []string{strconv.Itoa(cfg.Volume.Port)}
+}
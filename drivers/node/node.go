@@ -0,0 +1,199 @@
+package node
+
+import (
+	"errors"
+	"net"
+
+	"github.com/portworx/torpedo/config"
+)
+
+const (
+	// LabelStorage is set to "true" on nodes that are part of the storage
+	// cluster.
+	LabelStorage = "torpedo/storage"
+	// LabelScheduler is set to "true" on nodes that run scheduler tasks.
+	LabelScheduler = "torpedo/scheduler"
+)
+
+// Node is a node in the cluster that the scheduler and volume drivers
+// operate on.
+type Node struct {
+	// ID uniquely identifies the node.
+	ID string
+	// Hostname of the node.
+	Hostname string
+	// MgmtIP is the IP address of the node on the management network.
+	MgmtIP string
+	// DataIP is the IP address of the node on the data network.
+	DataIP string
+	// Labels are arbitrary key value pairs that describe the node.
+	Labels map[string]string
+	// Local is true if this is the node Torpedo runs on.
+	Local bool
+}
+
+// Power powers nodes off and on, to simulate a node that crashes or loses
+// power.  The power drivers are configured with the power section of the
+// cluster configuration, and with the power settings of each node.
+type Power interface {
+	// String returns the name of the power driver.
+	String() string
+
+	// Init initializes the power driver with the cluster configuration.
+	Init(*config.Config) error
+
+	// PowerOff abruptly powers a node off, without shutting it down.
+	PowerOff(n Node) error
+
+	// PowerOn powers a node on.
+	PowerOn(n Node) error
+
+	// CanPowerOn returns false if the driver cannot power a node back on
+	// once it is powered off, in which case PowerOn always fails.
+	CanPowerOn() bool
+
+	// Reboot abruptly resets a node.
+	Reboot(n Node) error
+
+	// IsUp returns true if the node is powered on.
+	IsUp(n Node) (bool, error)
+}
+
+// Executor runs commands on a node, so that its Docker daemon, volume
+// driver or network can be manipulated from the node Torpedo runs on.
+type Executor interface {
+	// RunCommand runs a shell command on the node and returns its
+	// standard output.  The error includes the standard error output.
+	RunCommand(command string) (string, error)
+
+	// StartService starts a systemd unit on the node.
+	StartService(unit string) error
+
+	// StopService stops a systemd unit on the node.
+	StopService(unit string) error
+
+	// ServiceStatus returns the state of a systemd unit on the node, such
+	// as active, inactive or failed.
+	ServiceStatus(unit string) (string, error)
+
+	// CopyFile copies a local file to a path on the node.
+	CopyFile(src, dst string) error
+
+	// IsReachable returns an error if commands cannot be run on the node.
+	IsReachable() error
+}
+
+var (
+	powerDrivers = make(map[string]Power)
+)
+
+// RegisterPower registers a power driver.
+func RegisterPower(name string, p Power) error {
+	powerDrivers[name] = p
+	return nil
+}
+
+// GetPower returns a registered power driver.
+func GetPower(name string) (Power, error) {
+	if p, ok := powerDrivers[name]; ok {
+		return p, nil
+	}
+	return nil, errors.New("No such power driver installed")
+}
+
+// NewExecutor returns an executor for a node.  Commands run directly on the
+// node Torpedo runs on, and over SSH with the SSH settings of the node in
+// the cluster configuration otherwise.
+func NewExecutor(cfg *config.Config, n Node) Executor {
+	if n.Local {
+		return NewLocalExecutor()
+	}
+	return NewSSHExecutor(cfg.Lookup(n.MgmtIP))
+}
+
+// NewLocalExecutor returns an executor for the node Torpedo runs on.
+func NewLocalExecutor() Executor {
+	return newLocalExecutor()
+}
+
+// NewSSHExecutor returns an executor that runs commands on a node over
+// SSH.  It uses the ssh and scp commands, with the user, port and key file
+// of the node.
+func NewSSHExecutor(cfgNode config.Node) Executor {
+	return newSSHExecutor(cfgNode)
+}
+
+// FromConfig returns the nodes described by the cluster configuration.
+func FromConfig(cfg *config.Config) ([]Node, error) {
+	localIPs, err := localAddresses()
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make([]Node, 0, len(cfg.Nodes))
+	for _, n := range cfg.Nodes {
+		labels := make(map[string]string)
+		for k, v := range n.Labels {
+			labels[k] = v
+		}
+		if n.HasRole(config.RoleStorage) {
+			labels[LabelStorage] = "true"
+		}
+		if n.HasRole(config.RoleScheduler) {
+			labels[LabelScheduler] = "true"
+		}
+
+		nodes = append(nodes, Node{
+			ID:       n.ID,
+			Hostname: n.Hostname,
+			MgmtIP:   n.Address,
+			DataIP:   n.DataAddress,
+			Labels:   labels,
+			Local:    localIPs[n.Address] || localIPs[n.DataAddress],
+		})
+	}
+	return nodes, nil
+}
+
+// IsStorage returns true if the node is part of the storage cluster.
+func (n Node) IsStorage() bool {
+	return n.Labels[LabelStorage] == "true"
+}
+
+// IsScheduler returns true if the node runs scheduler tasks.
+func (n Node) IsScheduler() bool {
+	return n.Labels[LabelScheduler] == "true"
+}
+
+// localAddresses returns the set of addresses of this host.
+func localAddresses() (map[string]bool, error) {
+	addresses := map[string]bool{"localhost": true}
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 {
+			continue // interface down
+		}
+
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			var ip net.IP
+			switch v := addr.(type) {
+			case *net.IPNet:
+				ip = v.IP
+			case *net.IPAddr:
+				ip = v.IP
+			}
+			if ip != nil {
+				addresses[ip.String()] = true
+			}
+		}
+	}
+	return addresses, nil
+}
@@ -0,0 +1,73 @@
+package ssh
+
+import (
+	"fmt"
+	"os/exec"
+
+	"github.com/portworx/torpedo/config"
+	"github.com/portworx/torpedo/drivers/node"
+)
+
+type power struct {
+	config *config.Config
+}
+
+func newPower() *power {
+	return &power{}
+}
+
+func (p *power) String() string {
+	return Name
+}
+
+func (p *power) Init(cfg *config.Config) error {
+	if _, err := exec.LookPath("ssh"); err != nil {
+		return fmt.Errorf("the SSH power driver needs ssh: %v", err)
+	}
+	p.config = cfg
+	return nil
+}
+
+func (p *power) PowerOff(n node.Node) error {
+	return p.runDown(n, "poweroff", DefaultPowerOff)
+}
+
+func (p *power) PowerOn(n node.Node) error {
+	return fmt.Errorf("the SSH power driver cannot power %v on, power it on by hand", n.MgmtIP)
+}
+
+// CanPowerOn returns false, a node has no SSH server once it is off.
+func (p *power) CanPowerOn() bool {
+	return false
+}
+
+func (p *power) Reboot(n node.Node) error {
+	return p.runDown(n, "reboot", DefaultReboot)
+}
+
+// IsUp returns true if the node accepts SSH logins.
+func (p *power) IsUp(n node.Node) (bool, error) {
+	return p.executor(n).IsReachable() == nil, nil
+}
+
+// runDown runs the command of a power option that takes the node down.  The
+// node may drop the SSH connection before the command returns, so an error
+// only counts if the node is still up.
+func (p *power) runDown(n node.Node, option, def string) error {
+	command := p.config.PowerOptions(n.MgmtIP)[option]
+	if command == "" {
+		command = def
+	}
+
+	executor := p.executor(n)
+	if _, err := executor.RunCommand(command); err != nil && executor.IsReachable() == nil {
+		return err
+	}
+	return nil
+}
+
+// executor returns an SSH executor for a node, even for the node Torpedo
+// runs on, since the commands take the node down.
+func (p *power) executor(n node.Node) node.Executor {
+	return node.NewSSHExecutor(p.config.Lookup(n.MgmtIP))
+}
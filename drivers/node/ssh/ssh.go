@@ -0,0 +1,33 @@
+package ssh
+
+import (
+	"github.com/portworx/torpedo/drivers/node"
+)
+
+const (
+	// Name is the name the SSH power driver is registered under.
+	Name = "ssh"
+	// DefaultPowerOff is the command that powers a node off.  Given twice,
+	// --force makes the kernel power off right away, without stopping
+	// services or unmounting filesystems.
+	DefaultPowerOff = "poweroff -f -f"
+	// DefaultReboot is the command that resets a node.
+	DefaultReboot = "reboot -f -f"
+)
+
+// New returns a power driver that powers nodes off and reboots them by
+// running a command over SSH, with the SSH settings of each node.  It
+// cannot power a node back on, as CanPowerOn reports, so it is best used
+// with nodes that are rebooted.
+//
+// The driver is configured with the power options:
+//
+//	poweroff  command that powers a node off, defaults to DefaultPowerOff
+//	reboot    command that resets a node, defaults to DefaultReboot
+func New() node.Power {
+	return newPower()
+}
+
+func init() {
+	node.RegisterPower(Name, New())
+}
@@ -0,0 +1,105 @@
+package fake
+
+import (
+	"github.com/portworx/torpedo/drivers/node"
+	"github.com/portworx/torpedo/drivers/scheduler"
+)
+
+// Op identifies a scheduler operation that a failure can be injected into.
+type Op int
+
+const (
+	// OpCreate is scheduler.Driver.Create.
+	OpCreate Op = iota
+	// OpSchedule is scheduler.Driver.Schedule and the start of
+	// scheduler.Driver.Run.
+	OpSchedule
+	// OpWaitDone is scheduler.Driver.WaitDone and the wait of
+	// scheduler.Driver.Run.
+	OpWaitDone
+	// OpDestroy is scheduler.Driver.Destroy and
+	// scheduler.Driver.DestroyByName.
+	OpDestroy
+	// OpInspectVolume is scheduler.Driver.InspectVolume.
+	OpInspectVolume
+	// OpDeleteVolume is scheduler.Driver.DeleteVolume.
+	OpDeleteVolume
+)
+
+// State is the lifecycle state of a task.
+type State int
+
+const (
+	// Created tasks have not been started yet.
+	Created State = iota
+	// Running tasks have been started and have not exited.
+	Running
+	// Exited tasks have run to completion or have died.
+	Exited
+)
+
+// Name is the name the fake scheduler is registered under.
+const Name = "fake"
+
+// Driver is an in-memory scheduler driver.  Tasks do not run anything, they
+// exit as soon as they are waited on with the exit status and output set
+// with SetExit.  Failures can be injected to simulate a misbehaving
+// scheduler or cluster.
+type Driver interface {
+	scheduler.Driver
+
+	// SetExit sets the exit status and output of the named task.  Tasks
+	// exit with status 0 and no output by default.
+	SetExit(name string, status int, stdout, stderr string)
+
+	// Kill makes a running task exit right away with the given status,
+	// as if the container died.
+	Kill(name string, status int) error
+
+	// SetNodeUp marks a node as up or down.  Tasks running on a node that
+	// goes down die, and new tasks cannot be created on it.
+	SetNodeUp(id string, up bool) error
+
+	// FailNext makes the next call of op fail with err.
+	FailNext(op Op, err error)
+
+	// TaskState returns the state of the named task.
+	TaskState(name string) (State, error)
+
+	// UseVolumeDriver makes the scheduler manage task volumes with v,
+	// instead of the VolumeDriver registered under the volume driver name
+	// of each task.
+	UseVolumeDriver(v VolumeDriver)
+}
+
+// VolumeDriver is implemented by volume drivers that the fake scheduler
+// manages task volumes with, such as the fake volume driver.  Volumes of
+// tasks that use any other volume driver are only tracked in memory.  The
+// volume driver owns the state of its volumes, which can be deleted behind
+// the back of the scheduler, such as by CleanupVolume.
+type VolumeDriver interface {
+	// Create creates a volume when a task that uses it is created.  It
+	// must succeed if the volume already exists.
+	Create(n node.Node, name string) error
+	// Exists returns true if the volume exists.
+	Exists(name string) bool
+	// Mount mounts a volume when a task that uses it is started.
+	Mount(n node.Node, name string) error
+	// Unmount unmounts a volume when a task that uses it exits, or is
+	// destroyed while it runs.  A task whose volume cannot be unmounted
+	// when it exits is considered to have hit I/O errors, and exits with
+	// scheduler.IOErrorStatus.
+	Unmount(n node.Node, name string) error
+	// Delete deletes a volume.
+	Delete(n node.Node, name string) error
+}
+
+// New returns a new fake scheduler driver.  It must be initialized with
+// Init before use.
+func New() Driver {
+	return newDriver()
+}
+
+func init() {
+	scheduler.Register(Name, New())
+}
@@ -0,0 +1,111 @@
+package fake_test
+
+import (
+	"testing"
+
+	"github.com/portworx/torpedo/config"
+	"github.com/portworx/torpedo/drivers/scheduler"
+	"github.com/portworx/torpedo/drivers/scheduler/fake"
+	"github.com/portworx/torpedo/drivers/volume/csi"
+	"github.com/portworx/torpedo/drivers/volume/dvdi"
+	fakevolume "github.com/portworx/torpedo/drivers/volume/fake"
+	"github.com/portworx/torpedo/drivers/volume/osd"
+)
+
+const spec = "size=10G,name=vol"
+
+// The volume drivers the fake scheduler manages task volumes with, when
+// they are the volume driver of a run.
+var (
+	_ fake.VolumeDriver = csi.Driver(nil)
+	_ fake.VolumeDriver = dvdi.Driver(nil)
+	_ fake.VolumeDriver = fakevolume.Driver(nil)
+	_ fake.VolumeDriver = osd.Driver(nil)
+)
+
+func newTestDriver(t *testing.T) (fake.Driver, fakevolume.Driver, scheduler.Task) {
+	cfg := config.FromAddresses([]string{"192.0.2.1", "192.0.2.2"})
+	d := fake.New()
+	if err := d.Init(cfg); err != nil {
+		t.Fatal(err)
+	}
+	v := fakevolume.New()
+	if err := v.Init(cfg); err != nil {
+		t.Fatal(err)
+	}
+	d.UseVolumeDriver(v)
+
+	nodes, err := d.GetNodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d, v, scheduler.Task{
+		Name: "testTask",
+		Img:  "busybox",
+		Tag:  "latest",
+		Node: nodes[0],
+		Vol: scheduler.Volume{
+			Driver: v.String(),
+			Name:   spec,
+			Path:   "/mnt",
+		},
+	}
+}
+
+func TestDestroyUnmountsRunningTasks(t *testing.T) {
+	for _, byName := range []bool{false, true} {
+		d, v, task := newTestDriver(t)
+		ctx, err := d.Create(task)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Schedule(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if byName {
+			err = d.DestroyByName(task.Node, task.Name)
+		} else {
+			err = d.Destroy(ctx)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		vol, err := v.Inspect(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if vol.Mounts[task.Node.ID] != 0 {
+			t.Errorf("expected the volume to be unmounted, got %v mounts", vol.Mounts[task.Node.ID])
+		}
+	}
+}
+
+func TestDestroyWhileTheVolumeDriverIsDown(t *testing.T) {
+	d, v, task := newTestDriver(t)
+	ctx, err := d.Create(task)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Schedule(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.StopDriver(task.Node); err != nil {
+		t.Fatal(err)
+	}
+
+	// The task is removed, and the lost unmount is replayed once the
+	// volume driver is back.
+	if err := d.Destroy(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.TaskState(task.Name); err == nil {
+		t.Errorf("expected the task to be removed")
+	}
+	if err := v.StartDriver(task.Node); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Delete(task.Node, spec); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,454 @@
+package fake
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+
+	"github.com/portworx/torpedo/config"
+	"github.com/portworx/torpedo/drivers/node"
+	"github.com/portworx/torpedo/drivers/scheduler"
+	"github.com/portworx/torpedo/drivers/volume"
+)
+
+const (
+	// killedStatus is the exit status of a task whose node went down.
+	killedStatus = 137
+)
+
+type task struct {
+	ctx    scheduler.Context
+	state  State
+	status int
+	stdout string
+	stderr string
+}
+
+type exit struct {
+	status int
+	stdout string
+	stderr string
+}
+
+type driver struct {
+	sync.Mutex
+	nodes    []node.Node
+	down     map[string]bool
+	tasks    map[string]*task
+	volumes  map[string]*scheduler.Volume
+	exits    map[string]exit
+	failures map[Op]error
+	lastID   int
+	// volumeDriver manages the task volumes if set.
+	volumeDriver VolumeDriver
+}
+
+func newDriver() *driver {
+	return &driver{
+		down:     make(map[string]bool),
+		tasks:    make(map[string]*task),
+		volumes:  make(map[string]*scheduler.Volume),
+		exits:    make(map[string]exit),
+		failures: make(map[Op]error),
+	}
+}
+
+func (d *driver) Init(cfg *config.Config) error {
+	nodes, err := node.FromConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	d.Lock()
+	defer d.Unlock()
+	d.nodes = nodes
+	return nil
+}
+
+func (d *driver) GetNodes() ([]node.Node, error) {
+	d.Lock()
+	defer d.Unlock()
+	nodes := make([]node.Node, len(d.nodes))
+	copy(nodes, d.nodes)
+	return nodes, nil
+}
+
+func (d *driver) Create(t scheduler.Task) (*scheduler.Context, error) {
+	d.Lock()
+	defer d.Unlock()
+	if err := d.injected(OpCreate); err != nil {
+		return nil, err
+	}
+
+	n, err := d.place(t)
+	if err != nil {
+		return nil, err
+	}
+	t.Node = n
+	t.Placement = scheduler.LocalHost
+
+	for _, tk := range d.tasks {
+		if tk.ctx.Task.Name == t.Name && tk.ctx.Task.Node.ID == n.ID {
+			return nil, fmt.Errorf("task %v already exists on %v", t.Name, n.ID)
+		}
+	}
+
+	if name := volume.ParseName(t.Vol.Name); name != "" {
+		// The volume may have been deleted by its volume driver since the
+		// last task that used it, so it is created for every task.
+		if v := d.managedBy(t.Vol); v != nil {
+			if err := v.Create(n, t.Vol.Name); err != nil {
+				return nil, err
+			}
+		}
+		if _, ok := d.volumes[name]; !ok {
+			vol := t.Vol
+			d.volumes[name] = &vol
+		}
+	}
+
+	d.lastID++
+	tk := &task{
+		ctx: scheduler.Context{
+			ID:   strconv.Itoa(d.lastID),
+			Task: t,
+		},
+		state: Created,
+	}
+	d.tasks[tk.ctx.ID] = tk
+
+	ctx := tk.ctx
+	return &ctx, nil
+}
+
+func (d *driver) Schedule(ctx *scheduler.Context) error {
+	d.Lock()
+	defer d.Unlock()
+	return d.schedule(ctx)
+}
+
+func (d *driver) WaitDone(ctx *scheduler.Context) error {
+	d.Lock()
+	defer d.Unlock()
+	return d.waitDone(ctx)
+}
+
+func (d *driver) Run(ctx *scheduler.Context) error {
+	d.Lock()
+	defer d.Unlock()
+	if err := d.schedule(ctx); err != nil {
+		return err
+	}
+	return d.waitDone(ctx)
+}
+
+func (d *driver) Destroy(ctx *scheduler.Context) error {
+	d.Lock()
+	defer d.Unlock()
+	if err := d.injected(OpDestroy); err != nil {
+		return err
+	}
+
+	if _, ok := d.tasks[ctx.ID]; !ok {
+		return fmt.Errorf("no such task %v", ctx.ID)
+	}
+	d.remove(ctx.ID)
+	return nil
+}
+
+func (d *driver) DestroyByName(n node.Node, name string) error {
+	d.Lock()
+	defer d.Unlock()
+	if err := d.injected(OpDestroy); err != nil {
+		return err
+	}
+
+	for id, tk := range d.tasks {
+		if tk.ctx.Task.Name == name && tk.ctx.Task.Node.ID == n.ID {
+			d.remove(id)
+		}
+	}
+	return nil
+}
+
+func (d *driver) InspectVolume(n node.Node, name string) (*scheduler.Volume, error) {
+	d.Lock()
+	defer d.Unlock()
+	if err := d.injected(OpInspectVolume); err != nil {
+		return nil, err
+	}
+	if err := d.checkNode(n.ID); err != nil {
+		return nil, err
+	}
+
+	vol, err := d.getVolume(name)
+	if err != nil {
+		return nil, err
+	}
+	v := *vol
+	return &v, nil
+}
+
+func (d *driver) DeleteVolume(n node.Node, name string) error {
+	d.Lock()
+	defer d.Unlock()
+	if err := d.injected(OpDeleteVolume); err != nil {
+		return err
+	}
+	if err := d.checkNode(n.ID); err != nil {
+		return err
+	}
+
+	name = volume.ParseName(name)
+	vol, err := d.getVolume(name)
+	if err != nil {
+		return err
+	}
+	for _, tk := range d.tasks {
+		if volume.ParseName(tk.ctx.Task.Vol.Name) == name && tk.ctx.Task.Node.ID == n.ID {
+			return fmt.Errorf("volume %v is in use by task %v", name, tk.ctx.Task.Name)
+		}
+	}
+	if v := d.managedBy(*vol); v != nil {
+		if err := v.Delete(n, name); err != nil {
+			return err
+		}
+	}
+	delete(d.volumes, name)
+	return nil
+}
+
+func (d *driver) SetExit(name string, status int, stdout, stderr string) {
+	d.Lock()
+	defer d.Unlock()
+	d.exits[name] = exit{status: status, stdout: stdout, stderr: stderr}
+}
+
+func (d *driver) Kill(name string, status int) error {
+	d.Lock()
+	defer d.Unlock()
+	for _, tk := range d.tasks {
+		if tk.ctx.Task.Name == name && tk.state == Running {
+			tk.state = Exited
+			tk.status = status
+			if err := d.unmount(tk); err != nil {
+				tk.stderr += err.Error() + "\n"
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("task %v is not running", name)
+}
+
+func (d *driver) SetNodeUp(id string, up bool) error {
+	d.Lock()
+	defer d.Unlock()
+	if _, err := d.getNode(id); err != nil {
+		return err
+	}
+
+	if up {
+		delete(d.down, id)
+		return nil
+	}
+
+	d.down[id] = true
+	for _, tk := range d.tasks {
+		if tk.ctx.Task.Node.ID == id && tk.state == Running {
+			tk.state = Exited
+			tk.status = killedStatus
+		}
+	}
+	return nil
+}
+
+func (d *driver) FailNext(op Op, err error) {
+	d.Lock()
+	defer d.Unlock()
+	d.failures[op] = err
+}
+
+func (d *driver) TaskState(name string) (State, error) {
+	d.Lock()
+	defer d.Unlock()
+	for _, tk := range d.tasks {
+		if tk.ctx.Task.Name == name {
+			return tk.state, nil
+		}
+	}
+	return Created, fmt.Errorf("no such task %v", name)
+}
+
+func (d *driver) UseVolumeDriver(v VolumeDriver) {
+	d.Lock()
+	defer d.Unlock()
+	d.volumeDriver = v
+}
+
+func (d *driver) schedule(ctx *scheduler.Context) error {
+	if err := d.injected(OpSchedule); err != nil {
+		return err
+	}
+
+	tk, err := d.getTask(ctx)
+	if err != nil {
+		return err
+	}
+	if err := d.checkNode(tk.ctx.Task.Node.ID); err != nil {
+		return err
+	}
+	if tk.state != Created {
+		return fmt.Errorf("task %v has already been started", tk.ctx.Task.Name)
+	}
+
+	if v := d.managedBy(tk.ctx.Task.Vol); v != nil {
+		if err := v.Mount(tk.ctx.Task.Node, tk.ctx.Task.Vol.Name); err != nil {
+			return err
+		}
+	}
+
+	tk.state = Running
+	return nil
+}
+
+func (d *driver) waitDone(ctx *scheduler.Context) error {
+	if err := d.injected(OpWaitDone); err != nil {
+		return err
+	}
+
+	tk, err := d.getTask(ctx)
+	if err != nil {
+		return err
+	}
+	switch tk.state {
+	case Created:
+		return fmt.Errorf("task %v has not been started", tk.ctx.Task.Name)
+	case Running:
+		e := d.exits[tk.ctx.Task.Name]
+		tk.state = Exited
+		tk.status = e.status
+		tk.stdout = e.stdout
+		tk.stderr = e.stderr
+		if err := d.unmount(tk); err != nil && tk.status == 0 {
+			tk.status = scheduler.IOErrorStatus
+			tk.stderr += err.Error() + "\n"
+		}
+	}
+
+	ctx.Status = tk.status
+	ctx.Stdout = tk.stdout
+	ctx.Stderr = tk.stderr
+	return nil
+}
+
+// remove removes a task.  The volume of a running task is unmounted first.
+// The task is removed even if its volume cannot be unmounted, as Docker
+// removes a container whose volume driver is down, and the unmount is lost.
+func (d *driver) remove(id string) {
+	if tk := d.tasks[id]; tk.state == Running {
+		if err := d.unmount(tk); err != nil {
+			log.Printf("Removing task %v without unmounting its volume\n", tk.ctx.Task.Name)
+		}
+	}
+	delete(d.tasks, id)
+}
+
+// unmount unmounts the volume of a task that exited.
+func (d *driver) unmount(tk *task) error {
+	v := d.managedBy(tk.ctx.Task.Vol)
+	if v == nil {
+		return nil
+	}
+	if err := v.Unmount(tk.ctx.Task.Node, tk.ctx.Task.Vol.Name); err != nil {
+		log.Printf("Error while unmounting %v: %v\n", tk.ctx.Task.Vol.Name, err)
+		return err
+	}
+	return nil
+}
+
+// place returns the node a task runs on, based on its placement.
+func (d *driver) place(t scheduler.Task) (node.Node, error) {
+	if t.Placement != scheduler.ExternalHost {
+		if err := d.checkNode(t.Node.ID); err != nil {
+			return node.Node{}, err
+		}
+		return t.Node, nil
+	}
+
+	for _, n := range d.nodes {
+		if n.ID != t.Node.ID && !d.down[n.ID] {
+			return n, nil
+		}
+	}
+	return node.Node{}, fmt.Errorf("cannot find any other node in the cluster")
+}
+
+// injected returns and clears the failure injected into op.
+func (d *driver) injected(op Op) error {
+	err := d.failures[op]
+	delete(d.failures, op)
+	return err
+}
+
+func (d *driver) getTask(ctx *scheduler.Context) (*task, error) {
+	tk, ok := d.tasks[ctx.ID]
+	if !ok {
+		return nil, fmt.Errorf("no such task %v", ctx.ID)
+	}
+	return tk, nil
+}
+
+func (d *driver) getNode(id string) (node.Node, error) {
+	for _, n := range d.nodes {
+		if n.ID == id {
+			return n, nil
+		}
+	}
+	return node.Node{}, fmt.Errorf("no such node %v", id)
+}
+
+// checkNode returns an error if the node does not exist or is down.
+func (d *driver) checkNode(id string) error {
+	if _, err := d.getNode(id); err != nil {
+		return err
+	}
+	if d.down[id] {
+		return fmt.Errorf("node %v is down", id)
+	}
+	return nil
+}
+
+// getVolume returns a volume that tasks used.  A volume whose volume driver
+// deleted it is forgotten.
+func (d *driver) getVolume(name string) (*scheduler.Volume, error) {
+	name = volume.ParseName(name)
+	vol, ok := d.volumes[name]
+	if ok {
+		if v := d.managedBy(*vol); v != nil && !v.Exists(name) {
+			delete(d.volumes, name)
+			ok = false
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("no such volume %v", name)
+	}
+	return vol, nil
+}
+
+// managedBy returns the volume driver that manages the volume, or nil if
+// the volume driver is not a VolumeDriver.
+func (d *driver) managedBy(vol scheduler.Volume) VolumeDriver {
+	if vol.Name == "" {
+		return nil
+	}
+	if d.volumeDriver != nil {
+		return d.volumeDriver
+	}
+	registered, err := volume.Get(vol.Driver)
+	if err != nil {
+		return nil
+	}
+	v, _ := registered.(VolumeDriver)
+	return v
+}
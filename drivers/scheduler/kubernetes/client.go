@@ -0,0 +1,237 @@
+package kubernetes
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/portworx/torpedo/config"
+)
+
+const (
+	// defaultEndpoint is the API server endpoint if none is configured.
+	defaultEndpoint = "http://localhost:8080"
+	// defaultNamespace is the namespace Torpedo creates objects in.
+	defaultNamespace = "default"
+)
+
+// restClient talks to the Kubernetes API server over its REST API.
+type restClient struct {
+	endpoint  string
+	namespace string
+	token     string
+	client    *http.Client
+}
+
+// NewClient returns a client for the Kubernetes API server described by the
+// scheduler configuration.  The following options are supported: namespace,
+// token, tokenFile, caFile, certFile, keyFile and insecureSkipVerify.
+func NewClient(cfg config.Scheduler) (Client, error) {
+	c := &restClient{
+		endpoint:  strings.TrimSuffix(cfg.Endpoint, "/"),
+		namespace: cfg.Options["namespace"],
+		token:     cfg.Options["token"],
+	}
+	if c.endpoint == "" {
+		c.endpoint = defaultEndpoint
+	}
+	if c.namespace == "" {
+		c.namespace = defaultNamespace
+	}
+	if path := cfg.Options["tokenFile"]; path != "" {
+		token, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		c.token = strings.TrimSpace(string(token))
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: cfg.Options["insecureSkipVerify"] == "true",
+	}
+	if path := cfg.Options["caFile"]; path != "" {
+		ca, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in %v", path)
+		}
+	}
+	if cfg.Options["certFile"] != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.Options["certFile"], cfg.Options["keyFile"])
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	c.client = &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+	return c, nil
+}
+
+func (c *restClient) CreatePod(pod *Pod) (*Pod, error) {
+	pod.APIVersion, pod.Kind = "v1", "Pod"
+	out := &Pod{}
+	if err := c.do("POST", c.namespaced("pods"), pod, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *restClient) GetPod(name string) (*Pod, error) {
+	out := &Pod{}
+	if err := c.do("GET", c.namespaced("pods")+"/"+name, nil, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *restClient) ListPods(labels map[string]string) ([]Pod, error) {
+	selector := make([]string, 0, len(labels))
+	for k, v := range labels {
+		selector = append(selector, k+"="+v)
+	}
+	sort.Strings(selector)
+
+	query := url.Values{}
+	query.Set("labelSelector", strings.Join(selector, ","))
+	out := &PodList{}
+	if err := c.do("GET", c.namespaced("pods")+"?"+query.Encode(), nil, out); err != nil {
+		return nil, err
+	}
+	return out.Items, nil
+}
+
+func (c *restClient) DeletePod(name string) error {
+	return c.do("DELETE", c.namespaced("pods")+"/"+name, nil, nil)
+}
+
+func (c *restClient) GetPodLog(name string) (string, error) {
+	log := bytes.NewBuffer(nil)
+	if err := c.do("GET", c.namespaced("pods")+"/"+name+"/log", nil, log); err != nil {
+		return "", err
+	}
+	return log.String(), nil
+}
+
+func (c *restClient) CreatePersistentVolumeClaim(
+	pvc *PersistentVolumeClaim,
+) (*PersistentVolumeClaim, error) {
+	pvc.APIVersion, pvc.Kind = "v1", "PersistentVolumeClaim"
+	out := &PersistentVolumeClaim{}
+	if err := c.do("POST", c.namespaced("persistentvolumeclaims"), pvc, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *restClient) GetPersistentVolumeClaim(name string) (*PersistentVolumeClaim, error) {
+	out := &PersistentVolumeClaim{}
+	if err := c.do("GET", c.namespaced("persistentvolumeclaims")+"/"+name, nil, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *restClient) DeletePersistentVolumeClaim(name string) error {
+	return c.do("DELETE", c.namespaced("persistentvolumeclaims")+"/"+name, nil, nil)
+}
+
+func (c *restClient) CreateStorageClass(sc *StorageClass) (*StorageClass, error) {
+	sc.APIVersion, sc.Kind = "storage.k8s.io/v1", "StorageClass"
+	out := &StorageClass{}
+	if err := c.do("POST", "/apis/storage.k8s.io/v1/storageclasses", sc, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *restClient) GetStorageClass(name string) (*StorageClass, error) {
+	out := &StorageClass{}
+	if err := c.do("GET", "/apis/storage.k8s.io/v1/storageclasses/"+name, nil, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *restClient) DeleteStorageClass(name string) error {
+	return c.do("DELETE", "/apis/storage.k8s.io/v1/storageclasses/"+name, nil, nil)
+}
+
+func (c *restClient) GetPersistentVolume(name string) (*PersistentVolume, error) {
+	out := &PersistentVolume{}
+	if err := c.do("GET", "/api/v1/persistentvolumes/"+name, nil, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *restClient) DeletePersistentVolume(name string) error {
+	return c.do("DELETE", "/api/v1/persistentvolumes/"+name, nil, nil)
+}
+
+func (c *restClient) namespaced(resource string) string {
+	return "/api/v1/namespaces/" + c.namespace + "/" + resource
+}
+
+// do sends a request to the API server.  The response is decoded as JSON
+// into out, or copied as is if out is a buffer.
+func (c *restClient) do(method, path string, in, out interface{}) error {
+	body := bytes.NewBuffer(nil)
+	if in != nil {
+		if err := json.NewEncoder(body).Encode(in); err != nil {
+			return err
+		}
+	}
+
+	request, err := http.NewRequest(method, c.endpoint+path, body)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		request.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode >= http.StatusBadRequest {
+		status := StatusError{}
+		if err := json.Unmarshal(data, &status); err != nil || status.Message == "" {
+			status.Message = string(data)
+		}
+		status.Code = response.StatusCode
+		return &status
+	}
+
+	switch o := out.(type) {
+	case nil:
+		return nil
+	case *bytes.Buffer:
+		_, err := o.Write(data)
+		return err
+	default:
+		return json.Unmarshal(data, out)
+	}
+}
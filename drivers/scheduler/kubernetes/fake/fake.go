@@ -0,0 +1,22 @@
+package fake
+
+import (
+	"github.com/portworx/torpedo/drivers/scheduler/kubernetes"
+)
+
+// Client is an in-memory Kubernetes API.  Pods are scheduled on the first
+// node that satisfies their node affinity, and run to completion the next
+// time they are looked at after they were seen running.  PVCs are bound to
+// a new PV as soon as they are created.
+type Client interface {
+	kubernetes.Client
+
+	// SetExit sets the exit code and log of the named pod.  Pods exit
+	// with code 0 and an empty log by default.
+	SetExit(pod string, code int, log string)
+}
+
+// NewClient returns an in-memory Kubernetes API with the given node names.
+func NewClient(nodes ...string) Client {
+	return newClient(nodes)
+}
@@ -0,0 +1,338 @@
+package fake
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/portworx/torpedo/drivers/scheduler/kubernetes"
+)
+
+type exit struct {
+	code int
+	log  string
+}
+
+type client struct {
+	sync.Mutex
+	nodes   []string
+	pods    map[string]*kubernetes.Pod
+	exits   map[string]exit
+	claims  map[string]*kubernetes.PersistentVolumeClaim
+	classes map[string]*kubernetes.StorageClass
+	volumes map[string]*kubernetes.PersistentVolume
+}
+
+func newClient(nodes []string) *client {
+	return &client{
+		nodes:   nodes,
+		pods:    make(map[string]*kubernetes.Pod),
+		exits:   make(map[string]exit),
+		claims:  make(map[string]*kubernetes.PersistentVolumeClaim),
+		classes: make(map[string]*kubernetes.StorageClass),
+		volumes: make(map[string]*kubernetes.PersistentVolume),
+	}
+}
+
+func notFound(kind, name string) error {
+	return &kubernetes.StatusError{
+		Code:    404,
+		Message: fmt.Sprintf("%v %q not found", kind, name),
+	}
+}
+
+func conflict(kind, name string) error {
+	return &kubernetes.StatusError{
+		Code:    409,
+		Message: fmt.Sprintf("%v %q already exists", kind, name),
+	}
+}
+
+func (c *client) SetExit(pod string, code int, log string) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.exits[pod] = exit{code: code, log: log}
+}
+
+func (c *client) CreatePod(pod *kubernetes.Pod) (*kubernetes.Pod, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	name := pod.Metadata.Name
+	if _, ok := c.pods[name]; ok {
+		return nil, conflict("pods", name)
+	}
+	for _, v := range pod.Spec.Volumes {
+		if v.PersistentVolumeClaim == nil {
+			continue
+		}
+		if _, ok := c.claims[v.PersistentVolumeClaim.ClaimName]; !ok {
+			return nil, notFound("persistentvolumeclaims", v.PersistentVolumeClaim.ClaimName)
+		}
+	}
+
+	p := *pod
+	p.Spec.NodeName = c.place(pod)
+	if p.Spec.NodeName == "" {
+		p.Status.Phase = "Pending"
+	} else {
+		p.Status.Phase = kubernetes.PodRunning
+	}
+	c.pods[name] = &p
+
+	created := p
+	return &created, nil
+}
+
+// GetPod returns the pod.  A running pod terminates once it has been
+// observed running, so that the scheduler sees it both start and stop.
+func (c *client) GetPod(name string) (*kubernetes.Pod, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	p, ok := c.pods[name]
+	if !ok {
+		return nil, notFound("pods", name)
+	}
+
+	observed := *p
+	if p.Status.Phase == kubernetes.PodRunning {
+		code := c.exits[name].code
+		p.Status.Phase = kubernetes.PodSucceeded
+		if code != 0 {
+			p.Status.Phase = kubernetes.PodFailed
+		}
+		p.Status.ContainerStatuses = []kubernetes.ContainerStatus{
+			{
+				Name: p.Spec.Containers[0].Name,
+				State: kubernetes.ContainerState{
+					Terminated: &kubernetes.ContainerStateTerminated{
+						ExitCode: code,
+					},
+				},
+			},
+		}
+	}
+	return &observed, nil
+}
+
+func (c *client) ListPods(labels map[string]string) ([]kubernetes.Pod, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	pods := []kubernetes.Pod{}
+	for _, p := range c.pods {
+		matches := true
+		for k, v := range labels {
+			if p.Metadata.Labels[k] != v {
+				matches = false
+			}
+		}
+		if matches {
+			pods = append(pods, *p)
+		}
+	}
+	return pods, nil
+}
+
+func (c *client) DeletePod(name string) error {
+	c.Lock()
+	defer c.Unlock()
+
+	if _, ok := c.pods[name]; !ok {
+		return notFound("pods", name)
+	}
+	delete(c.pods, name)
+	return nil
+}
+
+func (c *client) GetPodLog(name string) (string, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if _, ok := c.pods[name]; !ok {
+		return "", notFound("pods", name)
+	}
+	return c.exits[name].log, nil
+}
+
+func (c *client) CreatePersistentVolumeClaim(
+	pvc *kubernetes.PersistentVolumeClaim,
+) (*kubernetes.PersistentVolumeClaim, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	name := pvc.Metadata.Name
+	if _, ok := c.claims[name]; ok {
+		return nil, conflict("persistentvolumeclaims", name)
+	}
+	if _, ok := c.classes[pvc.Spec.StorageClassName]; !ok {
+		return nil, notFound("storageclasses", pvc.Spec.StorageClassName)
+	}
+
+	pv := &kubernetes.PersistentVolume{
+		Metadata: kubernetes.ObjectMeta{Name: "pvc-" + name},
+		Spec: kubernetes.PersistentVolumeSpec{
+			Capacity:         pvc.Spec.Resources.Requests,
+			StorageClassName: pvc.Spec.StorageClassName,
+		},
+	}
+	c.volumes[pv.Metadata.Name] = pv
+
+	claim := *pvc
+	claim.Spec.VolumeName = pv.Metadata.Name
+	claim.Status.Phase = "Bound"
+	c.claims[name] = &claim
+
+	created := claim
+	return &created, nil
+}
+
+func (c *client) GetPersistentVolumeClaim(name string) (*kubernetes.PersistentVolumeClaim, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	pvc, ok := c.claims[name]
+	if !ok {
+		return nil, notFound("persistentvolumeclaims", name)
+	}
+	claim := *pvc
+	return &claim, nil
+}
+
+func (c *client) DeletePersistentVolumeClaim(name string) error {
+	c.Lock()
+	defer c.Unlock()
+
+	if _, ok := c.claims[name]; !ok {
+		return notFound("persistentvolumeclaims", name)
+	}
+	for _, p := range c.pods {
+		for _, v := range p.Spec.Volumes {
+			if v.PersistentVolumeClaim != nil &&
+				v.PersistentVolumeClaim.ClaimName == name {
+				return &kubernetes.StatusError{
+					Code:    409,
+					Message: fmt.Sprintf("persistentvolumeclaims %q is in use by pod %q", name, p.Metadata.Name),
+				}
+			}
+		}
+	}
+	delete(c.claims, name)
+	return nil
+}
+
+func (c *client) CreateStorageClass(sc *kubernetes.StorageClass) (*kubernetes.StorageClass, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	name := sc.Metadata.Name
+	if _, ok := c.classes[name]; ok {
+		return nil, conflict("storageclasses", name)
+	}
+	class := *sc
+	c.classes[name] = &class
+
+	created := class
+	return &created, nil
+}
+
+func (c *client) GetStorageClass(name string) (*kubernetes.StorageClass, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	sc, ok := c.classes[name]
+	if !ok {
+		return nil, notFound("storageclasses", name)
+	}
+	class := *sc
+	return &class, nil
+}
+
+func (c *client) DeleteStorageClass(name string) error {
+	c.Lock()
+	defer c.Unlock()
+
+	if _, ok := c.classes[name]; !ok {
+		return notFound("storageclasses", name)
+	}
+	delete(c.classes, name)
+	return nil
+}
+
+func (c *client) GetPersistentVolume(name string) (*kubernetes.PersistentVolume, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	pv, ok := c.volumes[name]
+	if !ok {
+		return nil, notFound("persistentvolumes", name)
+	}
+	vol := *pv
+	return &vol, nil
+}
+
+func (c *client) DeletePersistentVolume(name string) error {
+	c.Lock()
+	defer c.Unlock()
+
+	if _, ok := c.volumes[name]; !ok {
+		return notFound("persistentvolumes", name)
+	}
+	delete(c.volumes, name)
+	return nil
+}
+
+// place returns the first node that satisfies the node affinity of a pod,
+// or an empty string if there is none.
+func (c *client) place(pod *kubernetes.Pod) string {
+	for _, n := range c.nodes {
+		if matches(pod.Spec.Affinity, n) {
+			return n
+		}
+	}
+	return ""
+}
+
+func matches(affinity *kubernetes.Affinity, n string) bool {
+	if affinity == nil || affinity.NodeAffinity == nil ||
+		affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return true
+	}
+
+	terms := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	for _, term := range terms {
+		if matchesTerm(term, n) {
+			return true
+		}
+	}
+	return len(terms) == 0
+}
+
+func matchesTerm(term kubernetes.NodeSelectorTerm, n string) bool {
+	for _, expr := range term.MatchExpressions {
+		if expr.Key != kubernetes.HostnameLabel {
+			return false
+		}
+
+		found := false
+		for _, v := range expr.Values {
+			if v == n {
+				found = true
+			}
+		}
+		switch expr.Operator {
+		case "In":
+			if !found {
+				return false
+			}
+		case "NotIn":
+			if found {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,450 @@
+package kubernetes
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/portworx/torpedo/config"
+	"github.com/portworx/torpedo/drivers/node"
+	"github.com/portworx/torpedo/drivers/scheduler"
+	"github.com/portworx/torpedo/drivers/volume"
+)
+
+const (
+	// pollInterval is how often a pod is polled for state changes.
+	pollInterval = time.Second
+	// scheduleTimeout is how long to wait for a pod to be scheduled.
+	scheduleTimeout = 5 * time.Minute
+	// driverLabel records the torpedo volume driver of a storage class.
+	driverLabel = "torpedo/volume-driver"
+	// volumeName is the name of the task volume in a pod.
+	volumeName = "torpedo-vol"
+	// taskLabel holds the object name of the task of a pod.
+	taskLabel = "torpedo/task"
+)
+
+var (
+	// provisioners maps torpedo volume drivers to Kubernetes provisioners.
+	// Any other volume driver is used as the provisioner name as is, which
+	// is what CSI drivers and external provisioners register with.
+	provisioners = map[string]string{
+		"pxd": "kubernetes.io/portworx-volume",
+	}
+)
+
+type kubernetes struct {
+	sync.Mutex
+	client Client
+	nodes  []node.Node
+	// pods holds the pod of each task by context ID, which is the pod
+	// name.
+	pods map[string]*Pod
+	// created is the number of tasks created, which numbers the pod names.
+	created int
+}
+
+func newKubernetes(client Client) *kubernetes {
+	return &kubernetes{
+		client: client,
+		pods:   make(map[string]*Pod),
+	}
+}
+
+func (k *kubernetes) Init(cfg *config.Config) error {
+	nodes, err := node.FromConfig(cfg)
+	if err != nil {
+		return err
+	}
+	k.nodes = nodes
+
+	if k.client == nil {
+		if k.client, err = NewClient(cfg.Scheduler); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Using the Kubernetes scheduler.\n")
+	log.Printf("The following hosts are in the cluster: %v.\n", cfg.Addresses())
+	return nil
+}
+
+func (k *kubernetes) GetNodes() ([]node.Node, error) {
+	return k.nodes, nil
+}
+
+// Create creates the storage class and the PVC of the task volume.  The pod
+// is not created until the task is scheduled.  Each task gets its own pod,
+// so that a task can be created again while an earlier one still exists.
+func (k *kubernetes) Create(t scheduler.Task) (*scheduler.Context, error) {
+	k.Lock()
+	k.created++
+	name := objectName(t.Name) + "-" + strconv.Itoa(k.created)
+	k.Unlock()
+
+	pod := &Pod{
+		Metadata: ObjectMeta{
+			Name: name,
+			Labels: map[string]string{
+				"app":     "torpedo",
+				taskLabel: objectName(t.Name),
+			},
+		},
+		Spec: PodSpec{
+			RestartPolicy: "Never",
+			Containers: []Container{
+				{
+					Name:  objectName(t.Name),
+					Image: t.Img + ":" + t.Tag,
+					Args:  t.Cmd,
+				},
+			},
+			Affinity: affinity(t),
+		},
+	}
+	for _, env := range t.Env {
+		kv := strings.SplitN(env, "=", 2)
+		if len(kv) == 2 {
+			pod.Spec.Containers[0].Env = append(
+				pod.Spec.Containers[0].Env,
+				EnvVar{Name: kv[0], Value: kv[1]},
+			)
+		}
+	}
+
+	if t.Vol.Name != "" {
+		claim, err := k.createVolume(t.Vol)
+		if err != nil {
+			return nil, err
+		}
+		pod.Spec.Volumes = []Volume{
+			{
+				Name: volumeName,
+				PersistentVolumeClaim: &PersistentVolumeClaimSource{
+					ClaimName: claim,
+				},
+			},
+		}
+		pod.Spec.Containers[0].VolumeMounts = []VolumeMount{
+			{Name: volumeName, MountPath: t.Vol.Path},
+		}
+	}
+
+	k.Lock()
+	k.pods[pod.Metadata.Name] = pod
+	k.Unlock()
+	return &scheduler.Context{
+		ID:   pod.Metadata.Name,
+		Task: t,
+	}, nil
+}
+
+// Schedule creates the pod and waits for it to be scheduled on a node.  The
+// task in the context is then pinned to that node.
+func (k *kubernetes) Schedule(ctx *scheduler.Context) error {
+	k.Lock()
+	pod, ok := k.pods[ctx.ID]
+	k.Unlock()
+	if !ok {
+		return fmt.Errorf("task %v has not been created", ctx.Task.Name)
+	}
+
+	if _, err := k.client.CreatePod(pod); err != nil {
+		return err
+	}
+
+	for start := time.Now(); time.Since(start) < scheduleTimeout; time.Sleep(pollInterval) {
+		p, err := k.client.GetPod(ctx.ID)
+		if err != nil {
+			return err
+		}
+		if p.Spec.NodeName == "" {
+			continue
+		}
+		if p.Status.Phase != PodRunning && !terminated(p) {
+			continue
+		}
+
+		log.Printf("Pod %v is running on %v\n", ctx.ID, p.Spec.NodeName)
+		if n, err := k.lookup(p.Spec.NodeName); err == nil {
+			ctx.Task.Node = n
+			ctx.Task.Placement = scheduler.LocalHost
+		}
+		return nil
+	}
+
+	return fmt.Errorf("pod %v did not start in time", ctx.ID)
+}
+
+// WaitDone waits for the pod to terminate.  The pod log is the combined
+// stdout and stderr of the task, and is reported as its stdout.
+func (k *kubernetes) WaitDone(ctx *scheduler.Context) error {
+	for {
+		p, err := k.client.GetPod(ctx.ID)
+		if err != nil {
+			return err
+		}
+		if terminated(p) {
+			ctx.Status = exitCode(p)
+			break
+		}
+		time.Sleep(pollInterval)
+	}
+
+	log, err := k.client.GetPodLog(ctx.ID)
+	if err != nil {
+		return err
+	}
+	ctx.Stdout = log
+	return nil
+}
+
+// Run to completion.
+func (k *kubernetes) Run(ctx *scheduler.Context) error {
+	if err := k.Schedule(ctx); err != nil {
+		return err
+	}
+	return k.WaitDone(ctx)
+}
+
+func (k *kubernetes) Destroy(ctx *scheduler.Context) error {
+	if err := k.deletePod(ctx.ID); err != nil {
+		return err
+	}
+
+	log.Printf("Deleted task: %v\n", ctx.Task.Name)
+	return nil
+}
+
+// DestroyByName deletes the pods of every task with the given name.  Pods
+// are not bound to a node until they are scheduled, so the node is ignored.
+func (k *kubernetes) DestroyByName(n node.Node, name string) error {
+	pods, err := k.client.ListPods(map[string]string{taskLabel: objectName(name)})
+	if err != nil {
+		return err
+	}
+
+	for _, p := range pods {
+		if err := k.deletePod(p.Metadata.Name); err != nil {
+			if IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		log.Printf("Deleted task: %v (%v)\n", name, p.Metadata.Name)
+	}
+	return nil
+}
+
+// InspectVolume inspects the PV bound to the PVC of a volume.
+func (k *kubernetes) InspectVolume(n node.Node, name string) (*scheduler.Volume, error) {
+	pvc, err := k.client.GetPersistentVolumeClaim(claimName(name))
+	if err != nil {
+		return nil, err
+	}
+	if pvc.Spec.VolumeName == "" {
+		return nil, fmt.Errorf("PVC %v is not bound", pvc.Metadata.Name)
+	}
+
+	pv, err := k.client.GetPersistentVolume(pvc.Spec.VolumeName)
+	if err != nil {
+		return nil, err
+	}
+
+	vol := &scheduler.Volume{
+		Name: pv.Metadata.Name,
+		Size: sizeMB(pv.Spec.Capacity["storage"]),
+	}
+	if pv.Spec.StorageClassName != "" {
+		sc, err := k.client.GetStorageClass(pv.Spec.StorageClassName)
+		if err != nil {
+			return nil, err
+		}
+		vol.Driver = sc.Metadata.Labels[driverLabel]
+		if vol.Driver == "" {
+			vol.Driver = sc.Provisioner
+		}
+	}
+	return vol, nil
+}
+
+// DeleteVolume deletes the PVC, PV and storage class of a volume.
+func (k *kubernetes) DeleteVolume(n node.Node, name string) error {
+	claim := claimName(name)
+	pvc, err := k.client.GetPersistentVolumeClaim(claim)
+	if err != nil {
+		return err
+	}
+
+	if err := k.client.DeletePersistentVolumeClaim(claim); err != nil {
+		return err
+	}
+	if pvc.Spec.VolumeName != "" {
+		if err := k.client.DeletePersistentVolume(pvc.Spec.VolumeName); err != nil && !IsNotFound(err) {
+			return err
+		}
+	}
+	if pvc.Spec.StorageClassName != "" {
+		if err := k.client.DeleteStorageClass(pvc.Spec.StorageClassName); err != nil && !IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// createVolume creates a storage class that carries the volume options as
+// parameters, and a PVC that uses it.  It returns the name of the PVC.
+func (k *kubernetes) createVolume(vol scheduler.Volume) (string, error) {
+	claim := claimName(vol.Name)
+	if _, err := k.client.GetPersistentVolumeClaim(claim); err == nil {
+		return claim, nil
+	} else if !IsNotFound(err) {
+		return "", err
+	}
+
+	provisioner, ok := provisioners[vol.Driver]
+	if !ok {
+		provisioner = vol.Driver
+	}
+	sc := &StorageClass{
+		Metadata: ObjectMeta{
+			Name:   "torpedo-" + claim,
+			Labels: map[string]string{driverLabel: vol.Driver},
+		},
+		Provisioner: provisioner,
+		Parameters:  parameters(vol),
+	}
+	if _, err := k.client.CreateStorageClass(sc); err != nil {
+		return "", err
+	}
+
+	pvc := &PersistentVolumeClaim{
+		Metadata: ObjectMeta{Name: claim},
+		Spec: PersistentVolumeClaimSpec{
+			AccessModes:      []string{"ReadWriteOnce"},
+			StorageClassName: sc.Metadata.Name,
+			Resources: ResourceRequirements{
+				Requests: map[string]string{
+					"storage": strconv.Itoa(vol.Size) + "Mi",
+				},
+			},
+		},
+	}
+	if _, err := k.client.CreatePersistentVolumeClaim(pvc); err != nil {
+		return "", err
+	}
+	return claim, nil
+}
+
+func (k *kubernetes) deletePod(name string) error {
+	if err := k.client.DeletePod(name); err != nil {
+		return err
+	}
+	k.Lock()
+	delete(k.pods, name)
+	k.Unlock()
+	return nil
+}
+
+// lookup returns the node with the given Kubernetes node name.
+func (k *kubernetes) lookup(name string) (node.Node, error) {
+	for _, n := range k.nodes {
+		if n.Hostname == name || n.MgmtIP == name {
+			return n, nil
+		}
+	}
+	return node.Node{}, fmt.Errorf("node %v is not in the cluster", name)
+}
+
+// affinity pins a pod to the node of the task, or keeps it off that node.
+func affinity(t scheduler.Task) *Affinity {
+	host := t.Node.Hostname
+	if host == "" {
+		host = t.Node.MgmtIP
+	}
+	if host == "" {
+		return nil
+	}
+
+	operator := "In"
+	if t.Placement == scheduler.ExternalHost {
+		operator = "NotIn"
+	}
+	return &Affinity{
+		NodeAffinity: &NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &NodeSelector{
+				NodeSelectorTerms: []NodeSelectorTerm{
+					{
+						MatchExpressions: []NodeSelectorRequirement{
+							{
+								Key:      HostnameLabel,
+								Operator: operator,
+								Values:   []string{host},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// parameters returns the storage class parameters of a volume.  These are
+// the options of an inline volume specification and the volume options.
+func parameters(vol scheduler.Volume) map[string]string {
+	params := make(map[string]string)
+	opts := vol.Opt
+	if strings.Contains(vol.Name, "=") {
+		opts = append(strings.Split(vol.Name, ","), opts...)
+	}
+	for _, opt := range opts {
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) == 2 && kv[0] != "name" {
+			params[kv[0]] = kv[1]
+		}
+	}
+	return params
+}
+
+func terminated(p *Pod) bool {
+	return p.Status.Phase == PodSucceeded || p.Status.Phase == PodFailed
+}
+
+func exitCode(p *Pod) int {
+	for _, status := range p.Status.ContainerStatuses {
+		if status.State.Terminated != nil {
+			return status.State.Terminated.ExitCode
+		}
+	}
+	if p.Status.Phase == PodSucceeded {
+		return 0
+	}
+	return 1
+}
+
+// objectName returns a valid Kubernetes object name for a task.
+func objectName(name string) string {
+	return strings.ToLower(strings.Replace(name, "_", "-", -1))
+}
+
+// claimName returns the name of the PVC of a volume, which can be an inline
+// volume specification.
+func claimName(name string) string {
+	return objectName(volume.ParseName(name))
+}
+
+// sizeMB parses a Kubernetes quantity such as 10Gi into megabytes.
+func sizeMB(quantity string) int {
+	units := map[string]int{"Mi": 1, "Gi": 1024, "Ti": 1024 * 1024, "M": 1, "G": 1000, "T": 1000 * 1000}
+	for suffix, mult := range units {
+		if strings.HasSuffix(quantity, suffix) {
+			if n, err := strconv.Atoi(strings.TrimSuffix(quantity, suffix)); err == nil {
+				return n * mult
+			}
+		}
+	}
+	return 0
+}
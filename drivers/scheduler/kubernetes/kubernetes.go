@@ -0,0 +1,244 @@
+package kubernetes
+
+import (
+	"fmt"
+
+	"github.com/portworx/torpedo/drivers/scheduler"
+)
+
+const (
+	// PodRunning is the phase of a pod whose containers are running.
+	PodRunning = "Running"
+	// PodSucceeded is the phase of a pod whose containers exited with 0.
+	PodSucceeded = "Succeeded"
+	// PodFailed is the phase of a pod with a container that failed.
+	PodFailed = "Failed"
+	// HostnameLabel is the node label used for node affinity.
+	HostnameLabel = "kubernetes.io/hostname"
+)
+
+// Client is the subset of the Kubernetes API used by the Kubernetes
+// scheduler driver.  All namespaced objects live in the namespace the client
+// was created for.
+type Client interface {
+	// CreatePod creates a pod.
+	CreatePod(pod *Pod) (*Pod, error)
+	// GetPod returns a pod.
+	GetPod(name string) (*Pod, error)
+	// ListPods returns the pods that have all of the given labels.
+	ListPods(labels map[string]string) ([]Pod, error)
+	// DeletePod deletes a pod.
+	DeletePod(name string) error
+	// GetPodLog returns the log of the container of a pod.
+	GetPodLog(name string) (string, error)
+
+	// CreatePersistentVolumeClaim creates a PVC.
+	CreatePersistentVolumeClaim(pvc *PersistentVolumeClaim) (*PersistentVolumeClaim, error)
+	// GetPersistentVolumeClaim returns a PVC.
+	GetPersistentVolumeClaim(name string) (*PersistentVolumeClaim, error)
+	// DeletePersistentVolumeClaim deletes a PVC.
+	DeletePersistentVolumeClaim(name string) error
+
+	// CreateStorageClass creates a storage class.
+	CreateStorageClass(sc *StorageClass) (*StorageClass, error)
+	// GetStorageClass returns a storage class.
+	GetStorageClass(name string) (*StorageClass, error)
+	// DeleteStorageClass deletes a storage class.
+	DeleteStorageClass(name string) error
+
+	// GetPersistentVolume returns a PV.
+	GetPersistentVolume(name string) (*PersistentVolume, error)
+	// DeletePersistentVolume deletes a PV.
+	DeletePersistentVolume(name string) error
+}
+
+// StatusError is returned by a Client when the API server fails a request.
+type StatusError struct {
+	Code    int
+	Message string
+}
+
+// ObjectMeta is the metadata of an API object.
+type ObjectMeta struct {
+	Name        string            `json:"name"`
+	Namespace   string            `json:"namespace,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Pod is a Kubernetes pod.
+type Pod struct {
+	APIVersion string     `json:"apiVersion"`
+	Kind       string     `json:"kind"`
+	Metadata   ObjectMeta `json:"metadata"`
+	Spec       PodSpec    `json:"spec"`
+	Status     PodStatus  `json:"status,omitempty"`
+}
+
+// PodList is a list of pods.
+type PodList struct {
+	Items []Pod `json:"items"`
+}
+
+// PodSpec is the specification of a pod.
+type PodSpec struct {
+	RestartPolicy string      `json:"restartPolicy,omitempty"`
+	NodeName      string      `json:"nodeName,omitempty"`
+	Containers    []Container `json:"containers"`
+	Volumes       []Volume    `json:"volumes,omitempty"`
+	Affinity      *Affinity   `json:"affinity,omitempty"`
+}
+
+// Container is a container in a pod.
+type Container struct {
+	Name         string        `json:"name"`
+	Image        string        `json:"image"`
+	Args         []string      `json:"args,omitempty"`
+	Env          []EnvVar      `json:"env,omitempty"`
+	VolumeMounts []VolumeMount `json:"volumeMounts,omitempty"`
+}
+
+// EnvVar is an environment variable of a container.
+type EnvVar struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// VolumeMount mounts a pod volume into a container.
+type VolumeMount struct {
+	Name      string `json:"name"`
+	MountPath string `json:"mountPath"`
+}
+
+// Volume is a pod volume backed by a PVC.
+type Volume struct {
+	Name                  string                       `json:"name"`
+	PersistentVolumeClaim *PersistentVolumeClaimSource `json:"persistentVolumeClaim,omitempty"`
+}
+
+// PersistentVolumeClaimSource references a PVC from a pod volume.
+type PersistentVolumeClaimSource struct {
+	ClaimName string `json:"claimName"`
+}
+
+// Affinity holds the scheduling constraints of a pod.
+type Affinity struct {
+	NodeAffinity *NodeAffinity `json:"nodeAffinity,omitempty"`
+}
+
+// NodeAffinity constrains the nodes a pod can be scheduled on.
+type NodeAffinity struct {
+	RequiredDuringSchedulingIgnoredDuringExecution *NodeSelector `json:"requiredDuringSchedulingIgnoredDuringExecution,omitempty"`
+}
+
+// NodeSelector selects nodes that match any of the terms.
+type NodeSelector struct {
+	NodeSelectorTerms []NodeSelectorTerm `json:"nodeSelectorTerms"`
+}
+
+// NodeSelectorTerm selects nodes that match all of the expressions.
+type NodeSelectorTerm struct {
+	MatchExpressions []NodeSelectorRequirement `json:"matchExpressions"`
+}
+
+// NodeSelectorRequirement matches a node label against a set of values.
+type NodeSelectorRequirement struct {
+	Key      string   `json:"key"`
+	Operator string   `json:"operator"`
+	Values   []string `json:"values"`
+}
+
+// PodStatus is the status of a pod.
+type PodStatus struct {
+	Phase             string            `json:"phase,omitempty"`
+	ContainerStatuses []ContainerStatus `json:"containerStatuses,omitempty"`
+}
+
+// ContainerStatus is the status of a container in a pod.
+type ContainerStatus struct {
+	Name  string         `json:"name"`
+	State ContainerState `json:"state"`
+}
+
+// ContainerState is the state of a container.  Only the terminated state is
+// of interest to Torpedo.
+type ContainerState struct {
+	Terminated *ContainerStateTerminated `json:"terminated,omitempty"`
+}
+
+// ContainerStateTerminated is the state of a container that exited.
+type ContainerStateTerminated struct {
+	ExitCode int    `json:"exitCode"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// PersistentVolumeClaim is a Kubernetes PVC.
+type PersistentVolumeClaim struct {
+	APIVersion string                      `json:"apiVersion"`
+	Kind       string                      `json:"kind"`
+	Metadata   ObjectMeta                  `json:"metadata"`
+	Spec       PersistentVolumeClaimSpec   `json:"spec"`
+	Status     PersistentVolumeClaimStatus `json:"status,omitempty"`
+}
+
+// PersistentVolumeClaimSpec is the specification of a PVC.
+type PersistentVolumeClaimSpec struct {
+	AccessModes      []string             `json:"accessModes"`
+	StorageClassName string               `json:"storageClassName,omitempty"`
+	VolumeName       string               `json:"volumeName,omitempty"`
+	Resources        ResourceRequirements `json:"resources"`
+}
+
+// ResourceRequirements holds the storage requested by a PVC.
+type ResourceRequirements struct {
+	Requests map[string]string `json:"requests"`
+}
+
+// PersistentVolumeClaimStatus is the status of a PVC.
+type PersistentVolumeClaimStatus struct {
+	Phase string `json:"phase,omitempty"`
+}
+
+// StorageClass is a Kubernetes storage class.
+type StorageClass struct {
+	APIVersion  string            `json:"apiVersion"`
+	Kind        string            `json:"kind"`
+	Metadata    ObjectMeta        `json:"metadata"`
+	Provisioner string            `json:"provisioner"`
+	Parameters  map[string]string `json:"parameters,omitempty"`
+}
+
+// PersistentVolume is a Kubernetes PV.
+type PersistentVolume struct {
+	APIVersion string               `json:"apiVersion"`
+	Kind       string               `json:"kind"`
+	Metadata   ObjectMeta           `json:"metadata"`
+	Spec       PersistentVolumeSpec `json:"spec"`
+}
+
+// PersistentVolumeSpec is the specification of a PV.
+type PersistentVolumeSpec struct {
+	Capacity         map[string]string `json:"capacity,omitempty"`
+	StorageClassName string            `json:"storageClassName,omitempty"`
+}
+
+// Error returns the error message of the API server.
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("kubernetes API error %v: %v", e.Code, e.Message)
+}
+
+// IsNotFound returns true if the error is a not found error.
+func IsNotFound(err error) bool {
+	e, ok := err.(*StatusError)
+	return ok && e.Code == 404
+}
+
+// New returns a Kubernetes scheduler driver that uses the given client
+// instead of connecting to the API server in Init.
+func New(client Client) scheduler.Driver {
+	return newKubernetes(client)
+}
+
+func init() {
+	scheduler.Register("kubernetes", newKubernetes(nil))
+}
@@ -0,0 +1,155 @@
+package kubernetes_test
+
+import (
+	"testing"
+
+	"github.com/portworx/torpedo/config"
+	"github.com/portworx/torpedo/drivers/scheduler"
+	"github.com/portworx/torpedo/drivers/scheduler/kubernetes"
+	"github.com/portworx/torpedo/drivers/scheduler/kubernetes/fake"
+)
+
+var addresses = []string{"192.0.2.1", "192.0.2.2"}
+
+func newTestDriver(t *testing.T) (scheduler.Driver, fake.Client) {
+	client := fake.NewClient(addresses...)
+	d := kubernetes.New(client)
+	if err := d.Init(config.FromAddresses(addresses)); err != nil {
+		t.Fatal(err)
+	}
+	return d, client
+}
+
+func newTask(t *testing.T, d scheduler.Driver) scheduler.Task {
+	nodes, err := d.GetNodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return scheduler.Task{
+		Name:      "testTask",
+		Img:       "busybox",
+		Tag:       "latest",
+		Node:      nodes[0],
+		Placement: scheduler.LocalHost,
+		Vol: scheduler.Volume{
+			Name:   "vol",
+			Driver: "pxd",
+			Path:   "/mnt",
+			Size:   10240,
+		},
+	}
+}
+
+func TestCreateGivesEachTaskItsOwnPod(t *testing.T) {
+	d, _ := newTestDriver(t)
+	first, err := d.Create(newTask(t, d))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := d.Create(newTask(t, d))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.ID == second.ID {
+		t.Fatalf("expected the tasks to get different pods, both got %v", first.ID)
+	}
+
+	// Both pods can exist at the same time.
+	if err := d.Schedule(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Schedule(second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunReportsTheExitStatus(t *testing.T) {
+	d, client := newTestDriver(t)
+	ctx, err := d.Create(newTask(t, d))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetExit(ctx.ID, 5, "fio output")
+
+	if err := d.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ctx.Status != 5 || ctx.Stdout != "fio output" {
+		t.Errorf("expected exit status 5 and the pod log, got %v and %q", ctx.Status, ctx.Stdout)
+	}
+	if ctx.Task.Node.MgmtIP != addresses[0] {
+		t.Errorf("expected the task to run on %v, it ran on %v", addresses[0], ctx.Task.Node.MgmtIP)
+	}
+}
+
+func TestExternalHostPlacement(t *testing.T) {
+	d, _ := newTestDriver(t)
+	task := newTask(t, d)
+	task.Placement = scheduler.ExternalHost
+	ctx, err := d.Create(task)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Schedule(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ctx.Task.Node.MgmtIP != addresses[1] {
+		t.Errorf("expected the task to run on %v, it runs on %v", addresses[1], ctx.Task.Node.MgmtIP)
+	}
+}
+
+func TestDestroyByNameDeletesEveryPod(t *testing.T) {
+	d, client := newTestDriver(t)
+	for i := 0; i < 2; i++ {
+		ctx, err := d.Create(newTask(t, d))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Schedule(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	other := newTask(t, d)
+	other.Name = "testTaskOther"
+	other.Vol = scheduler.Volume{}
+	ctx, err := d.Create(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Schedule(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.DestroyByName(other.Node, "testTask"); err != nil {
+		t.Fatal(err)
+	}
+	pods, err := client.ListPods(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pods) != 1 || pods[0].Metadata.Name != ctx.ID {
+		t.Errorf("expected only pod %v to remain, got %+v", ctx.ID, pods)
+	}
+
+	// The volume is no longer in use.
+	if err := d.DeleteVolume(other.Node, "vol"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestInspectVolume(t *testing.T) {
+	d, _ := newTestDriver(t)
+	task := newTask(t, d)
+	if _, err := d.Create(task); err != nil {
+		t.Fatal(err)
+	}
+
+	vol, err := d.InspectVolume(task.Node, "vol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vol.Driver != "pxd" || vol.Size != 10240 {
+		t.Errorf("expected a 10240MB pxd volume, got %+v", vol)
+	}
+}
@@ -1 +1,598 @@
 package mesosphere
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+
+	"github.com/portworx/torpedo/config"
+	"github.com/portworx/torpedo/drivers/node"
+	"github.com/portworx/torpedo/drivers/scheduler"
+)
+
+const (
+	// defaultEndpoint is the Marathon endpoint if none is configured.
+	defaultEndpoint = "http://localhost:8080"
+	// defaultAgentPort is the port of the Mesos agent API on each node.
+	defaultAgentPort = 5051
+	// appGroup is the Marathon group Torpedo apps are created in.
+	appGroup = "/torpedo/"
+	// appLabel is the Docker label of the task containers of an app, with
+	// the app ID as its value.
+	appLabel = "torpedo.app"
+	// taskIDEnv is the environment variable Marathon sets to the Mesos
+	// task ID in every task.
+	taskIDEnv = "MESOS_TASK_ID"
+	// pollInterval is how often Marathon is polled for task state changes.
+	pollInterval = 2 * time.Second
+	// launchTimeout is how long to wait for Marathon to launch a task.
+	launchTimeout = 5 * time.Minute
+	// waitTimeout is how long to wait for a task to exit.
+	waitTimeout = 30 * time.Minute
+)
+
+type marathonVolume struct {
+	ContainerPath string          `json:"containerPath"`
+	Mode          string          `json:"mode"`
+	External      *externalVolume `json:"external,omitempty"`
+}
+
+type externalVolume struct {
+	Name     string            `json:"name"`
+	Provider string            `json:"provider"`
+	Options  map[string]string `json:"options"`
+}
+
+type dockerContainer struct {
+	Image          string      `json:"image"`
+	Network        string      `json:"network"`
+	ForcePullImage bool        `json:"forcePullImage"`
+	Parameters     []parameter `json:"parameters,omitempty"`
+}
+
+// parameter is a docker run option.
+type parameter struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type container struct {
+	Type    string           `json:"type"`
+	Docker  dockerContainer  `json:"docker"`
+	Volumes []marathonVolume `json:"volumes"`
+}
+
+type upgradeStrategy struct {
+	MinimumHealthCapacity float64 `json:"minimumHealthCapacity"`
+	MaximumOverCapacity   float64 `json:"maximumOverCapacity"`
+}
+
+type app struct {
+	ID              string            `json:"id"`
+	Args            []string          `json:"args,omitempty"`
+	Env             map[string]string `json:"env,omitempty"`
+	Instances       int               `json:"instances"`
+	Cpus            float64           `json:"cpus"`
+	Mem             float64           `json:"mem"`
+	Container       *container        `json:"container,omitempty"`
+	Constraints     [][]string        `json:"constraints,omitempty"`
+	UpgradeStrategy *upgradeStrategy  `json:"upgradeStrategy,omitempty"`
+	Tasks           []task            `json:"tasks,omitempty"`
+}
+
+type appResponse struct {
+	App app `json:"app"`
+}
+
+type appsResponse struct {
+	Apps []app `json:"apps"`
+}
+
+type task struct {
+	ID      string `json:"id"`
+	Host    string `json:"host"`
+	SlaveID string `json:"slaveId"`
+	State   string `json:"state"`
+}
+
+type agentState struct {
+	Frameworks          []agentFramework `json:"frameworks"`
+	CompletedFrameworks []agentFramework `json:"completed_frameworks"`
+}
+
+type agentFramework struct {
+	Executors          []agentExecutor `json:"executors"`
+	CompletedExecutors []agentExecutor `json:"completed_executors"`
+}
+
+type agentExecutor struct {
+	ID        string `json:"id"`
+	Directory string `json:"directory"`
+}
+
+type fileData struct {
+	Data string `json:"data"`
+}
+
+// httpError is returned when the Marathon or Mesos API responds with an
+// error status code.
+type httpError struct {
+	status int
+	body   string
+}
+
+// launched keeps track of the Mesos task that was launched for an app.
+type launched struct {
+	taskID string
+	host   string
+}
+
+type marathon struct {
+	sync.Mutex
+	config    *config.Config
+	nodes     []node.Node
+	endpoint  string
+	agentPort int
+	client    *http.Client
+	// tasks holds the launched task of each app by app ID.
+	tasks map[string]launched
+	// created is the number of apps created, which numbers the app IDs.
+	created       int
+	pollInterval  time.Duration
+	launchTimeout time.Duration
+	waitTimeout   time.Duration
+}
+
+func (e *httpError) Error() string {
+	return fmt.Sprintf("request failed with status %v: %v", e.status, e.body)
+}
+
+func (m *marathon) Init(cfg *config.Config) error {
+	nodes, err := node.FromConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	m.config = cfg
+	m.nodes = nodes
+	m.client = &http.Client{Timeout: 30 * time.Second}
+	m.tasks = make(map[string]launched)
+	m.pollInterval = pollInterval
+	m.launchTimeout = launchTimeout
+	m.waitTimeout = waitTimeout
+
+	m.endpoint = strings.TrimSuffix(cfg.Scheduler.Endpoint, "/")
+	if m.endpoint == "" {
+		m.endpoint = defaultEndpoint
+	}
+
+	m.agentPort = defaultAgentPort
+	if port, ok := cfg.Scheduler.Options["agentPort"]; ok {
+		if m.agentPort, err = strconv.Atoi(port); err != nil {
+			return fmt.Errorf("invalid Mesos agent port %v: %v", port, err)
+		}
+	}
+
+	if err := m.do("GET", m.endpoint+"/ping", nil, nil); err != nil {
+		return fmt.Errorf("cannot reach Marathon at %v: %v", m.endpoint, err)
+	}
+
+	log.Printf("Using the Marathon scheduler at %v.\n", m.endpoint)
+	log.Printf("The following hosts are in the cluster: %v.\n", cfg.Addresses())
+	return nil
+}
+
+func (m *marathon) GetNodes() ([]node.Node, error) {
+	return m.nodes, nil
+}
+
+// Create creates a Marathon app with no instances, so that the task does
+// not start until it is scheduled.  Each task gets its own app, so that a
+// task can be created again while an earlier one still exists.
+func (m *marathon) Create(t scheduler.Task) (*scheduler.Context, error) {
+	host := hostname(t.Node)
+	constraint := []string{"hostname", "CLUSTER", host}
+	if t.Placement == scheduler.ExternalHost {
+		constraint = []string{"hostname", "UNLIKE", host}
+	}
+
+	m.Lock()
+	m.created++
+	id := appID(t.Name) + "-" + strconv.Itoa(m.created)
+	m.Unlock()
+
+	a := app{
+		ID:          id,
+		Args:        t.Cmd,
+		Env:         make(map[string]string),
+		Instances:   0,
+		Cpus:        0.5,
+		Mem:         512,
+		Constraints: [][]string{constraint},
+		Container: &container{
+			Type: "DOCKER",
+			Docker: dockerContainer{
+				Image:          t.Img + ":" + t.Tag,
+				Network:        "HOST",
+				ForcePullImage: true,
+				Parameters: []parameter{
+					{Key: "label", Value: appLabel + "=" + id},
+				},
+			},
+		},
+		// Never run two instances of a task, they share the same volume.
+		UpgradeStrategy: &upgradeStrategy{
+			MinimumHealthCapacity: 0,
+			MaximumOverCapacity:   0,
+		},
+	}
+	for _, env := range t.Env {
+		kv := strings.SplitN(env, "=", 2)
+		if len(kv) == 2 {
+			a.Env[kv[0]] = kv[1]
+		}
+	}
+	if t.Vol.Name != "" {
+		options := map[string]string{"dvdi/driver": t.Vol.Driver}
+		for _, opt := range t.Vol.Opt {
+			kv := strings.SplitN(opt, "=", 2)
+			if len(kv) == 2 {
+				options["dvdi/"+kv[0]] = kv[1]
+			}
+		}
+		a.Container.Volumes = []marathonVolume{
+			{
+				ContainerPath: t.Vol.Path,
+				Mode:          "RW",
+				External: &externalVolume{
+					Name:     t.Vol.Name,
+					Provider: "dvdi",
+					Options:  options,
+				},
+			},
+		}
+	}
+
+	if err := m.do("POST", m.endpoint+"/v2/apps", &a, nil); err != nil {
+		return nil, err
+	}
+
+	return &scheduler.Context{
+		ID:   a.ID,
+		Task: t,
+	}, nil
+}
+
+// Schedule scales the app to one instance and waits for its task to launch.
+// The task in the context is then pinned to the node it launched on.
+func (m *marathon) Schedule(ctx *scheduler.Context) error {
+	if err := m.scale(ctx.ID, 1); err != nil {
+		return err
+	}
+
+	for start := time.Now(); time.Since(start) < m.launchTimeout; time.Sleep(m.pollInterval) {
+		a, err := m.getApp(ctx.ID)
+		if err != nil {
+			return err
+		}
+		for _, t := range a.Tasks {
+			if t.State != "TASK_RUNNING" {
+				continue
+			}
+			m.Lock()
+			m.tasks[ctx.ID] = launched{taskID: t.ID, host: t.Host}
+			m.Unlock()
+			if n, err := m.lookup(t.Host); err == nil {
+				ctx.Task.Node = n
+				ctx.Task.Placement = scheduler.LocalHost
+			}
+			log.Printf("Marathon launched task %v on %v\n", t.ID, t.Host)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Marathon did not launch %v in time", ctx.ID)
+}
+
+// WaitDone waits for the container of the launched task to exit, and
+// scales the app down so that Marathon does not restart it.  The exit status
+// is the exit code of the container.
+func (m *marathon) WaitDone(ctx *scheduler.Context) error {
+	m.Lock()
+	l, ok := m.tasks[ctx.ID]
+	m.Unlock()
+	if !ok {
+		return fmt.Errorf("task %v has not been scheduled", ctx.Task.Name)
+	}
+
+	state, err := m.waitExit(ctx.ID, l)
+	if scaleErr := m.scale(ctx.ID, 0); err == nil {
+		err = scaleErr
+	}
+	if err != nil {
+		return err
+	}
+	ctx.Status = state.ExitCode
+
+	if ctx.Stdout, err = m.readLog(l, "stdout"); err != nil {
+		log.Printf("Could not read the stdout of %v: %v\n", l.taskID, err)
+	}
+	if ctx.Stderr, err = m.readLog(l, "stderr"); err != nil {
+		log.Printf("Could not read the stderr of %v: %v\n", l.taskID, err)
+	}
+	return nil
+}
+
+// Run to completion.
+func (m *marathon) Run(ctx *scheduler.Context) error {
+	if err := m.Schedule(ctx); err != nil {
+		return err
+	}
+	return m.WaitDone(ctx)
+}
+
+func (m *marathon) Destroy(ctx *scheduler.Context) error {
+	if err := m.deleteApp(ctx.ID); err != nil {
+		return err
+	}
+
+	m.Lock()
+	delete(m.tasks, ctx.ID)
+	m.Unlock()
+	log.Printf("Deleted task: %v\n", ctx.Task.Name)
+	return nil
+}
+
+// DestroyByName removes the apps of every task with the given name.  Apps
+// are not bound to a node, so the node is ignored.
+func (m *marathon) DestroyByName(n node.Node, name string) error {
+	prefix := appID(name) + "-"
+	apps := appsResponse{}
+	if err := m.do("GET", m.endpoint+"/v2/apps?id="+url.QueryEscape(prefix), nil, &apps); err != nil {
+		return err
+	}
+
+	for _, a := range apps.Apps {
+		if !isInstance(a.ID, prefix) {
+			continue
+		}
+		if err := m.deleteApp(a.ID); err != nil {
+			if e, ok := err.(*httpError); ok && e.status == http.StatusNotFound {
+				continue
+			}
+			return err
+		}
+
+		m.Lock()
+		delete(m.tasks, a.ID)
+		m.Unlock()
+		log.Printf("Deleted task: %v (%v)\n", name, a.ID)
+	}
+	return nil
+}
+
+// InspectVolume inspects a volume through the Docker daemon of the node,
+// which is what the Mesos Docker volume isolator uses.
+func (m *marathon) InspectVolume(n node.Node, name string) (*scheduler.Volume, error) {
+	cfgNode := m.config.Lookup(n.MgmtIP)
+	docker, err := cfgNode.DockerClient()
+	if err != nil {
+		return nil, err
+	}
+
+	vol, err := docker.InspectVolume(name)
+	if err != nil {
+		return nil, err
+	}
+	return &scheduler.Volume{
+		Name:   vol.Name,
+		Driver: vol.Driver,
+	}, nil
+}
+
+func (m *marathon) DeleteVolume(n node.Node, name string) error {
+	cfgNode := m.config.Lookup(n.MgmtIP)
+	docker, err := cfgNode.DockerClient()
+	if err != nil {
+		return err
+	}
+
+	if err := docker.RemoveVolume(name); err != nil {
+		return err
+	}
+
+	if _, err := docker.InspectVolume(name); err == nil {
+		return fmt.Errorf("volume %v could not be deleted", name)
+	}
+	return nil
+}
+
+func (m *marathon) scale(id string, instances int) error {
+	a := map[string]int{"instances": instances}
+	return m.do("PUT", m.endpoint+"/v2/apps"+id+"?force=true", a, nil)
+}
+
+func (m *marathon) getApp(id string) (*app, error) {
+	resp := appResponse{}
+	path := m.endpoint + "/v2/apps" + id + "?embed=app.tasks"
+	if err := m.do("GET", path, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.App, nil
+}
+
+func (m *marathon) deleteApp(id string) error {
+	return m.do("DELETE", m.endpoint+"/v2/apps"+id+"?force=true", nil, nil)
+}
+
+// waitExit waits for the container of a launched task to exit and returns
+// its state.  Marathon forgets a task once it terminates and may launch
+// another one, so the container is looked up by the Mesos task ID.
+func (m *marathon) waitExit(id string, l launched) (*dockerclient.State, error) {
+	for start := time.Now(); time.Since(start) < m.waitTimeout; time.Sleep(m.pollInterval) {
+		info, err := m.taskContainer(id, l)
+		if err != nil {
+			return nil, err
+		}
+		if !info.State.Running {
+			return &info.State, nil
+		}
+	}
+	return nil, fmt.Errorf("task %v of %v did not exit in time", l.taskID, id)
+}
+
+// taskContainer returns the Docker container of a launched task.  The
+// containers of an app carry its label, and Marathon passes the task ID in
+// their environment.
+func (m *marathon) taskContainer(id string, l launched) (*dockerclient.Container, error) {
+	n, err := m.lookup(l.host)
+	if err != nil {
+		return nil, err
+	}
+	cfgNode := m.config.Lookup(n.MgmtIP)
+	docker, err := cfgNode.DockerClient()
+	if err != nil {
+		return nil, err
+	}
+
+	containers, err := docker.ListContainers(dockerclient.ListContainersOptions{
+		All:     true,
+		Filters: map[string][]string{"label": {appLabel + "=" + id}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range containers {
+		info, err := docker.InspectContainer(c.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, env := range info.Config.Env {
+			if env == taskIDEnv+"="+l.taskID {
+				return info, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("the container of task %v of %v is gone from %v", l.taskID, id, l.host)
+}
+
+// readLog reads a file from the sandbox of a task through the Mesos agent
+// files API.
+func (m *marathon) readLog(l launched, file string) (string, error) {
+	agent := "http://" + l.host + ":" + strconv.Itoa(m.agentPort)
+
+	state := agentState{}
+	if err := m.do("GET", agent+"/state", nil, &state); err != nil {
+		return "", err
+	}
+
+	directory := ""
+	frameworks := append(state.Frameworks, state.CompletedFrameworks...)
+	for _, f := range frameworks {
+		for _, e := range append(f.Executors, f.CompletedExecutors...) {
+			if e.ID == l.taskID {
+				directory = e.Directory
+			}
+		}
+	}
+	if directory == "" {
+		return "", fmt.Errorf("cannot find the sandbox of %v on %v", l.taskID, l.host)
+	}
+
+	data := fileData{}
+	query := url.Values{}
+	query.Set("path", directory+"/"+file)
+	query.Set("offset", "0")
+	if err := m.do("GET", agent+"/files/read?"+query.Encode(), nil, &data); err != nil {
+		return "", err
+	}
+	return data.Data, nil
+}
+
+// lookup returns the node with the given Mesos agent hostname.
+func (m *marathon) lookup(host string) (node.Node, error) {
+	for _, n := range m.nodes {
+		if n.Hostname == host || n.MgmtIP == host {
+			return n, nil
+		}
+	}
+	return node.Node{}, fmt.Errorf("host %v is not in the cluster", host)
+}
+
+// do sends a JSON request and decodes the JSON response into out.
+func (m *marathon) do(method, path string, in, out interface{}) error {
+	var body *bytes.Buffer
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewBuffer(data)
+	} else {
+		body = bytes.NewBuffer(nil)
+	}
+
+	request, err := http.NewRequest(method, path, body)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Accept", "application/json")
+
+	response, err := m.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode >= http.StatusBadRequest {
+		return &httpError{status: response.StatusCode, body: string(data)}
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// appID returns the Marathon app ID prefix of the tasks with the given
+// name.  App IDs may only contain lowercase letters, digits, hyphens and
+// dots.
+func appID(name string) string {
+	return appGroup + strings.ToLower(strings.Replace(name, "_", "-", -1))
+}
+
+// isInstance returns true if an app ID is the ID of a task whose app ID
+// prefix is prefix, which is followed by the number of the task.
+func isInstance(id, prefix string) bool {
+	if !strings.HasPrefix(id, prefix) {
+		return false
+	}
+	_, err := strconv.Atoi(strings.TrimPrefix(id, prefix))
+	return err == nil
+}
+
+// hostname returns the hostname Mesos knows a node by.
+func hostname(n node.Node) string {
+	if n.Hostname != "" {
+		return n.Hostname
+	}
+	return n.MgmtIP
+}
+
+func init() {
+	scheduler.Register("mesosphere", &marathon{})
+}
@@ -0,0 +1,325 @@
+package mesosphere
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+
+	"github.com/portworx/torpedo/config"
+	"github.com/portworx/torpedo/drivers/scheduler"
+)
+
+const host = "127.0.0.1"
+
+// cluster stands in for Marathon, the Mesos agent and the Docker daemon of
+// a single node cluster.  Scaling an app up launches a task whose container
+// runs until it is finished.
+type cluster struct {
+	sync.Mutex
+	t          *testing.T
+	apps       map[string]*app
+	containers map[string]*dockerclient.Container
+	executors  []agentExecutor
+	launched   int
+}
+
+func newCluster(t *testing.T) (*cluster, *httptest.Server) {
+	c := &cluster{
+		t:          t,
+		apps:       make(map[string]*app),
+		containers: make(map[string]*dockerclient.Container),
+	}
+	return c, httptest.NewServer(c)
+}
+
+func (c *cluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.Lock()
+	defer c.Unlock()
+
+	path := r.URL.Path
+	switch {
+	case path == "/ping":
+	case path == "/v2/apps" && r.Method == "POST":
+		a := &app{}
+		if err := json.NewDecoder(r.Body).Decode(a); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if _, ok := c.apps[a.ID]; ok {
+			http.Error(w, "app already exists", http.StatusConflict)
+			return
+		}
+		c.apps[a.ID] = a
+		w.WriteHeader(http.StatusCreated)
+		c.reply(w, a)
+	case path == "/v2/apps" && r.Method == "GET":
+		apps := appsResponse{}
+		for id, a := range c.apps {
+			if strings.Contains(id, r.URL.Query().Get("id")) {
+				apps.Apps = append(apps.Apps, *a)
+			}
+		}
+		c.reply(w, apps)
+	case strings.HasPrefix(path, "/v2/apps/"):
+		a, ok := c.apps[strings.TrimPrefix(path, "/v2/apps")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.Method {
+		case "GET":
+			c.reply(w, appResponse{App: *a})
+		case "PUT":
+			scale := map[string]int{}
+			if err := json.NewDecoder(r.Body).Decode(&scale); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			c.scale(a, scale["instances"])
+		case "DELETE":
+			c.scale(a, 0)
+			delete(c.apps, a.ID)
+		}
+	case path == "/state":
+		c.reply(w, agentState{Frameworks: []agentFramework{{CompletedExecutors: c.executors}}})
+	case path == "/files/read":
+		c.reply(w, fileData{Data: strings.TrimPrefix(r.URL.Query().Get("path"), "/sandbox/")})
+	case path == "/containers/json":
+		filters := map[string][]string{}
+		if err := json.Unmarshal([]byte(r.URL.Query().Get("filters")), &filters); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		containers := []dockerclient.APIContainers{}
+		for id, info := range c.containers {
+			for _, label := range filters["label"] {
+				if label == appLabel+"="+info.Config.Labels[appLabel] {
+					containers = append(containers, dockerclient.APIContainers{ID: id})
+				}
+			}
+		}
+		c.reply(w, containers)
+	case strings.HasPrefix(path, "/containers/"):
+		info, ok := c.containers[strings.TrimSuffix(strings.TrimPrefix(path, "/containers/"), "/json")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		c.reply(w, info)
+	default:
+		c.t.Errorf("unexpected request %v %v", r.Method, r.URL)
+		http.NotFound(w, r)
+	}
+}
+
+func (c *cluster) reply(w http.ResponseWriter, out interface{}) {
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		c.t.Error(err)
+	}
+}
+
+// scale launches or kills the task of an app.  Killed tasks leave their
+// container behind, as the Mesos Docker containerizer does.
+func (c *cluster) scale(a *app, instances int) {
+	a.Instances = instances
+	if instances == 0 {
+		for _, t := range a.Tasks {
+			if info, ok := c.containers[t.ID]; ok {
+				info.State.Running = false
+			}
+		}
+		a.Tasks = nil
+		return
+	}
+	if len(a.Tasks) > 0 {
+		return
+	}
+
+	c.launched++
+	t := task{ID: a.ID + "." + strconv.Itoa(c.launched), Host: host, State: "TASK_RUNNING"}
+	a.Tasks = []task{t}
+	c.executors = append(c.executors, agentExecutor{ID: t.ID, Directory: "/sandbox/" + t.ID})
+	c.containers[t.ID] = &dockerclient.Container{
+		ID: t.ID,
+		Config: &dockerclient.Config{
+			Env:    []string{taskIDEnv + "=" + t.ID},
+			Labels: map[string]string{appLabel: a.ID},
+		},
+		State: dockerclient.State{Running: true},
+	}
+}
+
+// exit terminates the task of an app with the given status.  Marathon
+// forgets the task and launches another one.
+func (c *cluster) exit(id string, status int) {
+	c.Lock()
+	defer c.Unlock()
+
+	a := c.apps[id]
+	for _, t := range a.Tasks {
+		c.containers[t.ID].State = dockerclient.State{ExitCode: status}
+	}
+	a.Tasks = nil
+	c.scale(a, a.Instances)
+}
+
+// remove removes the containers of the tasks of an app.
+func (c *cluster) remove(id string) {
+	c.Lock()
+	defer c.Unlock()
+
+	for _, t := range c.apps[id].Tasks {
+		delete(c.containers, t.ID)
+	}
+}
+
+func newTestDriver(t *testing.T) (*marathon, *cluster) {
+	c, server := newCluster(t)
+	t.Cleanup(server.Close)
+
+	_, port, err := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.FromAddresses([]string{host})
+	cfg.Nodes[0].Docker.Endpoint = server.URL
+	cfg.Scheduler.Endpoint = server.URL
+	cfg.Scheduler.Options = map[string]string{"agentPort": port}
+
+	m := &marathon{}
+	if err := m.Init(cfg); err != nil {
+		t.Fatal(err)
+	}
+	m.pollInterval = time.Millisecond
+	m.waitTimeout = time.Second
+	return m, c
+}
+
+func newTask(m *marathon) scheduler.Task {
+	return scheduler.Task{
+		Name: "testTask",
+		Img:  "busybox",
+		Tag:  "latest",
+		Node: m.nodes[0],
+		Vol: scheduler.Volume{
+			Name:   "vol",
+			Driver: "pxd",
+			Path:   "/mnt",
+			Opt:    []string{"size=10G"},
+		},
+	}
+}
+
+func TestCreateGivesEachTaskItsOwnApp(t *testing.T) {
+	m, c := newTestDriver(t)
+	first, err := m.Create(newTask(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := m.Create(newTask(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.ID == second.ID {
+		t.Fatalf("expected the tasks to get different apps, both got %v", first.ID)
+	}
+
+	a := c.apps[first.ID]
+	if got := a.Constraints[0]; got[0] != "hostname" || got[1] != "CLUSTER" || got[2] != host {
+		t.Errorf("expected the app to be pinned to %v, got %v", host, got)
+	}
+	if got := a.Container.Volumes[0].External.Options["dvdi/size"]; got != "10G" {
+		t.Errorf("expected the volume option size=10G, got %q", got)
+	}
+}
+
+func TestRunReportsTheExitStatus(t *testing.T) {
+	m, c := newTestDriver(t)
+	ctx, err := m.Create(newTask(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Schedule(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ctx.Task.Node.MgmtIP != host || ctx.Task.Placement != scheduler.LocalHost {
+		t.Errorf("expected the task to be pinned to %v, got %+v", host, ctx.Task)
+	}
+
+	c.exit(ctx.ID, 5)
+	if err := m.WaitDone(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ctx.Status != 5 {
+		t.Errorf("expected exit status 5, got %v", ctx.Status)
+	}
+	if !strings.HasSuffix(ctx.Stdout, "/stdout") {
+		t.Errorf("expected the stdout of the task, got %q", ctx.Stdout)
+	}
+	if a := c.apps[ctx.ID]; a.Instances != 0 || len(a.Tasks) != 0 {
+		t.Errorf("expected the app to be scaled down, got %+v", a)
+	}
+}
+
+func TestWaitDoneFailsIfTheContainerIsGone(t *testing.T) {
+	m, c := newTestDriver(t)
+	ctx, err := m.Create(newTask(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Schedule(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	c.remove(ctx.ID)
+	if err := m.WaitDone(ctx); err == nil {
+		t.Errorf("expected WaitDone to fail for a vanished task, got status %v", ctx.Status)
+	}
+}
+
+func TestWaitDoneTimesOut(t *testing.T) {
+	m, _ := newTestDriver(t)
+	m.waitTimeout = 10 * time.Millisecond
+	ctx, err := m.Create(newTask(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Schedule(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.WaitDone(ctx); err == nil {
+		t.Errorf("expected WaitDone to time out while the task runs")
+	}
+}
+
+func TestDestroyByNameRemovesEveryTask(t *testing.T) {
+	m, c := newTestDriver(t)
+	for i := 0; i < 2; i++ {
+		if _, err := m.Create(newTask(m)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	other := newTask(m)
+	other.Name = "testTaskOther"
+	if _, err := m.Create(other); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.DestroyByName(m.nodes[0], "testTask"); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.apps) != 1 {
+		t.Errorf("expected only the app of testTaskOther to remain, got %v apps", len(c.apps))
+	}
+	if err := m.DestroyByName(m.nodes[0], "testTask"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,662 @@
+package nomad
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/portworx/torpedo/config"
+	"github.com/portworx/torpedo/drivers/node"
+	"github.com/portworx/torpedo/drivers/scheduler"
+)
+
+const (
+	// defaultEndpoint is the Nomad endpoint if none is configured.
+	defaultEndpoint = "http://localhost:4646"
+	// defaultDatacenter is the datacenter jobs run in if none is configured.
+	defaultDatacenter = "dc1"
+	// jobBatch is a job that runs to completion.
+	jobBatch = "batch"
+	// jobService is a long running job that Nomad reschedules on failure.
+	jobService = "service"
+	// taskName is the name of the task in a Torpedo job.
+	taskName = "torpedo"
+	// pollInterval is how often Nomad is polled for allocation changes.
+	pollInterval = 2 * time.Second
+	// placeTimeout is how long to wait for Nomad to place an allocation.
+	placeTimeout = 5 * time.Minute
+	// killedStatus is the exit status of a task that was lost or killed.
+	killedStatus = 137
+)
+
+type constraint struct {
+	LTarget string `json:"LTarget"`
+	RTarget string `json:"RTarget"`
+	Operand string `json:"Operand"`
+}
+
+type restartPolicy struct {
+	Attempts int    `json:"Attempts"`
+	Interval int64  `json:"Interval"`
+	Delay    int64  `json:"Delay"`
+	Mode     string `json:"Mode"`
+}
+
+type reschedulePolicy struct {
+	Attempts  int   `json:"Attempts"`
+	Interval  int64 `json:"Interval"`
+	Unlimited bool  `json:"Unlimited"`
+}
+
+type resources struct {
+	CPU      int `json:"CPU"`
+	MemoryMB int `json:"MemoryMB"`
+}
+
+type task struct {
+	Name      string                 `json:"Name"`
+	Driver    string                 `json:"Driver"`
+	Config    map[string]interface{} `json:"Config"`
+	Env       map[string]string      `json:"Env,omitempty"`
+	Resources *resources             `json:"Resources,omitempty"`
+}
+
+type taskGroup struct {
+	Name             string            `json:"Name"`
+	Count            int               `json:"Count"`
+	RestartPolicy    *restartPolicy    `json:"RestartPolicy,omitempty"`
+	ReschedulePolicy *reschedulePolicy `json:"ReschedulePolicy,omitempty"`
+	Tasks            []task            `json:"Tasks"`
+}
+
+type job struct {
+	ID          string       `json:"ID"`
+	Name        string       `json:"Name"`
+	Type        string       `json:"Type"`
+	Datacenters []string     `json:"Datacenters"`
+	Constraints []constraint `json:"Constraints,omitempty"`
+	TaskGroups  []taskGroup  `json:"TaskGroups"`
+}
+
+// jobStub is a job in the job list.
+type jobStub struct {
+	ID   string `json:"ID"`
+	Name string `json:"Name"`
+}
+
+type registerRequest struct {
+	Job *job `json:"Job"`
+}
+
+type allocation struct {
+	ID            string               `json:"ID"`
+	NodeID        string               `json:"NodeID"`
+	DesiredStatus string               `json:"DesiredStatus"`
+	ClientStatus  string               `json:"ClientStatus"`
+	CreateIndex   uint64               `json:"CreateIndex"`
+	TaskStates    map[string]taskState `json:"TaskStates"`
+}
+
+type taskState struct {
+	State  string      `json:"State"`
+	Failed bool        `json:"Failed"`
+	Events []taskEvent `json:"Events"`
+}
+
+type taskEvent struct {
+	Type           string `json:"Type"`
+	ExitCode       int    `json:"ExitCode"`
+	DriverError    string `json:"DriverError"`
+	DisplayMessage string `json:"DisplayMessage"`
+}
+
+type nomadNode struct {
+	ID         string            `json:"ID"`
+	Name       string            `json:"Name"`
+	HTTPAddr   string            `json:"HTTPAddr"`
+	Attributes map[string]string `json:"Attributes"`
+}
+
+// httpError is returned when the Nomad API responds with an error status
+// code.
+type httpError struct {
+	status int
+	body   string
+}
+
+type nomad struct {
+	sync.Mutex
+	config      *config.Config
+	nodes       []node.Node
+	endpoint    string
+	token       string
+	jobType     string
+	datacenters []string
+	client      *http.Client
+	// jobs holds the job of each task by context ID, which is the job ID.
+	jobs map[string]*job
+	// allocs holds the latest allocation of each scheduled job by job ID.
+	allocs map[string]string
+	// created is the number of jobs created, which numbers the job IDs.
+	created int
+}
+
+func (e *httpError) Error() string {
+	return fmt.Sprintf("request failed with status %v: %v", e.status, e.body)
+}
+
+func (s *nomad) Init(cfg *config.Config) error {
+	nodes, err := node.FromConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	s.config = cfg
+	s.nodes = nodes
+	s.client = &http.Client{Timeout: 30 * time.Second}
+	s.jobs = make(map[string]*job)
+	s.allocs = make(map[string]string)
+
+	s.endpoint = strings.TrimSuffix(cfg.Scheduler.Endpoint, "/")
+	if s.endpoint == "" {
+		s.endpoint = defaultEndpoint
+	}
+	s.token = cfg.Scheduler.Options["token"]
+
+	s.jobType = jobBatch
+	if jobType, ok := cfg.Scheduler.Options["jobType"]; ok {
+		if jobType != jobBatch && jobType != jobService {
+			return fmt.Errorf("unknown Nomad job type %v", jobType)
+		}
+		s.jobType = jobType
+	}
+
+	s.datacenters = []string{defaultDatacenter}
+	if dcs, ok := cfg.Scheduler.Options["datacenters"]; ok {
+		s.datacenters = strings.Split(dcs, ",")
+	}
+
+	leader := ""
+	if err := s.do("GET", "/v1/status/leader", nil, &leader); err != nil {
+		return fmt.Errorf("cannot reach Nomad at %v: %v", s.endpoint, err)
+	}
+
+	log.Printf("Using the Nomad scheduler at %v.\n", s.endpoint)
+	log.Printf("The following hosts are in the cluster: %v.\n", cfg.Addresses())
+	return nil
+}
+
+func (s *nomad) GetNodes() ([]node.Node, error) {
+	return s.nodes, nil
+}
+
+// Create builds the Nomad job of a task.  The job is not registered until
+// the task is scheduled.  Each task gets its own job, named after the task,
+// so that a task can be created again while an earlier one still exists.
+func (s *nomad) Create(t scheduler.Task) (*scheduler.Context, error) {
+	host := hostname(t.Node)
+	operand := "="
+	if t.Placement == scheduler.ExternalHost {
+		operand = "!="
+	}
+
+	dockerConfig := map[string]interface{}{
+		"image": t.Img + ":" + t.Tag,
+	}
+	if len(t.Cmd) > 0 {
+		dockerConfig["args"] = t.Cmd
+	}
+	if t.Vol.Name != "" {
+		if len(t.Vol.Opt) == 0 {
+			dockerConfig["volume_driver"] = t.Vol.Driver
+			dockerConfig["volumes"] = []string{t.Vol.Name + ":" + t.Vol.Path}
+		} else {
+			// Volume options can only be passed with a mount.
+			dockerConfig["mounts"] = []map[string]interface{}{
+				{
+					"target": t.Vol.Path,
+					"source": t.Vol.Name,
+					"volume_options": []map[string]interface{}{
+						{
+							"driver_config": []map[string]interface{}{
+								{
+									"name":    t.Vol.Driver,
+									"options": []map[string]string{options(t.Vol.Opt)},
+								},
+							},
+						},
+					},
+				},
+			}
+		}
+	}
+
+	env := make(map[string]string)
+	for _, e := range t.Env {
+		kv := strings.SplitN(e, "=", 2)
+		if len(kv) == 2 {
+			env[kv[0]] = kv[1]
+		}
+	}
+
+	group := taskGroup{
+		Name:  taskName,
+		Count: 1,
+		// Never restart the task in place, it has to be waited on.
+		RestartPolicy: &restartPolicy{
+			Attempts: 0,
+			Interval: int64(time.Minute),
+			Delay:    int64(15 * time.Second),
+			Mode:     "fail",
+		},
+		Tasks: []task{
+			{
+				Name:      taskName,
+				Driver:    "docker",
+				Config:    dockerConfig,
+				Env:       env,
+				Resources: &resources{CPU: 500, MemoryMB: 512},
+			},
+		},
+	}
+	if s.jobType == jobBatch {
+		// A batch task runs once, so that its exit code is kept.
+		group.ReschedulePolicy = &reschedulePolicy{
+			Attempts:  0,
+			Unlimited: false,
+		}
+	}
+
+	s.Lock()
+	s.created++
+	id := t.Name + "-" + strconv.Itoa(s.created)
+	s.Unlock()
+
+	j := &job{
+		ID:          id,
+		Name:        t.Name,
+		Type:        s.jobType,
+		Datacenters: s.datacenters,
+		TaskGroups:  []taskGroup{group},
+	}
+	if host != "" {
+		j.Constraints = []constraint{
+			{
+				LTarget: "${attr.unique.hostname}",
+				RTarget: host,
+				Operand: operand,
+			},
+		}
+	}
+	s.Lock()
+	s.jobs[j.ID] = j
+	s.Unlock()
+
+	return &scheduler.Context{
+		ID:   j.ID,
+		Task: t,
+	}, nil
+}
+
+// Schedule registers the job of a task and waits for Nomad to start its
+// allocation.  The task in the context is then pinned to the node the
+// allocation was placed on.
+func (s *nomad) Schedule(ctx *scheduler.Context) error {
+	s.Lock()
+	j, ok := s.jobs[ctx.ID]
+	s.Unlock()
+	if !ok {
+		return fmt.Errorf("task %v has not been created", ctx.Task.Name)
+	}
+
+	if err := s.do("PUT", "/v1/jobs", &registerRequest{Job: j}, nil); err != nil {
+		return err
+	}
+
+	for start := time.Now(); time.Since(start) < placeTimeout; time.Sleep(pollInterval) {
+		a, err := s.latestAllocation(ctx.ID)
+		if err != nil {
+			return err
+		}
+		if a == nil || a.ClientStatus == "pending" {
+			continue
+		}
+		if e := driverFailure(a); e != nil {
+			return fmt.Errorf(
+				"Nomad could not start %v: %v",
+				ctx.Task.Name,
+				e.message(),
+			)
+		}
+
+		s.Lock()
+		s.allocs[ctx.ID] = a.ID
+		s.Unlock()
+		n, err := s.allocationNode(a)
+		if err != nil {
+			return err
+		}
+		ctx.Task.Node = n
+		ctx.Task.Placement = scheduler.LocalHost
+		log.Printf("Nomad placed allocation %v on %v\n", a.ID, n.Hostname)
+		return nil
+	}
+
+	return fmt.Errorf("Nomad did not place %v in time", ctx.Task.Name)
+}
+
+// WaitDone waits for the allocation of a task to terminate.  Service jobs
+// are stopped afterwards, so that Nomad does not replace the allocation.
+func (s *nomad) WaitDone(ctx *scheduler.Context) error {
+	s.Lock()
+	_, ok := s.allocs[ctx.ID]
+	s.Unlock()
+	if !ok {
+		return fmt.Errorf("task %v has not been scheduled", ctx.Task.Name)
+	}
+
+	var a *allocation
+	for {
+		var err error
+		if a, err = s.latestAllocation(ctx.ID); err != nil {
+			return err
+		}
+		if a != nil && terminal(a) {
+			break
+		}
+		time.Sleep(pollInterval)
+	}
+	s.Lock()
+	s.allocs[ctx.ID] = a.ID
+	s.Unlock()
+	ctx.Status = exitStatus(a)
+
+	if n, err := s.allocationNode(a); err == nil {
+		ctx.Task.Node = n
+	}
+
+	if s.jobType == jobService {
+		if err := s.do("DELETE", "/v1/job/"+url.PathEscape(ctx.ID), nil, nil); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	if ctx.Stdout, err = s.readLog(a.ID, "stdout"); err != nil {
+		log.Printf("Could not read the stdout of %v: %v\n", a.ID, err)
+	}
+	if ctx.Stderr, err = s.readLog(a.ID, "stderr"); err != nil {
+		log.Printf("Could not read the stderr of %v: %v\n", a.ID, err)
+	}
+	return nil
+}
+
+// Run to completion.
+func (s *nomad) Run(ctx *scheduler.Context) error {
+	if err := s.Schedule(ctx); err != nil {
+		return err
+	}
+	return s.WaitDone(ctx)
+}
+
+func (s *nomad) Destroy(ctx *scheduler.Context) error {
+	if err := s.purge(ctx.ID); err != nil {
+		return err
+	}
+
+	log.Printf("Deleted task: %v\n", ctx.Task.Name)
+	return nil
+}
+
+// DestroyByName purges the jobs of every task with the given name.  Jobs
+// are not bound to a node, so the node is ignored.
+func (s *nomad) DestroyByName(n node.Node, name string) error {
+	jobs := []jobStub{}
+	if err := s.do("GET", "/v1/jobs?prefix="+url.QueryEscape(name), nil, &jobs); err != nil {
+		return err
+	}
+
+	for _, j := range jobs {
+		// The prefix also matches the jobs of tasks whose name starts
+		// with this one.
+		if j.Name != name {
+			continue
+		}
+		if err := s.purge(j.ID); err != nil {
+			if e, ok := err.(*httpError); ok && e.status == http.StatusNotFound {
+				continue
+			}
+			return err
+		}
+		log.Printf("Deleted task: %v (%v)\n", name, j.ID)
+	}
+	return nil
+}
+
+// InspectVolume inspects a volume through the Docker daemon of the node,
+// which is what the Nomad docker driver uses.
+func (s *nomad) InspectVolume(n node.Node, name string) (*scheduler.Volume, error) {
+	cfgNode := s.config.Lookup(n.MgmtIP)
+	docker, err := cfgNode.DockerClient()
+	if err != nil {
+		return nil, err
+	}
+
+	vol, err := docker.InspectVolume(name)
+	if err != nil {
+		return nil, err
+	}
+	return &scheduler.Volume{
+		Name:   vol.Name,
+		Driver: vol.Driver,
+	}, nil
+}
+
+func (s *nomad) DeleteVolume(n node.Node, name string) error {
+	cfgNode := s.config.Lookup(n.MgmtIP)
+	docker, err := cfgNode.DockerClient()
+	if err != nil {
+		return err
+	}
+
+	if err := docker.RemoveVolume(name); err != nil {
+		return err
+	}
+
+	if _, err := docker.InspectVolume(name); err == nil {
+		return fmt.Errorf("volume %v could not be deleted", name)
+	}
+	return nil
+}
+
+func (s *nomad) purge(id string) error {
+	if err := s.do("DELETE", "/v1/job/"+url.PathEscape(id)+"?purge=true", nil, nil); err != nil {
+		return err
+	}
+
+	s.Lock()
+	delete(s.jobs, id)
+	delete(s.allocs, id)
+	s.Unlock()
+	return nil
+}
+
+// latestAllocation returns the most recent allocation of a job, or nil if
+// the job has no allocations yet.
+func (s *nomad) latestAllocation(id string) (*allocation, error) {
+	allocs := []allocation{}
+	if err := s.do("GET", "/v1/job/"+url.PathEscape(id)+"/allocations", nil, &allocs); err != nil {
+		return nil, err
+	}
+
+	var latest *allocation
+	for i := range allocs {
+		if latest == nil || allocs[i].CreateIndex > latest.CreateIndex {
+			latest = &allocs[i]
+		}
+	}
+	if latest == nil {
+		return nil, nil
+	}
+
+	// The allocation list does not include the task events.
+	a := allocation{}
+	if err := s.do("GET", "/v1/allocation/"+latest.ID, nil, &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// allocationNode returns the node an allocation was placed on.
+func (s *nomad) allocationNode(a *allocation) (node.Node, error) {
+	nn := nomadNode{}
+	if err := s.do("GET", "/v1/node/"+a.NodeID, nil, &nn); err != nil {
+		return node.Node{}, err
+	}
+
+	host := nn.Attributes["unique.hostname"]
+	addr := strings.Split(nn.HTTPAddr, ":")[0]
+	for _, n := range s.nodes {
+		if n.Hostname == host || n.Hostname == nn.Name || n.MgmtIP == addr {
+			return n, nil
+		}
+	}
+	return node.Node{}, fmt.Errorf("Nomad node %v is not in the cluster", nn.Name)
+}
+
+// readLog reads the stdout or stderr of the task of an allocation.
+func (s *nomad) readLog(id, logType string) (string, error) {
+	query := url.Values{}
+	query.Set("task", taskName)
+	query.Set("type", logType)
+	query.Set("origin", "start")
+	query.Set("plain", "true")
+
+	data := bytes.NewBuffer(nil)
+	if err := s.do("GET", "/v1/client/fs/logs/"+id+"?"+query.Encode(), nil, data); err != nil {
+		return "", err
+	}
+	return data.String(), nil
+}
+
+// do sends a JSON request and decodes the JSON response into out.  If out
+// is a buffer, the response is copied into it as is.
+func (s *nomad) do(method, path string, in, out interface{}) error {
+	var body *bytes.Buffer
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewBuffer(data)
+	} else {
+		body = bytes.NewBuffer(nil)
+	}
+
+	request, err := http.NewRequest(method, s.endpoint+path, body)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		request.Header.Set("X-Nomad-Token", s.token)
+	}
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode >= http.StatusBadRequest {
+		return &httpError{status: response.StatusCode, body: string(data)}
+	}
+	if buf, ok := out.(*bytes.Buffer); ok {
+		_, err := buf.Write(data)
+		return err
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+func (e *taskEvent) message() string {
+	if e.DriverError != "" {
+		return e.DriverError
+	}
+	return e.DisplayMessage
+}
+
+// driverFailure returns the event of a task that could not be started, or
+// nil if the task started.
+func driverFailure(a *allocation) *taskEvent {
+	state := a.TaskStates[taskName]
+	for i := range state.Events {
+		if state.Events[i].Type == "Driver Failure" {
+			return &state.Events[i]
+		}
+	}
+	return nil
+}
+
+// terminal returns true if an allocation will not run again.
+func terminal(a *allocation) bool {
+	switch a.ClientStatus {
+	case "complete", "failed", "lost":
+		return true
+	}
+	return false
+}
+
+// exitStatus returns the exit status of the task of a terminated
+// allocation.
+func exitStatus(a *allocation) int {
+	state := a.TaskStates[taskName]
+	for i := len(state.Events) - 1; i >= 0; i-- {
+		if state.Events[i].Type == "Terminated" {
+			return state.Events[i].ExitCode
+		}
+	}
+	if a.ClientStatus == "complete" {
+		return 0
+	}
+	// The task was killed or lost before it exited.
+	return killedStatus
+}
+
+// hostname returns the hostname Nomad knows a node by.
+func hostname(n node.Node) string {
+	if n.Hostname != "" {
+		return n.Hostname
+	}
+	return n.MgmtIP
+}
+
+// options parses volume options of the form key=value.
+func options(opts []string) map[string]string {
+	parsed := make(map[string]string)
+	for _, opt := range opts {
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) == 2 {
+			parsed[kv[0]] = kv[1]
+		}
+	}
+	return parsed
+}
+
+func init() {
+	scheduler.Register("nomad", &nomad{})
+}
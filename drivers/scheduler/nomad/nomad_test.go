@@ -0,0 +1,292 @@
+package nomad
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/portworx/torpedo/config"
+	"github.com/portworx/torpedo/drivers/scheduler"
+)
+
+var addresses = []string{"192.0.2.1", "192.0.2.2"}
+
+// cluster stands in for the Nomad API.  Registering a job places a running
+// allocation on the first node that satisfies its constraint.
+type cluster struct {
+	sync.Mutex
+	t      *testing.T
+	jobs   map[string]*job
+	allocs map[string]*allocation
+	// jobAllocs holds the allocation IDs of each job.
+	jobAllocs map[string][]string
+	placed    int
+}
+
+func newCluster(t *testing.T) (*cluster, *httptest.Server) {
+	c := &cluster{
+		t:         t,
+		jobs:      make(map[string]*job),
+		allocs:    make(map[string]*allocation),
+		jobAllocs: make(map[string][]string),
+	}
+	return c, httptest.NewServer(c)
+}
+
+func (c *cluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.Lock()
+	defer c.Unlock()
+
+	path := r.URL.Path
+	switch {
+	case path == "/v1/status/leader":
+		c.reply(w, "192.0.2.1:4647")
+	case path == "/v1/jobs" && r.Method == "PUT":
+		request := registerRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c.register(request.Job)
+	case path == "/v1/jobs":
+		jobs := []jobStub{}
+		for id, j := range c.jobs {
+			if strings.HasPrefix(id, r.URL.Query().Get("prefix")) {
+				jobs = append(jobs, jobStub{ID: id, Name: j.Name})
+			}
+		}
+		c.reply(w, jobs)
+	case strings.HasPrefix(path, "/v1/job/"):
+		id := strings.TrimPrefix(path, "/v1/job/")
+		if strings.HasSuffix(id, "/allocations") {
+			allocs := []allocation{}
+			for _, a := range c.jobAllocs[strings.TrimSuffix(id, "/allocations")] {
+				allocs = append(allocs, allocation{ID: a, CreateIndex: c.allocs[a].CreateIndex})
+			}
+			c.reply(w, allocs)
+			return
+		}
+		if _, ok := c.jobs[id]; !ok || r.Method != "DELETE" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Query().Get("purge") == "true" {
+			delete(c.jobs, id)
+		}
+	case strings.HasPrefix(path, "/v1/allocation/"):
+		a, ok := c.allocs[strings.TrimPrefix(path, "/v1/allocation/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		c.reply(w, a)
+	case strings.HasPrefix(path, "/v1/node/"):
+		id := strings.TrimPrefix(path, "/v1/node/")
+		c.reply(w, nomadNode{
+			ID:         id,
+			Name:       id,
+			HTTPAddr:   id + ":4646",
+			Attributes: map[string]string{"unique.hostname": id},
+		})
+	case strings.HasPrefix(path, "/v1/client/fs/logs/"):
+		if _, err := w.Write([]byte(r.URL.Query().Get("type") + " of " + strings.TrimPrefix(path, "/v1/client/fs/logs/"))); err != nil {
+			c.t.Error(err)
+		}
+	default:
+		c.t.Errorf("unexpected request %v %v", r.Method, r.URL)
+		http.NotFound(w, r)
+	}
+}
+
+func (c *cluster) reply(w http.ResponseWriter, out interface{}) {
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		c.t.Error(err)
+	}
+}
+
+// register places an allocation for a job.  Registering a job again
+// replaces its running allocation, as Nomad does.
+func (c *cluster) register(j *job) {
+	for _, id := range c.jobAllocs[j.ID] {
+		if a := c.allocs[id]; !terminal(a) {
+			a.DesiredStatus = "stop"
+			a.ClientStatus = "complete"
+		}
+	}
+	c.jobs[j.ID] = j
+
+	host := addresses[0]
+	for _, con := range j.Constraints {
+		if con.Operand == "!=" && con.RTarget == host {
+			host = addresses[1]
+		}
+	}
+
+	c.placed++
+	id := "alloc-" + strconv.Itoa(c.placed)
+	c.allocs[id] = &allocation{
+		ID:            id,
+		NodeID:        host,
+		DesiredStatus: "run",
+		ClientStatus:  "running",
+		CreateIndex:   uint64(c.placed),
+		TaskStates:    map[string]taskState{taskName: {State: "running"}},
+	}
+	c.jobAllocs[j.ID] = append(c.jobAllocs[j.ID], id)
+}
+
+// exit terminates the running allocation of a job with the given code.
+func (c *cluster) exit(id string, code int) {
+	c.Lock()
+	defer c.Unlock()
+
+	for _, alloc := range c.jobAllocs[id] {
+		a := c.allocs[alloc]
+		if terminal(a) {
+			continue
+		}
+		a.ClientStatus = "complete"
+		if code != 0 {
+			a.ClientStatus = "failed"
+		}
+		a.TaskStates[taskName] = taskState{
+			State:  "dead",
+			Failed: code != 0,
+			Events: []taskEvent{{Type: "Terminated", ExitCode: code}},
+		}
+	}
+}
+
+// running returns the number of running allocations of a job.
+func (c *cluster) running(id string) int {
+	c.Lock()
+	defer c.Unlock()
+
+	running := 0
+	for _, alloc := range c.jobAllocs[id] {
+		if !terminal(c.allocs[alloc]) {
+			running++
+		}
+	}
+	return running
+}
+
+func newTestDriver(t *testing.T) (*nomad, *cluster) {
+	c, server := newCluster(t)
+	t.Cleanup(server.Close)
+
+	cfg := config.FromAddresses(addresses)
+	cfg.Scheduler.Endpoint = server.URL
+	s := &nomad{}
+	if err := s.Init(cfg); err != nil {
+		t.Fatal(err)
+	}
+	return s, c
+}
+
+func newTask(s *nomad) scheduler.Task {
+	return scheduler.Task{
+		Name:      "testTask",
+		Img:       "busybox",
+		Tag:       "latest",
+		Node:      s.nodes[0],
+		Placement: scheduler.LocalHost,
+		Vol: scheduler.Volume{
+			Name:   "vol",
+			Driver: "pxd",
+			Path:   "/mnt",
+		},
+	}
+}
+
+func TestTasksWithTheSameNameRunTogether(t *testing.T) {
+	s, c := newTestDriver(t)
+	first, err := s.Create(newTask(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := s.Create(newTask(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.ID == second.ID {
+		t.Fatalf("expected the tasks to get different jobs, both got %v", first.ID)
+	}
+
+	if err := s.Schedule(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Schedule(second); err != nil {
+		t.Fatal(err)
+	}
+	if c.running(first.ID) != 1 || c.running(second.ID) != 1 {
+		t.Errorf("expected both tasks to keep running")
+	}
+	if s.allocs[first.ID] == s.allocs[second.ID] {
+		t.Errorf("expected the tasks to have different allocations, both have %v", s.allocs[first.ID])
+	}
+}
+
+func TestRunReportsTheExitStatus(t *testing.T) {
+	s, c := newTestDriver(t)
+	task := newTask(s)
+	task.Placement = scheduler.ExternalHost
+	ctx, err := s.Create(task)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Schedule(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ctx.Task.Node.MgmtIP != addresses[1] {
+		t.Errorf("expected the task to run on %v, it runs on %v", addresses[1], ctx.Task.Node.MgmtIP)
+	}
+
+	c.exit(ctx.ID, 5)
+	if err := s.WaitDone(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ctx.Status != 5 {
+		t.Errorf("expected exit status 5, got %v", ctx.Status)
+	}
+	if want := "stdout of " + s.allocs[ctx.ID]; ctx.Stdout != want {
+		t.Errorf("expected stdout %q, got %q", want, ctx.Stdout)
+	}
+}
+
+func TestDestroyByNamePurgesEveryJob(t *testing.T) {
+	s, c := newTestDriver(t)
+	for i := 0; i < 2; i++ {
+		if _, err := s.Create(newTask(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	other := newTask(s)
+	other.Name = "testTaskOther"
+	for _, task := range []scheduler.Task{newTask(s), other} {
+		ctx, err := s.Create(task)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Schedule(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.DestroyByName(s.nodes[0], "testTask"); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.jobs) != 1 {
+		t.Errorf("expected only the job of testTaskOther to remain, got %v jobs", len(c.jobs))
+	}
+	for _, j := range c.jobs {
+		if j.Name != other.Name {
+			t.Errorf("expected the job of %v to remain, got %v", other.Name, j.Name)
+		}
+	}
+}
@@ -2,14 +2,9 @@ package scheduler
 
 import (
 	"errors"
-	"os"
-	"strings"
 
 	"github.com/portworx/torpedo/drivers"
-)
-
-var (
-	nodes []string
+	"github.com/portworx/torpedo/drivers/node"
 )
 
 const (
@@ -18,6 +13,10 @@ const (
 	// ExternalHost will pick any other host in the cluster other than the
 	// one the task is created on.
 	ExternalHost = "externalhost"
+
+	// IOErrorStatus is the exit status of a task whose workload failed with
+	// EIO.  It is the errno of EIO.
+	IOErrorStatus = 5
 )
 
 // Volume specifies the parameters for creating an external volume.
@@ -37,7 +36,10 @@ type Task struct {
 	Env  []string
 	Cmd  []string
 	Vol  Volume
-	IP   string
+	// Node is the node the task is created on.
+	Node node.Node
+	// Placement is either LocalHost or ExternalHost.  Defaults to LocalHost.
+	Placement string
 }
 
 // Context holds the execution context and output values of a test task.
@@ -55,9 +57,10 @@ type Driver interface {
 	drivers.Driver
 
 	// GetNodes returns an array of all nodes in the cluster.
-	GetNodes() ([]string, error)
+	GetNodes() ([]node.Node, error)
 
-	// Create creates a task context.  Does not start the task.
+	// Create creates a task context.  Does not start the task.  The task
+	// in the returned context is pinned to the node it was placed on.
 	Create(Task) (*Context, error)
 
 	// Schedule starts a task
@@ -73,28 +76,27 @@ type Driver interface {
 	Destroy(*Context) error
 
 	// DestroyByName removes a task by name.  Must also delete the external volume.
-	DestroyByName(ip, name string) error
+	DestroyByName(n node.Node, name string) error
 
 	// InspectVolume inspects a storage volume.
-	InspectVolume(ip, name string) (*Volume, error)
+	InspectVolume(n node.Node, name string) (*Volume, error)
 
 	// DeleteVolume will delete a storage volume.
-	DeleteVolume(ip, name string) error
+	DeleteVolume(n node.Node, name string) error
 }
 
 var (
 	schedulers = make(map[string]Driver)
 )
 
-func register(name string, d Driver) error {
+// Register registers a scheduler test provider.
+func Register(name string, d Driver) error {
 	schedulers[name] = d
 	return nil
 }
 
 // Get returns a registered scheduler test provider.
 func Get(name string) (Driver, error) {
-	nodes = strings.Split(os.Getenv("CLUSTER_NODES"), ",")
-
 	if d, ok := schedulers[name]; ok {
 		return d, nil
 	}
@@ -4,130 +4,128 @@ import (
 	"bytes"
 	"fmt"
 	"log"
-	"net"
-	"os"
+	"strconv"
+	"sync"
 
 	dockerclient "github.com/fsouza/go-dockerclient"
 
+	"github.com/portworx/torpedo/config"
+	"github.com/portworx/torpedo/drivers/node"
 	"github.com/portworx/torpedo/drivers/scheduler"
 )
 
+const (
+	// modeEngine runs tasks as plain containers on the Docker engines.
+	modeEngine = "engine"
+	// modeServices runs tasks as Swarm services.
+	modeServices = "services"
+)
+
 type swarm struct {
+	sync.Mutex
+	config *config.Config
+	nodes  []node.Node
+	// services is true if tasks run as Swarm services, in which case
+	// Swarm places them and reschedules them when a node fails.
+	services bool
+	// restarts is how many times Swarm reschedules a failed task.  Tasks
+	// are not rescheduled by default.
+	restarts uint64
+	// created is the number of services created, which numbers the
+	// service names.
+	created int
 }
 
-func ifaceToIP(iface *net.Interface) (string, error) {
-	addrs, err := iface.Addrs()
-	if err != nil {
-		return "", err
-	}
-	for _, addr := range addrs {
-		var ip net.IP
-		switch v := addr.(type) {
-		case *net.IPNet:
-			ip = v.IP
-		case *net.IPAddr:
-			ip = v.IP
-		}
-		if ip == nil || ip.IsLoopback() {
-			continue
-		}
-		ip = ip.To4()
-		if ip == nil {
-			continue // not an ipv4 address
-		}
-		if ip.String() == "" {
-			continue // address is empty string
-		}
-		return ip.String(), nil
+// place returns the node a task runs on, based on its placement.
+func (s *swarm) place(t scheduler.Task) (node.Node, error) {
+	if t.Placement != scheduler.ExternalHost {
+		return t.Node, nil
 	}
 
-	return "", fmt.Errorf("node not connected to the network")
-}
-
-func connect(ip string) (*dockerclient.Client, string, error) {
-	if ip == ExternalHost {
-		// Find any other host except this one.
-		ifaces, err := net.Interfaces()
-		if err != nil {
-			return nil, "", err
-		}
-
-		for _, n := range nodes {
-			localIP := false
-			for _, iface := range ifaces {
-				if iface.Flags&net.FlagUp == 0 {
-					continue // interface down
-				}
-				if iface.Flags&net.FlagLoopback != 0 {
-					continue // loopback interface
-				}
-
-				ifaceIP, err := ifaceToIP(&iface)
-				if err != nil {
-					continue
-				}
-
-				if ifaceIP == n {
-					localIP = true
-					break
-				}
-			}
-
-			if !localIP {
-				if n == "" {
-					return nil, "", fmt.Errorf("not enough Docker hosts in this cluster")
-				}
-				log.Printf("Selecting Docker host %v\n", n)
-				ip = n
-				break
-			}
+	// Find any other host except the one the task was created on.
+	for _, n := range s.nodes {
+		if n.ID != t.Node.ID {
+			log.Printf("Selecting Docker host %v\n", n.MgmtIP)
+			return n, nil
 		}
 	}
+	return node.Node{}, fmt.Errorf("cannot find any other Docker host in the cluster")
+}
 
-	if ip == ExternalHost {
-		return nil, "", fmt.Errorf("cannot find any other Docker host in the cluster")
-	}
-
-	endpoint := ""
-	if ip == "" {
-		if endpoint = os.Getenv("DOCKER_HOST"); endpoint == "" {
-			endpoint = "unix:///var/run/docker.sock"
-		}
+func (s *swarm) connect(n node.Node) (*dockerclient.Client, error) {
+	var docker *dockerclient.Client
+	var err error
+	if n.MgmtIP == "" {
+		docker, err = dockerclient.NewClientFromEnv()
 	} else {
-		endpoint = "http://" + ip + ":2375"
+		cfgNode := s.config.Lookup(n.MgmtIP)
+		docker, err = cfgNode.DockerClient()
 	}
-
-	docker, err := dockerclient.NewClient(endpoint)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
 	if err = docker.Ping(); err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
-	return docker, ip, nil
+	return docker, nil
 }
 
-func (s *swarm) Init() error {
+func (s *swarm) Init(cfg *config.Config) error {
+	nodes, err := node.FromConfig(cfg)
+	if err != nil {
+		return err
+	}
+	s.config = cfg
+	s.nodes = nodes
+
+	switch mode := cfg.Scheduler.Options["mode"]; mode {
+	case "", modeEngine:
+		s.services = false
+	case modeServices:
+		s.services = true
+	default:
+		return fmt.Errorf("unknown swarm mode %v", mode)
+	}
+
+	s.restarts = 0
+	if restarts, ok := cfg.Scheduler.Options["restarts"]; ok {
+		if s.restarts, err = strconv.ParseUint(restarts, 10, 64); err != nil {
+			return fmt.Errorf("invalid restarts %v: %v", restarts, err)
+		}
+	}
+
 	log.Printf("Using the Docker scheduler swarm.\n")
-	log.Printf("The following hosts are in the cluster: %v.\n", nodes)
+	if s.services {
+		log.Printf("Tasks run as Swarm services.\n")
+	}
+	log.Printf("The following hosts are in the cluster: %v.\n", cfg.Addresses())
 	return nil
 }
 
-func (s *swarm) GetNodes() ([]string, error) {
-	return nodes, nil
+func (s *swarm) GetNodes() ([]node.Node, error) {
+	return s.nodes, nil
 }
 
-func (s *swarm) Create(t Task) (*Context, error) {
-	context := Context{}
+func (s *swarm) Create(t scheduler.Task) (*scheduler.Context, error) {
+	if s.services {
+		return s.createService(t)
+	}
+
+	context := scheduler.Context{}
 
-	docker, ip, err := connect(t.IP)
+	n, err := s.place(t)
 	if err != nil {
 		return nil, err
 	}
+	t.Node = n
+	t.Placement = scheduler.LocalHost
 
-	t.IP = ip
+	docker, err := s.connect(t.Node)
+	if err != nil {
+		return nil, err
+	}
 
 	po := dockerclient.PullImageOptions{
 		Repository: t.Img,
@@ -177,8 +175,15 @@ func (s *swarm) Create(t Task) (*Context, error) {
 }
 
 // Run to completion.
-func (s *swarm) Run(ctx *Context) error {
-	docker, _, err := connect(ctx.Task.IP)
+func (s *swarm) Run(ctx *scheduler.Context) error {
+	if s.services {
+		if err := s.scheduleService(ctx); err != nil {
+			return err
+		}
+		return s.waitService(ctx)
+	}
+
+	docker, err := s.connect(ctx.Task.Node)
 	if err != nil {
 		return err
 	}
@@ -236,8 +241,12 @@ func (s *swarm) Run(ctx *Context) error {
 	return nil
 }
 
-func (s *swarm) Schedule(ctx *Context) error {
-	docker, _, err := connect(ctx.Task.IP)
+func (s *swarm) Schedule(ctx *scheduler.Context) error {
+	if s.services {
+		return s.scheduleService(ctx)
+	}
+
+	docker, err := s.connect(ctx.Task.Node)
 	if err != nil {
 		return err
 	}
@@ -260,8 +269,12 @@ func (s *swarm) Schedule(ctx *Context) error {
 	return nil
 }
 
-func (s *swarm) WaitDone(ctx *Context) error {
-	docker, _, err := connect(ctx.Task.IP)
+func (s *swarm) WaitDone(ctx *scheduler.Context) error {
+	if s.services {
+		return s.waitService(ctx)
+	}
+
+	docker, err := s.connect(ctx.Task.Node)
 	if err != nil {
 		return err
 	}
@@ -304,8 +317,12 @@ func (s *swarm) WaitDone(ctx *Context) error {
 	return nil
 }
 
-func (s *swarm) Destroy(ctx *Context) error {
-	docker, _, err := connect(ctx.Task.IP)
+func (s *swarm) Destroy(ctx *scheduler.Context) error {
+	if s.services {
+		return s.destroyService(ctx.ID, ctx.Task.Name)
+	}
+
+	docker, err := s.connect(ctx.Task.Node)
 	if err != nil {
 		return err
 	}
@@ -323,8 +340,12 @@ func (s *swarm) Destroy(ctx *Context) error {
 	return nil
 }
 
-func (s *swarm) DestroyByName(ip, name string) error {
-	docker, _, err := connect(ip)
+func (s *swarm) DestroyByName(n node.Node, name string) error {
+	if s.services {
+		return s.destroyServiceByName(name)
+	}
+
+	docker, err := s.connect(n)
 	if err != nil {
 		return err
 	}
@@ -376,8 +397,8 @@ func (s *swarm) DestroyByName(ip, name string) error {
 	return nil
 }
 
-func (s *swarm) InspectVolume(ip, name string) (*Volume, error) {
-	docker, _, err := connect(ip)
+func (s *swarm) InspectVolume(n node.Node, name string) (*scheduler.Volume, error) {
+	docker, err := s.connect(n)
 	if err != nil {
 		return nil, err
 	}
@@ -387,15 +408,15 @@ func (s *swarm) InspectVolume(ip, name string) (*Volume, error) {
 		return nil, err
 	}
 	// TODO: Get volume size in a generic way.
-	v := Volume{
+	v := scheduler.Volume{
 		// Size:   sz,
 		Driver: vol.Driver,
 	}
 	return &v, nil
 }
 
-func (s *swarm) DeleteVolume(ip, name string) error {
-	docker, _, err := connect(ip)
+func (s *swarm) DeleteVolume(n node.Node, name string) error {
+	docker, err := s.connect(n)
 	if err != nil {
 		return err
 	}
@@ -414,5 +435,5 @@ func (s *swarm) DeleteVolume(ip, name string) error {
 }
 
 func init() {
-	scheduler.register("swarm", &swarm{})
+	scheduler.Register("swarm", &swarm{})
 }
@@ -0,0 +1,405 @@
+package swarm
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/mount"
+	dockerswarm "github.com/docker/docker/api/types/swarm"
+	dockerclient "github.com/fsouza/go-dockerclient"
+
+	"github.com/portworx/torpedo/drivers/node"
+	"github.com/portworx/torpedo/drivers/scheduler"
+)
+
+const (
+	// pollInterval is how often the tasks of a service are polled.
+	pollInterval = time.Second
+	// scheduleTimeout is how long to wait for a service task to start.
+	scheduleTimeout = 5 * time.Minute
+	// waitTimeout is how long to wait for a service task to be done.
+	waitTimeout = 30 * time.Minute
+	// taskLabel holds the name of the task of a service.
+	taskLabel = "torpedo.task"
+)
+
+// manager returns a client for a Swarm manager.  The scheduler endpoint is
+// used if it is set, otherwise the first node that is a manager is used.
+func (s *swarm) manager() (*dockerclient.Client, error) {
+	if s.config.Scheduler.Endpoint != "" {
+		docker, err := dockerclient.NewClient(s.config.Scheduler.Endpoint)
+		if err != nil {
+			return nil, err
+		}
+		return docker, docker.Ping()
+	}
+
+	for _, n := range s.nodes {
+		docker, err := s.connect(n)
+		if err != nil {
+			continue
+		}
+		info, err := docker.Info()
+		if err != nil {
+			continue
+		}
+		if info.Swarm.ControlAvailable {
+			return docker, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot find a Swarm manager in the cluster")
+}
+
+// createService creates a service with no replicas for a task.  The
+// service is scaled up when the task is scheduled.  Each task gets its own
+// service, so that a task can be created again while an earlier one still
+// exists.
+func (s *swarm) createService(t scheduler.Task) (*scheduler.Context, error) {
+	docker, err := s.manager()
+	if err != nil {
+		return nil, err
+	}
+
+	s.Lock()
+	s.created++
+	name := t.Name + "-" + strconv.Itoa(s.created)
+	s.Unlock()
+
+	var replicas uint64
+	spec := dockerswarm.ServiceSpec{
+		Annotations: dockerswarm.Annotations{
+			Name: name,
+			Labels: map[string]string{
+				"torpedo": "true",
+				taskLabel: t.Name,
+			},
+		},
+		TaskTemplate: dockerswarm.TaskSpec{
+			ContainerSpec: dockerswarm.ContainerSpec{
+				Image: t.Img + ":" + t.Tag,
+				Args:  t.Cmd,
+				Env:   t.Env,
+			},
+			RestartPolicy: s.restartPolicy(),
+			Placement: &dockerswarm.Placement{
+				Constraints: constraints(t),
+			},
+		},
+		Mode: dockerswarm.ServiceMode{
+			Replicated: &dockerswarm.ReplicatedService{
+				Replicas: &replicas,
+			},
+		},
+	}
+	if t.Vol.Name != "" {
+		spec.TaskTemplate.ContainerSpec.Mounts = []mount.Mount{
+			{
+				Type:   mount.TypeVolume,
+				Source: t.Vol.Name,
+				Target: t.Vol.Path,
+				VolumeOptions: &mount.VolumeOptions{
+					DriverConfig: &mount.Driver{
+						Name:    t.Vol.Driver,
+						Options: options(t.Vol.Opt),
+					},
+				},
+			},
+		}
+	}
+
+	service, err := docker.CreateService(dockerclient.CreateServiceOptions{
+		ServiceSpec: spec,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &scheduler.Context{
+		ID:   service.ID,
+		Task: t,
+	}, nil
+}
+
+// scheduleService scales the service of a task to one replica and waits for
+// its task to run.  The task in the context is then pinned to the node that
+// Swarm placed it on, and the placement constraints are dropped so that
+// Swarm can reschedule the task on any node.
+func (s *swarm) scheduleService(ctx *scheduler.Context) error {
+	docker, err := s.manager()
+	if err != nil {
+		return err
+	}
+
+	service, err := docker.InspectService(ctx.ID)
+	if err != nil {
+		return err
+	}
+	replicas := uint64(1)
+	service.Spec.Mode.Replicated.Replicas = &replicas
+	if err := docker.UpdateService(ctx.ID, dockerclient.UpdateServiceOptions{
+		ServiceSpec: service.Spec,
+		Version:     service.Version.Index,
+	}); err != nil {
+		return err
+	}
+
+	for start := time.Now(); time.Since(start) < scheduleTimeout; time.Sleep(pollInterval) {
+		task, err := latestTask(docker, ctx.ID)
+		if err != nil {
+			return err
+		}
+		if task == nil {
+			continue
+		}
+
+		switch task.Status.State {
+		case dockerswarm.TaskStateRunning,
+			dockerswarm.TaskStateComplete,
+			dockerswarm.TaskStateFailed:
+		case dockerswarm.TaskStateRejected:
+			return fmt.Errorf(
+				"task %v was rejected: %v",
+				ctx.Task.Name,
+				task.Status.Err,
+			)
+		default:
+			continue
+		}
+
+		n, err := s.taskNode(docker, task)
+		if err != nil {
+			return err
+		}
+		log.Printf("Task %v is running on %v\n", ctx.Task.Name, n.Hostname)
+		ctx.Task.Node = n
+		ctx.Task.Placement = scheduler.LocalHost
+		return release(docker, ctx.ID)
+	}
+
+	return fmt.Errorf("task %v did not start in time", ctx.Task.Name)
+}
+
+// waitService waits until Swarm stops rescheduling the service of a task,
+// and collects the exit status and output of its last task.
+func (s *swarm) waitService(ctx *scheduler.Context) error {
+	docker, err := s.manager()
+	if err != nil {
+		return err
+	}
+
+	var task *dockerswarm.Task
+	for start := time.Now(); ; time.Sleep(pollInterval) {
+		if task, err = latestTask(docker, ctx.ID); err != nil {
+			return err
+		}
+		if task != nil && done(task) {
+			break
+		}
+		if time.Since(start) >= waitTimeout {
+			return fmt.Errorf("task %v did not finish in time", ctx.Task.Name)
+		}
+	}
+	if task.Status.State == dockerswarm.TaskStateRejected {
+		return fmt.Errorf(
+			"task %v was rejected: %v",
+			ctx.Task.Name,
+			task.Status.Err,
+		)
+	}
+
+	n, err := s.taskNode(docker, task)
+	if err != nil {
+		return err
+	}
+	ctx.Task.Node = n
+	engine, err := s.connect(n)
+	if err != nil {
+		return err
+	}
+
+	id := task.Status.ContainerStatus.ContainerID
+	if ctx.Stdout, err = logs(engine, id, true); err != nil {
+		return err
+	}
+	if ctx.Stderr, err = logs(engine, id, false); err != nil {
+		return err
+	}
+	ctx.Status = task.Status.ContainerStatus.ExitCode
+
+	return nil
+}
+
+func (s *swarm) destroyService(id, name string) error {
+	docker, err := s.manager()
+	if err != nil {
+		return err
+	}
+
+	if err := docker.RemoveService(dockerclient.RemoveServiceOptions{
+		ID: id,
+	}); err != nil {
+		return err
+	}
+
+	log.Printf("Deleted task: %v\n", name)
+	return nil
+}
+
+// destroyServiceByName removes the services of every task with the given
+// name.
+func (s *swarm) destroyServiceByName(name string) error {
+	docker, err := s.manager()
+	if err != nil {
+		return err
+	}
+
+	services, err := docker.ListServices(dockerclient.ListServicesOptions{
+		Filters: map[string][]string{"label": {taskLabel + "=" + name}},
+	})
+	if err != nil {
+		return err
+	}
+	for _, service := range services {
+		if err := s.destroyService(service.ID, name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// taskNode returns the node a Swarm task was placed on.
+func (s *swarm) taskNode(docker *dockerclient.Client, task *dockerswarm.Task) (node.Node, error) {
+	info, err := docker.InspectNode(task.NodeID)
+	if err != nil {
+		return node.Node{}, err
+	}
+
+	for _, n := range s.nodes {
+		if n.Hostname == info.Description.Hostname ||
+			n.MgmtIP == info.Status.Addr {
+			return n, nil
+		}
+	}
+	return node.Node{}, fmt.Errorf(
+		"Swarm node %v is not in the cluster",
+		info.Description.Hostname,
+	)
+}
+
+// restartPolicy returns the restart policy of the services.  Swarm does not
+// restart or reschedule tasks unless restarts are enabled, since a task that
+// is restarted once its placement is released may run again on any node,
+// and its exit status would hide the one of the task that failed.
+func (s *swarm) restartPolicy() *dockerswarm.RestartPolicy {
+	if s.restarts == 0 {
+		return &dockerswarm.RestartPolicy{
+			Condition: dockerswarm.RestartPolicyConditionNone,
+		}
+	}
+	restarts := s.restarts
+	return &dockerswarm.RestartPolicy{
+		Condition:   dockerswarm.RestartPolicyConditionOnFailure,
+		MaxAttempts: &restarts,
+	}
+}
+
+// release drops the placement constraints of a service whose task has been
+// placed.  Swarm does not restart a task when only the constraints of its
+// service change and its node still satisfies them, so the task keeps
+// running where it is, but is rescheduled on any node if it has to move.
+func release(docker *dockerclient.Client, id string) error {
+	service, err := docker.InspectService(id)
+	if err != nil {
+		return err
+	}
+	placement := service.Spec.TaskTemplate.Placement
+	if placement == nil || len(placement.Constraints) == 0 {
+		return nil
+	}
+
+	placement.Constraints = nil
+	return docker.UpdateService(id, dockerclient.UpdateServiceOptions{
+		ServiceSpec: service.Spec,
+		Version:     service.Version.Index,
+	})
+}
+
+// latestTask returns the most recently created task of a service, or nil if
+// the service has no tasks yet.
+func latestTask(docker *dockerclient.Client, service string) (*dockerswarm.Task, error) {
+	tasks, err := docker.ListTasks(dockerclient.ListTasksOptions{
+		Filters: map[string][]string{"service": {service}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var latest *dockerswarm.Task
+	for i := range tasks {
+		if latest == nil || tasks[i].CreatedAt.After(latest.CreatedAt) {
+			latest = &tasks[i]
+		}
+	}
+	return latest, nil
+}
+
+// done returns true if a task has terminated and Swarm will not replace it.
+func done(task *dockerswarm.Task) bool {
+	if task.DesiredState == dockerswarm.TaskStateRunning {
+		return false
+	}
+
+	switch task.Status.State {
+	case dockerswarm.TaskStateComplete,
+		dockerswarm.TaskStateFailed,
+		dockerswarm.TaskStateRejected,
+		dockerswarm.TaskStateShutdown:
+		return true
+	}
+	return false
+}
+
+// constraints places a task on the node it was created for, or keeps it off
+// that node.  They only hold until the task is first placed.
+func constraints(t scheduler.Task) []string {
+	if t.Node.Hostname == "" {
+		return nil
+	}
+	if t.Placement == scheduler.ExternalHost {
+		return []string{"node.hostname != " + t.Node.Hostname}
+	}
+	return []string{"node.hostname == " + t.Node.Hostname}
+}
+
+// options parses volume options of the form key=value.
+func options(opts []string) map[string]string {
+	m := make(map[string]string)
+	for _, opt := range opts {
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) == 2 {
+			m[kv[0]] = kv[1]
+		}
+	}
+	return m
+}
+
+func logs(docker *dockerclient.Client, id string, stdout bool) (string, error) {
+	buf := bytes.NewBuffer([]byte(""))
+	lo := dockerclient.LogsOptions{
+		Container:    id,
+		Stdout:       stdout,
+		Stderr:       !stdout,
+		RawTerminal:  false,
+		Timestamps:   false,
+		OutputStream: buf,
+	}
+	if err := docker.Logs(lo); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,105 @@
+package csi
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/portworx/torpedo/drivers/node"
+	"github.com/portworx/torpedo/drivers/volume"
+)
+
+const (
+	// Name is the name the CSI volume driver is registered under.
+	Name = "csi"
+	// DefaultEndpoint is the endpoint of the CSI plugin if none is
+	// configured.
+	DefaultEndpoint = "unix:///var/lib/torpedo/csi/csi.sock"
+)
+
+// Plugin stops and starts the CSI plugin on a node.
+type Plugin interface {
+	// Stop makes the CSI plugin exit or get killed on a node.
+	Stop(n node.Node) error
+	// Start starts the CSI plugin on a node.
+	Start(n node.Node) error
+}
+
+// Driver is a volume driver for any CSI plugin.  It acts as the container
+// orchestrator towards the plugin, and talks to it over its gRPC endpoint
+// with the Identity, Controller and Node services.
+//
+// The Create, Mount, Unmount and Delete functions orchestrate the lifecycle
+// of a volume the way a CSI enabled scheduler does.  They are used by
+// schedulers that manage task volumes through the volume driver, such as
+// the fake scheduler, so that the failure scenarios run against the plugin.
+type Driver interface {
+	volume.Driver
+
+	// Create creates a volume with CreateVolume.  The name can be an
+	// inline volume specification, such as size=10G,name=foo, in which
+	// case the size is the requested capacity and the other options are
+	// passed to the plugin as parameters.
+	Create(n node.Node, name string) error
+
+	// Mount makes a volume available on a node with ControllerPublishVolume,
+	// NodeStageVolume and NodePublishVolume, as supported by the plugin.
+	Mount(n node.Node, name string) error
+
+	// Unmount reverses Mount on a node with NodeUnpublishVolume,
+	// NodeUnstageVolume and ControllerUnpublishVolume.
+	Unmount(n node.Node, name string) error
+
+	// Delete deletes a volume with DeleteVolume.
+	Delete(n node.Node, name string) error
+
+	// Exists returns true if the volume was created and not deleted.
+	Exists(name string) bool
+}
+
+// New returns a CSI volume driver that stops and starts the plugin with the
+// given plugin control.  If plugin is nil, the plugin is expected to run in
+// the Docker container set with the container volume option.
+func New(plugin Plugin) Driver {
+	return newDriver(plugin)
+}
+
+// ParseEndpoint splits a CSI endpoint such as unix:///run/csi.sock or
+// tcp://10.0.0.1:10000 into a network and an address.
+func ParseEndpoint(endpoint string) (string, string, error) {
+	for _, network := range []string{"unix", "tcp"} {
+		prefix := network + "://"
+		if strings.HasPrefix(strings.ToLower(endpoint), prefix) {
+			address := endpoint[len(prefix):]
+			if address == "" {
+				break
+			}
+			return network, address, nil
+		}
+	}
+	return "", "", fmt.Errorf("invalid CSI endpoint %v", endpoint)
+}
+
+// Dial connects to a CSI endpoint.  The connection is established lazily,
+// so that a plugin that is down only fails the calls made to it.
+func Dial(endpoint string) (*grpc.ClientConn, error) {
+	network, address, err := ParseEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	return grpc.Dial(
+		address,
+		grpc.WithInsecure(),
+		grpc.WithDialer(func(addr string, timeout time.Duration) (net.Conn, error) {
+			return net.DialTimeout(network, addr, timeout)
+		}),
+	)
+}
+
+func init() {
+	volume.Register(Name, New(nil))
+}
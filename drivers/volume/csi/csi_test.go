@@ -0,0 +1,157 @@
+package csi_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/portworx/torpedo/config"
+	"github.com/portworx/torpedo/drivers/node"
+	"github.com/portworx/torpedo/drivers/volume/csi"
+	"github.com/portworx/torpedo/drivers/volume/csi/mock"
+)
+
+const spec = "size=2G,name=vol,repl=2"
+
+// newTestDriver serves the mock plugin for two nodes, and returns a driver
+// that uses the plugin of the first node as the controller.
+func newTestDriver(t *testing.T) (csi.Driver, mock.Plugin, node.Node, node.Node) {
+	dir := t.TempDir()
+	cfg := config.FromAddresses([]string{"192.0.2.1", "192.0.2.2"})
+	nodes, err := node.FromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plugin := mock.New()
+	t.Cleanup(plugin.Close)
+	for _, n := range nodes {
+		if err := plugin.Serve(n, "unix://"+filepath.Join(dir, n.ID+".sock")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg.Volume.Endpoint = "unix://" + filepath.Join(dir, nodes[0].ID+".sock")
+	cfg.Volume.Options = map[string]string{
+		"nodeEndpoint": "unix://" + filepath.Join(dir, "{id}.sock"),
+	}
+
+	d := csi.New(plugin)
+	if err := d.Init(cfg); err != nil {
+		t.Fatal(err)
+	}
+	return d, plugin, nodes[0], nodes[1]
+}
+
+func inspect(t *testing.T, plugin mock.Plugin) *mock.Volume {
+	vol, err := plugin.Inspect("vol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return vol
+}
+
+func TestVersion(t *testing.T) {
+	d, _, _, _ := newTestDriver(t)
+	version, err := d.Version()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := mock.PluginName + " " + mock.PluginVersion; version != want {
+		t.Errorf("expected version %q, got %q", want, version)
+	}
+}
+
+func TestCreatePassesTheSpec(t *testing.T) {
+	d, plugin, x, _ := newTestDriver(t)
+	if err := d.Create(x, spec); err != nil {
+		t.Fatal(err)
+	}
+	// Creating an existing volume succeeds.
+	if err := d.Create(x, spec); err != nil {
+		t.Fatal(err)
+	}
+
+	vol := inspect(t, plugin)
+	if vol.CapacityBytes != 2<<30 {
+		t.Errorf("expected a 2G volume, got %v bytes", vol.CapacityBytes)
+	}
+	if vol.Parameters["repl"] != "2" || len(vol.Parameters) != 1 {
+		t.Errorf("expected the parameters repl=2, got %v", vol.Parameters)
+	}
+}
+
+func TestMountAndUnmount(t *testing.T) {
+	d, plugin, x, y := newTestDriver(t)
+	if err := d.Create(x, spec); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Mount(y, spec); err != nil {
+		t.Fatal(err)
+	}
+
+	vol := inspect(t, plugin)
+	if vol.PublishedOn != y.ID || vol.Staged[y.ID] == "" || len(vol.Targets[y.ID]) != 1 {
+		t.Fatalf("expected the volume to be published, staged and mounted on %v, got %+v", y.ID, vol)
+	}
+	// A single node writer cannot be mounted on another node.
+	if err := d.Mount(x, spec); err == nil {
+		t.Errorf("expected Mount on %v to fail while the volume is mounted on %v", x.ID, y.ID)
+	}
+
+	if err := d.Unmount(y, spec); err != nil {
+		t.Fatal(err)
+	}
+	vol = inspect(t, plugin)
+	if vol.PublishedOn != "" || len(vol.Staged) != 0 || len(vol.Targets[y.ID]) != 0 {
+		t.Errorf("expected the volume to be unmounted everywhere, got %+v", vol)
+	}
+	if err := d.Mount(x, spec); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStoppedPluginFailsCalls(t *testing.T) {
+	d, _, x, y := newTestDriver(t)
+	if err := d.Create(x, spec); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.StopDriver(y); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Mount(y, spec); err == nil {
+		t.Fatalf("expected Mount to fail while the plugin is stopped on %v", y.ID)
+	}
+
+	if err := d.StartDriver(y); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WaitStart(y); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Mount(y, spec); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCleanupVolume(t *testing.T) {
+	d, plugin, x, _ := newTestDriver(t)
+	if err := d.Create(x, spec); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Mount(x, spec); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Delete(x, spec); err == nil {
+		t.Fatalf("expected Delete to fail while the volume is published")
+	}
+
+	if err := d.CleanupVolume(spec); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := plugin.Inspect("vol"); err == nil || d.Exists(spec) {
+		t.Errorf("expected the volume to be deleted")
+	}
+	// Cleaning up a volume that does not exist succeeds.
+	if err := d.CleanupVolume(spec); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,596 @@
+package csi
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc"
+
+	"github.com/portworx/torpedo/config"
+	"github.com/portworx/torpedo/drivers/node"
+	"github.com/portworx/torpedo/drivers/volume"
+)
+
+const (
+	// defaultFsType is the filesystem volumes are mounted with.
+	defaultFsType = "ext4"
+	// defaultStagingDir is where volumes are staged on a node.
+	defaultStagingDir = "/var/lib/torpedo/csi/staging"
+	// defaultTargetDir is where volumes are published on a node.
+	defaultTargetDir = "/var/lib/torpedo/csi/publish"
+	// defaultSize is the capacity of a volume that does not specify one.
+	defaultSize = 1 << 30
+	// rpcTimeout is how long to wait for a CSI call to complete.
+	rpcTimeout = time.Minute
+	// startTimeout is how long to wait for the plugin to become ready.
+	startTimeout = 2 * time.Minute
+)
+
+// mounted is a volume that is published on a node.
+type mounted struct {
+	publishContext map[string]string
+	staged         bool
+}
+
+type driver struct {
+	sync.Mutex
+	plugin       Plugin
+	nodes        map[string]node.Node
+	endpoint     string
+	nodeEndpoint string
+	fsType       string
+	stagingDir   string
+	targetDir    string
+	controller   *grpc.ClientConn
+	conns        map[string]*grpc.ClientConn
+	csiNodeIDs   map[string]string
+	volumes      map[string]*csi.Volume
+	// mounts holds the nodes each volume is mounted on.
+	mounts map[string]map[string]*mounted
+}
+
+// dockerPlugin runs the CSI plugin in a Docker container on each node.
+type dockerPlugin struct {
+	config    *config.Config
+	container string
+}
+
+func newDriver(plugin Plugin) *driver {
+	return &driver{
+		plugin:     plugin,
+		nodes:      make(map[string]node.Node),
+		conns:      make(map[string]*grpc.ClientConn),
+		csiNodeIDs: make(map[string]string),
+		volumes:    make(map[string]*csi.Volume),
+		mounts:     make(map[string]map[string]*mounted),
+	}
+}
+
+func (d *driver) String() string {
+	return Name
+}
+
+func (d *driver) Init(cfg *config.Config) error {
+	nodes, err := node.FromConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	d.Lock()
+	defer d.Unlock()
+	for _, n := range nodes {
+		d.nodes[n.ID] = n
+	}
+
+	opts := cfg.Volume.Options
+	d.endpoint = cfg.Volume.Endpoint
+	if d.endpoint == "" {
+		d.endpoint = DefaultEndpoint
+	}
+	d.nodeEndpoint = opts["nodeEndpoint"]
+	d.fsType = option(opts, "fsType", defaultFsType)
+	d.stagingDir = option(opts, "stagingDir", defaultStagingDir)
+	d.targetDir = option(opts, "targetDir", defaultTargetDir)
+	if d.plugin == nil {
+		d.plugin = &dockerPlugin{config: cfg, container: opts["container"]}
+	}
+
+	if d.controller, err = Dial(d.endpoint); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	info, err := csi.NewIdentityClient(d.controller).GetPluginInfo(
+		ctx,
+		&csi.GetPluginInfoRequest{},
+	)
+	if err != nil {
+		return fmt.Errorf("cannot reach the CSI plugin at %v: %v", d.endpoint, err)
+	}
+
+	log.Printf(
+		"Using the CSI plugin %v %v at %v.\n",
+		info.Name,
+		info.VendorVersion,
+		d.endpoint,
+	)
+	return nil
+}
+
+// Version returns the name and version the plugin reports.
+func (d *driver) Version() (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	info, err := csi.NewIdentityClient(d.controller).GetPluginInfo(
+		ctx,
+		&csi.GetPluginInfoRequest{},
+	)
+	if err != nil {
+		return "", err
+	}
+	return info.Name + " " + info.VendorVersion, nil
+}
+
+// CleanupVolume unmounts the volume from every node it is mounted on and
+// deletes it.
+func (d *driver) CleanupVolume(name string) error {
+	d.Lock()
+	defer d.Unlock()
+
+	name = volume.ParseName(name)
+	for id := range d.mounts[name] {
+		if err := d.unmount(d.nodes[id], name); err != nil {
+			return err
+		}
+	}
+	return d.delete(name)
+}
+
+func (d *driver) StopDriver(n node.Node) error {
+	if err := d.plugin.Stop(n); err != nil {
+		return err
+	}
+
+	d.Lock()
+	defer d.Unlock()
+	d.disconnect(n)
+	return nil
+}
+
+func (d *driver) StartDriver(n node.Node) error {
+	d.Lock()
+	defer d.Unlock()
+
+	// The plugin recreates its socket, so connect to it again.
+	d.disconnect(n)
+	return d.plugin.Start(n)
+}
+
+// WaitStart waits for the plugin on the node to report that it is ready.
+func (d *driver) WaitStart(n node.Node) error {
+	d.Lock()
+	defer d.Unlock()
+
+	var err error
+	for start := time.Now(); time.Since(start) < startTimeout; time.Sleep(time.Second) {
+		var conn *grpc.ClientConn
+		if conn, err = d.connect(n); err != nil {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+		var probe *csi.ProbeResponse
+		probe, err = csi.NewIdentityClient(conn).Probe(ctx, &csi.ProbeRequest{})
+		cancel()
+		if err != nil {
+			continue
+		}
+		if probe.Ready == nil || probe.Ready.Value {
+			return nil
+		}
+		err = fmt.Errorf("the CSI plugin is not ready")
+	}
+	return fmt.Errorf("the CSI plugin did not start on %v: %v", n.ID, err)
+}
+
+func (d *driver) Create(n node.Node, name string) error {
+	d.Lock()
+	defer d.Unlock()
+
+	volName := volume.ParseName(name)
+	if _, ok := d.volumes[volName]; ok {
+		return nil
+	}
+
+	size, params, err := parseSpec(name)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	resp, err := csi.NewControllerClient(d.controller).CreateVolume(
+		ctx,
+		&csi.CreateVolumeRequest{
+			Name:               volName,
+			CapacityRange:      &csi.CapacityRange{RequiredBytes: size},
+			VolumeCapabilities: []*csi.VolumeCapability{d.capability()},
+			Parameters:         params,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	d.volumes[volName] = resp.Volume
+	log.Printf("Created volume %v with ID %v\n", volName, resp.Volume.VolumeId)
+	return nil
+}
+
+func (d *driver) Mount(n node.Node, name string) error {
+	d.Lock()
+	defer d.Unlock()
+
+	name = volume.ParseName(name)
+	vol, ok := d.volumes[name]
+	if !ok {
+		return fmt.Errorf("volume %v has not been created", name)
+	}
+	conn, err := d.connect(n)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	m := &mounted{}
+
+	publish, err := d.controllerCapable(ctx, csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME)
+	if err != nil {
+		return err
+	}
+	if publish {
+		nodeID, err := d.csiNodeID(ctx, n, conn)
+		if err != nil {
+			return err
+		}
+		resp, err := csi.NewControllerClient(d.controller).ControllerPublishVolume(
+			ctx,
+			&csi.ControllerPublishVolumeRequest{
+				VolumeId:         vol.VolumeId,
+				NodeId:           nodeID,
+				VolumeCapability: d.capability(),
+				VolumeContext:    vol.VolumeContext,
+			},
+		)
+		if err != nil {
+			return err
+		}
+		m.publishContext = resp.PublishContext
+	}
+
+	if m.staged, err = nodeCapable(ctx, conn, csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME); err != nil {
+		return err
+	}
+	if m.staged {
+		if _, err := csi.NewNodeClient(conn).NodeStageVolume(
+			ctx,
+			&csi.NodeStageVolumeRequest{
+				VolumeId:          vol.VolumeId,
+				PublishContext:    m.publishContext,
+				StagingTargetPath: d.stagingPath(name),
+				VolumeCapability:  d.capability(),
+				VolumeContext:     vol.VolumeContext,
+			},
+		); err != nil {
+			return err
+		}
+	}
+
+	req := &csi.NodePublishVolumeRequest{
+		VolumeId:         vol.VolumeId,
+		PublishContext:   m.publishContext,
+		TargetPath:       d.targetPath(name),
+		VolumeCapability: d.capability(),
+		VolumeContext:    vol.VolumeContext,
+	}
+	if m.staged {
+		req.StagingTargetPath = d.stagingPath(name)
+	}
+	if _, err := csi.NewNodeClient(conn).NodePublishVolume(ctx, req); err != nil {
+		return err
+	}
+
+	if d.mounts[name] == nil {
+		d.mounts[name] = make(map[string]*mounted)
+	}
+	d.mounts[name][n.ID] = m
+	return nil
+}
+
+func (d *driver) Unmount(n node.Node, name string) error {
+	d.Lock()
+	defer d.Unlock()
+
+	return d.unmount(n, volume.ParseName(name))
+}
+
+func (d *driver) Delete(n node.Node, name string) error {
+	d.Lock()
+	defer d.Unlock()
+
+	return d.delete(volume.ParseName(name))
+}
+
+func (d *driver) Exists(name string) bool {
+	d.Lock()
+	defer d.Unlock()
+
+	_, ok := d.volumes[volume.ParseName(name)]
+	return ok
+}
+
+func (d *driver) unmount(n node.Node, name string) error {
+	vol, ok := d.volumes[name]
+	if !ok {
+		return fmt.Errorf("volume %v has not been created", name)
+	}
+	m, ok := d.mounts[name][n.ID]
+	if !ok {
+		return nil
+	}
+	conn, err := d.connect(n)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+
+	if _, err := csi.NewNodeClient(conn).NodeUnpublishVolume(
+		ctx,
+		&csi.NodeUnpublishVolumeRequest{
+			VolumeId:   vol.VolumeId,
+			TargetPath: d.targetPath(name),
+		},
+	); err != nil {
+		return err
+	}
+
+	if m.staged {
+		if _, err := csi.NewNodeClient(conn).NodeUnstageVolume(
+			ctx,
+			&csi.NodeUnstageVolumeRequest{
+				VolumeId:          vol.VolumeId,
+				StagingTargetPath: d.stagingPath(name),
+			},
+		); err != nil {
+			return err
+		}
+	}
+
+	if nodeID, ok := d.csiNodeIDs[n.ID]; ok {
+		if _, err := csi.NewControllerClient(d.controller).ControllerUnpublishVolume(
+			ctx,
+			&csi.ControllerUnpublishVolumeRequest{
+				VolumeId: vol.VolumeId,
+				NodeId:   nodeID,
+			},
+		); err != nil {
+			return err
+		}
+	}
+
+	delete(d.mounts[name], n.ID)
+	return nil
+}
+
+func (d *driver) delete(name string) error {
+	vol, ok := d.volumes[name]
+	if !ok {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	if _, err := csi.NewControllerClient(d.controller).DeleteVolume(
+		ctx,
+		&csi.DeleteVolumeRequest{VolumeId: vol.VolumeId},
+	); err != nil {
+		return err
+	}
+
+	delete(d.volumes, name)
+	delete(d.mounts, name)
+	log.Printf("Deleted volume %v\n", name)
+	return nil
+}
+
+// connect returns a connection to the plugin on a node.
+func (d *driver) connect(n node.Node) (*grpc.ClientConn, error) {
+	if conn, ok := d.conns[n.ID]; ok {
+		return conn, nil
+	}
+
+	endpoint := d.endpoint
+	if d.nodeEndpoint != "" {
+		endpoint = strings.Replace(d.nodeEndpoint, "{address}", n.MgmtIP, -1)
+		endpoint = strings.Replace(endpoint, "{id}", n.ID, -1)
+	}
+	conn, err := Dial(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	d.conns[n.ID] = conn
+	return conn, nil
+}
+
+// disconnect closes the connection to the plugin on a node.
+func (d *driver) disconnect(n node.Node) {
+	if conn, ok := d.conns[n.ID]; ok {
+		if err := conn.Close(); err != nil {
+			log.Printf("Could not close the connection to %v: %v\n", n.ID, err)
+		}
+		delete(d.conns, n.ID)
+	}
+}
+
+// csiNodeID returns the ID the plugin knows a node by.
+func (d *driver) csiNodeID(ctx context.Context, n node.Node, conn *grpc.ClientConn) (string, error) {
+	if id, ok := d.csiNodeIDs[n.ID]; ok {
+		return id, nil
+	}
+
+	info, err := csi.NewNodeClient(conn).NodeGetInfo(ctx, &csi.NodeGetInfoRequest{})
+	if err != nil {
+		return "", err
+	}
+	d.csiNodeIDs[n.ID] = info.NodeId
+	return info.NodeId, nil
+}
+
+func (d *driver) controllerCapable(
+	ctx context.Context,
+	capability csi.ControllerServiceCapability_RPC_Type,
+) (bool, error) {
+	resp, err := csi.NewControllerClient(d.controller).ControllerGetCapabilities(
+		ctx,
+		&csi.ControllerGetCapabilitiesRequest{},
+	)
+	if err != nil {
+		return false, err
+	}
+	for _, c := range resp.Capabilities {
+		if c.GetRpc().GetType() == capability {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// capability is the capability every volume is created and used with.
+func (d *driver) capability() *csi.VolumeCapability {
+	return &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Mount{
+			Mount: &csi.VolumeCapability_MountVolume{FsType: d.fsType},
+		},
+		AccessMode: &csi.VolumeCapability_AccessMode{
+			Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+		},
+	}
+}
+
+func (d *driver) stagingPath(name string) string {
+	return filepath.Join(d.stagingDir, name)
+}
+
+func (d *driver) targetPath(name string) string {
+	return filepath.Join(d.targetDir, name)
+}
+
+func (p *dockerPlugin) Stop(n node.Node) error {
+	if p.container == "" {
+		return fmt.Errorf("the CSI plugin container is not configured")
+	}
+	cfgNode := p.config.Lookup(n.MgmtIP)
+	docker, err := cfgNode.DockerClient()
+	if err != nil {
+		return err
+	}
+	return docker.StopContainer(p.container, 10)
+}
+
+func (p *dockerPlugin) Start(n node.Node) error {
+	if p.container == "" {
+		return fmt.Errorf("the CSI plugin container is not configured")
+	}
+	cfgNode := p.config.Lookup(n.MgmtIP)
+	docker, err := cfgNode.DockerClient()
+	if err != nil {
+		return err
+	}
+	return docker.StartContainer(p.container, nil)
+}
+
+func nodeCapable(
+	ctx context.Context,
+	conn *grpc.ClientConn,
+	capability csi.NodeServiceCapability_RPC_Type,
+) (bool, error) {
+	resp, err := csi.NewNodeClient(conn).NodeGetCapabilities(
+		ctx,
+		&csi.NodeGetCapabilitiesRequest{},
+	)
+	if err != nil {
+		return false, err
+	}
+	for _, c := range resp.Capabilities {
+		if c.GetRpc().GetType() == capability {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// parseSpec returns the requested capacity and the parameters of an inline
+// volume specification.
+func parseSpec(spec string) (int64, map[string]string, error) {
+	size := int64(defaultSize)
+	params := make(map[string]string)
+	if !strings.Contains(spec, "=") {
+		return size, params, nil
+	}
+
+	for _, opt := range strings.Split(spec, ",") {
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "name":
+		case "size":
+			var err error
+			if size, err = parseSize(kv[1]); err != nil {
+				return 0, nil, err
+			}
+		default:
+			params[kv[0]] = kv[1]
+		}
+	}
+	return size, params, nil
+}
+
+// parseSize parses a size such as 10G into bytes.  A size without a unit is
+// in gigabytes.
+func parseSize(size string) (int64, error) {
+	units := map[string]int64{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30, "T": 1 << 40}
+	mult := int64(1 << 30)
+	s := strings.ToUpper(size)
+	if len(s) > 0 {
+		if m, ok := units[s[len(s)-1:]]; ok {
+			mult = m
+			s = s[:len(s)-1]
+		}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid volume size %v", size)
+	}
+	return n * mult, nil
+}
+
+func option(opts map[string]string, key, def string) string {
+	if v, ok := opts[key]; ok && v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,612 @@
+package mock
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/portworx/torpedo/drivers/node"
+	torpedocsi "github.com/portworx/torpedo/drivers/volume/csi"
+)
+
+// defaultCapacity is the size of a volume that does not request one.
+const defaultCapacity = 1 << 30
+
+type plugin struct {
+	sync.Mutex
+	volumes   map[string]*Volume
+	nextID    int
+	endpoints map[string]string
+	servers   map[string]*grpc.Server
+}
+
+// server serves the plugin for a single node.
+type server struct {
+	csi.UnimplementedIdentityServer
+	csi.UnimplementedControllerServer
+	csi.UnimplementedNodeServer
+	plugin *plugin
+	nodeID string
+}
+
+func newPlugin() *plugin {
+	return &plugin{
+		volumes:   make(map[string]*Volume),
+		endpoints: make(map[string]string),
+		servers:   make(map[string]*grpc.Server),
+	}
+}
+
+func (p *plugin) Serve(n node.Node, endpoint string) error {
+	p.Lock()
+	defer p.Unlock()
+
+	if _, ok := p.servers[n.ID]; ok {
+		return fmt.Errorf("the plugin is already serving %v", n.ID)
+	}
+	p.endpoints[n.ID] = endpoint
+	return p.serve(n.ID)
+}
+
+func (p *plugin) Stop(n node.Node) error {
+	p.Lock()
+	defer p.Unlock()
+
+	s, ok := p.servers[n.ID]
+	if !ok {
+		return fmt.Errorf("the plugin is not running on %v", n.ID)
+	}
+	s.Stop()
+	delete(p.servers, n.ID)
+	return nil
+}
+
+func (p *plugin) Start(n node.Node) error {
+	p.Lock()
+	defer p.Unlock()
+
+	if _, ok := p.endpoints[n.ID]; !ok {
+		return fmt.Errorf("the plugin was never served on %v", n.ID)
+	}
+	if _, ok := p.servers[n.ID]; ok {
+		return fmt.Errorf("the plugin is not stopped on %v", n.ID)
+	}
+	return p.serve(n.ID)
+}
+
+func (p *plugin) Inspect(name string) (*Volume, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	for _, vol := range p.volumes {
+		if vol.Name == name {
+			v := *vol
+			return &v, nil
+		}
+	}
+	return nil, fmt.Errorf("volume %v does not exist", name)
+}
+
+func (p *plugin) Close() {
+	p.Lock()
+	defer p.Unlock()
+
+	for id, s := range p.servers {
+		s.Stop()
+		delete(p.servers, id)
+	}
+}
+
+func (p *plugin) serve(id string) error {
+	network, address, err := torpedocsi.ParseEndpoint(p.endpoints[id])
+	if err != nil {
+		return err
+	}
+	if network == "unix" {
+		if err := os.Remove(address); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	l, err := net.Listen(network, address)
+	if err != nil {
+		return err
+	}
+
+	s := grpc.NewServer()
+	srv := &server{plugin: p, nodeID: id}
+	csi.RegisterIdentityServer(s, srv)
+	csi.RegisterControllerServer(s, srv)
+	csi.RegisterNodeServer(s, srv)
+	p.servers[id] = s
+
+	go func() {
+		// Serve returns once the server is stopped.
+		if err := s.Serve(l); err != nil {
+			log.Printf("The mock CSI plugin on %v failed: %v\n", id, err)
+		}
+	}()
+	return nil
+}
+
+func (s *server) GetPluginInfo(
+	ctx context.Context,
+	req *csi.GetPluginInfoRequest,
+) (*csi.GetPluginInfoResponse, error) {
+	return &csi.GetPluginInfoResponse{
+		Name:          PluginName,
+		VendorVersion: PluginVersion,
+	}, nil
+}
+
+func (s *server) GetPluginCapabilities(
+	ctx context.Context,
+	req *csi.GetPluginCapabilitiesRequest,
+) (*csi.GetPluginCapabilitiesResponse, error) {
+	return &csi.GetPluginCapabilitiesResponse{
+		Capabilities: []*csi.PluginCapability{
+			{
+				Type: &csi.PluginCapability_Service_{
+					Service: &csi.PluginCapability_Service{
+						Type: csi.PluginCapability_Service_CONTROLLER_SERVICE,
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+func (s *server) Probe(
+	ctx context.Context,
+	req *csi.ProbeRequest,
+) (*csi.ProbeResponse, error) {
+	return &csi.ProbeResponse{}, nil
+}
+
+func (s *server) CreateVolume(
+	ctx context.Context,
+	req *csi.CreateVolumeRequest,
+) (*csi.CreateVolumeResponse, error) {
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+	if err := validateCapabilities(req.VolumeCapabilities); err != nil {
+		return nil, err
+	}
+
+	capacity := int64(defaultCapacity)
+	if r := req.CapacityRange; r != nil {
+		if r.LimitBytes != 0 && r.LimitBytes < r.RequiredBytes {
+			return nil, status.Error(codes.InvalidArgument, "limit is less than required")
+		}
+		if r.RequiredBytes != 0 {
+			capacity = r.RequiredBytes
+		} else if r.LimitBytes != 0 && r.LimitBytes < capacity {
+			capacity = r.LimitBytes
+		}
+	}
+
+	p := s.plugin
+	p.Lock()
+	defer p.Unlock()
+
+	for _, vol := range p.volumes {
+		if vol.Name != req.Name {
+			continue
+		}
+		if r := req.CapacityRange; r != nil {
+			if vol.CapacityBytes < r.RequiredBytes ||
+				(r.LimitBytes != 0 && vol.CapacityBytes > r.LimitBytes) {
+				return nil, status.Errorf(
+					codes.AlreadyExists,
+					"volume %v exists with a capacity of %v bytes",
+					vol.Name,
+					vol.CapacityBytes,
+				)
+			}
+		}
+		return &csi.CreateVolumeResponse{Volume: csiVolume(vol)}, nil
+	}
+
+	p.nextID++
+	vol := &Volume{
+		ID:            "mock-" + strconv.Itoa(p.nextID),
+		Name:          req.Name,
+		CapacityBytes: capacity,
+		Parameters:    req.Parameters,
+		Staged:        make(map[string]string),
+		Targets:       make(map[string][]string),
+	}
+	p.volumes[vol.ID] = vol
+	return &csi.CreateVolumeResponse{Volume: csiVolume(vol)}, nil
+}
+
+func (s *server) DeleteVolume(
+	ctx context.Context,
+	req *csi.DeleteVolumeRequest,
+) (*csi.DeleteVolumeResponse, error) {
+	if req.VolumeId == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume ID is required")
+	}
+
+	p := s.plugin
+	p.Lock()
+	defer p.Unlock()
+
+	vol, ok := p.volumes[req.VolumeId]
+	if !ok {
+		return &csi.DeleteVolumeResponse{}, nil
+	}
+	if vol.PublishedOn != "" {
+		return nil, status.Errorf(
+			codes.FailedPrecondition,
+			"volume %v is published on %v",
+			vol.ID,
+			vol.PublishedOn,
+		)
+	}
+	delete(p.volumes, vol.ID)
+	return &csi.DeleteVolumeResponse{}, nil
+}
+
+func (s *server) ControllerPublishVolume(
+	ctx context.Context,
+	req *csi.ControllerPublishVolumeRequest,
+) (*csi.ControllerPublishVolumeResponse, error) {
+	if req.VolumeId == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume ID is required")
+	}
+	if req.NodeId == "" {
+		return nil, status.Error(codes.InvalidArgument, "node ID is required")
+	}
+	if err := validateCapabilities([]*csi.VolumeCapability{req.VolumeCapability}); err != nil {
+		return nil, err
+	}
+
+	p := s.plugin
+	p.Lock()
+	defer p.Unlock()
+
+	vol, ok := p.volumes[req.VolumeId]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "volume %v does not exist", req.VolumeId)
+	}
+	if _, ok := p.endpoints[req.NodeId]; !ok {
+		return nil, status.Errorf(codes.NotFound, "node %v does not exist", req.NodeId)
+	}
+	if vol.PublishedOn != "" && vol.PublishedOn != req.NodeId {
+		return nil, status.Errorf(
+			codes.FailedPrecondition,
+			"volume %v is published on %v",
+			vol.ID,
+			vol.PublishedOn,
+		)
+	}
+
+	vol.PublishedOn = req.NodeId
+	return &csi.ControllerPublishVolumeResponse{
+		PublishContext: map[string]string{"device": "/dev/mock/" + vol.ID},
+	}, nil
+}
+
+func (s *server) ControllerUnpublishVolume(
+	ctx context.Context,
+	req *csi.ControllerUnpublishVolumeRequest,
+) (*csi.ControllerUnpublishVolumeResponse, error) {
+	if req.VolumeId == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume ID is required")
+	}
+
+	p := s.plugin
+	p.Lock()
+	defer p.Unlock()
+
+	// A volume that does not exist is not published anywhere.
+	vol, ok := p.volumes[req.VolumeId]
+	if !ok {
+		return &csi.ControllerUnpublishVolumeResponse{}, nil
+	}
+	if req.NodeId == "" || vol.PublishedOn == req.NodeId {
+		vol.PublishedOn = ""
+	}
+	return &csi.ControllerUnpublishVolumeResponse{}, nil
+}
+
+func (s *server) ValidateVolumeCapabilities(
+	ctx context.Context,
+	req *csi.ValidateVolumeCapabilitiesRequest,
+) (*csi.ValidateVolumeCapabilitiesResponse, error) {
+	if req.VolumeId == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume ID is required")
+	}
+	if len(req.VolumeCapabilities) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "volume capabilities are required")
+	}
+
+	p := s.plugin
+	p.Lock()
+	_, ok := p.volumes[req.VolumeId]
+	p.Unlock()
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "volume %v does not exist", req.VolumeId)
+	}
+
+	if err := validateCapabilities(req.VolumeCapabilities); err != nil {
+		return &csi.ValidateVolumeCapabilitiesResponse{Message: err.Error()}, nil
+	}
+	return &csi.ValidateVolumeCapabilitiesResponse{
+		Confirmed: &csi.ValidateVolumeCapabilitiesResponse_Confirmed{
+			VolumeContext:      req.VolumeContext,
+			VolumeCapabilities: req.VolumeCapabilities,
+			Parameters:         req.Parameters,
+		},
+	}, nil
+}
+
+func (s *server) ListVolumes(
+	ctx context.Context,
+	req *csi.ListVolumesRequest,
+) (*csi.ListVolumesResponse, error) {
+	p := s.plugin
+	p.Lock()
+	defer p.Unlock()
+
+	ids := make([]string, 0, len(p.volumes))
+	for id := range p.volumes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	start := 0
+	if req.StartingToken != "" {
+		var err error
+		start, err = strconv.Atoi(req.StartingToken)
+		if err != nil || start < 0 || start > len(ids) {
+			return nil, status.Errorf(codes.Aborted, "invalid starting token %v", req.StartingToken)
+		}
+	}
+	end := len(ids)
+	if req.MaxEntries > 0 && start+int(req.MaxEntries) < end {
+		end = start + int(req.MaxEntries)
+	}
+
+	resp := &csi.ListVolumesResponse{}
+	for _, id := range ids[start:end] {
+		resp.Entries = append(resp.Entries, &csi.ListVolumesResponse_Entry{
+			Volume: csiVolume(p.volumes[id]),
+		})
+	}
+	if end < len(ids) {
+		resp.NextToken = strconv.Itoa(end)
+	}
+	return resp, nil
+}
+
+func (s *server) ControllerGetCapabilities(
+	ctx context.Context,
+	req *csi.ControllerGetCapabilitiesRequest,
+) (*csi.ControllerGetCapabilitiesResponse, error) {
+	resp := &csi.ControllerGetCapabilitiesResponse{}
+	for _, c := range []csi.ControllerServiceCapability_RPC_Type{
+		csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME,
+		csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME,
+		csi.ControllerServiceCapability_RPC_LIST_VOLUMES,
+	} {
+		resp.Capabilities = append(resp.Capabilities, &csi.ControllerServiceCapability{
+			Type: &csi.ControllerServiceCapability_Rpc{
+				Rpc: &csi.ControllerServiceCapability_RPC{Type: c},
+			},
+		})
+	}
+	return resp, nil
+}
+
+func (s *server) NodeStageVolume(
+	ctx context.Context,
+	req *csi.NodeStageVolumeRequest,
+) (*csi.NodeStageVolumeResponse, error) {
+	if req.VolumeId == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume ID is required")
+	}
+	if req.StagingTargetPath == "" {
+		return nil, status.Error(codes.InvalidArgument, "staging target path is required")
+	}
+	if err := validateCapabilities([]*csi.VolumeCapability{req.VolumeCapability}); err != nil {
+		return nil, err
+	}
+
+	p := s.plugin
+	p.Lock()
+	defer p.Unlock()
+
+	vol, ok := p.volumes[req.VolumeId]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "volume %v does not exist", req.VolumeId)
+	}
+	if vol.PublishedOn != s.nodeID {
+		return nil, status.Errorf(
+			codes.FailedPrecondition,
+			"volume %v is not published on %v",
+			vol.ID,
+			s.nodeID,
+		)
+	}
+	if path, ok := vol.Staged[s.nodeID]; ok && path != req.StagingTargetPath {
+		return nil, status.Errorf(
+			codes.AlreadyExists,
+			"volume %v is staged at %v",
+			vol.ID,
+			path,
+		)
+	}
+
+	vol.Staged[s.nodeID] = req.StagingTargetPath
+	return &csi.NodeStageVolumeResponse{}, nil
+}
+
+func (s *server) NodeUnstageVolume(
+	ctx context.Context,
+	req *csi.NodeUnstageVolumeRequest,
+) (*csi.NodeUnstageVolumeResponse, error) {
+	if req.VolumeId == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume ID is required")
+	}
+	if req.StagingTargetPath == "" {
+		return nil, status.Error(codes.InvalidArgument, "staging target path is required")
+	}
+
+	p := s.plugin
+	p.Lock()
+	defer p.Unlock()
+
+	vol, ok := p.volumes[req.VolumeId]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "volume %v does not exist", req.VolumeId)
+	}
+	if vol.Staged[s.nodeID] == req.StagingTargetPath {
+		delete(vol.Staged, s.nodeID)
+	}
+	return &csi.NodeUnstageVolumeResponse{}, nil
+}
+
+func (s *server) NodePublishVolume(
+	ctx context.Context,
+	req *csi.NodePublishVolumeRequest,
+) (*csi.NodePublishVolumeResponse, error) {
+	if req.VolumeId == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume ID is required")
+	}
+	if req.TargetPath == "" {
+		return nil, status.Error(codes.InvalidArgument, "target path is required")
+	}
+	if err := validateCapabilities([]*csi.VolumeCapability{req.VolumeCapability}); err != nil {
+		return nil, err
+	}
+
+	p := s.plugin
+	p.Lock()
+	defer p.Unlock()
+
+	vol, ok := p.volumes[req.VolumeId]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "volume %v does not exist", req.VolumeId)
+	}
+	if req.StagingTargetPath == "" || vol.Staged[s.nodeID] != req.StagingTargetPath {
+		return nil, status.Errorf(
+			codes.FailedPrecondition,
+			"volume %v is not staged at %v on %v",
+			vol.ID,
+			req.StagingTargetPath,
+			s.nodeID,
+		)
+	}
+
+	for _, target := range vol.Targets[s.nodeID] {
+		if target == req.TargetPath {
+			return &csi.NodePublishVolumeResponse{}, nil
+		}
+	}
+	vol.Targets[s.nodeID] = append(vol.Targets[s.nodeID], req.TargetPath)
+	return &csi.NodePublishVolumeResponse{}, nil
+}
+
+func (s *server) NodeUnpublishVolume(
+	ctx context.Context,
+	req *csi.NodeUnpublishVolumeRequest,
+) (*csi.NodeUnpublishVolumeResponse, error) {
+	if req.VolumeId == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume ID is required")
+	}
+	if req.TargetPath == "" {
+		return nil, status.Error(codes.InvalidArgument, "target path is required")
+	}
+
+	p := s.plugin
+	p.Lock()
+	defer p.Unlock()
+
+	vol, ok := p.volumes[req.VolumeId]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "volume %v does not exist", req.VolumeId)
+	}
+
+	targets := vol.Targets[s.nodeID]
+	for i, target := range targets {
+		if target == req.TargetPath {
+			vol.Targets[s.nodeID] = append(targets[:i], targets[i+1:]...)
+			break
+		}
+	}
+	if len(vol.Targets[s.nodeID]) == 0 {
+		delete(vol.Targets, s.nodeID)
+	}
+	return &csi.NodeUnpublishVolumeResponse{}, nil
+}
+
+func (s *server) NodeGetCapabilities(
+	ctx context.Context,
+	req *csi.NodeGetCapabilitiesRequest,
+) (*csi.NodeGetCapabilitiesResponse, error) {
+	return &csi.NodeGetCapabilitiesResponse{
+		Capabilities: []*csi.NodeServiceCapability{
+			{
+				Type: &csi.NodeServiceCapability_Rpc{
+					Rpc: &csi.NodeServiceCapability_RPC{
+						Type: csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME,
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+func (s *server) NodeGetInfo(
+	ctx context.Context,
+	req *csi.NodeGetInfoRequest,
+) (*csi.NodeGetInfoResponse, error) {
+	return &csi.NodeGetInfoResponse{NodeId: s.nodeID}, nil
+}
+
+// validateCapabilities checks that the plugin supports the requested volume
+// capabilities.  Only single node access modes are supported.
+func validateCapabilities(caps []*csi.VolumeCapability) error {
+	if len(caps) == 0 {
+		return status.Error(codes.InvalidArgument, "volume capabilities are required")
+	}
+	for _, c := range caps {
+		if c == nil || c.AccessMode == nil {
+			return status.Error(codes.InvalidArgument, "volume capability is required")
+		}
+		if c.GetMount() == nil && c.GetBlock() == nil {
+			return status.Error(codes.InvalidArgument, "access type is required")
+		}
+		switch c.AccessMode.Mode {
+		case csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+			csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY:
+		default:
+			return status.Errorf(
+				codes.InvalidArgument,
+				"access mode %v is not supported",
+				c.AccessMode.Mode,
+			)
+		}
+	}
+	return nil
+}
+
+func csiVolume(vol *Volume) *csi.Volume {
+	return &csi.Volume{
+		VolumeId:      vol.ID,
+		CapacityBytes: vol.CapacityBytes,
+		VolumeContext: vol.Parameters,
+	}
+}
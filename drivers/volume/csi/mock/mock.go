@@ -0,0 +1,62 @@
+package mock
+
+import (
+	"github.com/portworx/torpedo/drivers/node"
+)
+
+const (
+	// PluginName is the name the mock plugin reports.
+	PluginName = "mock.csi.torpedo"
+	// PluginVersion is the version the mock plugin reports.
+	PluginVersion = "1.0.0"
+)
+
+// Volume is the state of a volume in the mock plugin.
+type Volume struct {
+	// ID of the volume.
+	ID string
+	// Name the volume was created with.
+	Name string
+	// CapacityBytes is the size of the volume.
+	CapacityBytes int64
+	// Parameters the volume was created with.
+	Parameters map[string]string
+	// PublishedOn is the ID of the node the volume is controller
+	// published on, if any.
+	PublishedOn string
+	// Staged holds the staging path of the volume on each node.
+	Staged map[string]string
+	// Targets holds the paths the volume is published at on each node.
+	Targets map[string][]string
+}
+
+// Plugin is an in-process CSI plugin that keeps its volumes in memory.  It
+// serves the Identity, Controller and Node services on one endpoint per
+// node, and follows the idempotency and error code rules of the CSI
+// specification.  Volumes are single node writers: a volume can only be
+// controller published on one node at a time, and must be staged before it
+// is published on a node.
+//
+// The plugin can be passed to csi.New to run the Torpedo scenarios against
+// it without a cluster.
+type Plugin interface {
+	// Serve serves the plugin for a node on a unix or tcp endpoint.
+	Serve(n node.Node, endpoint string) error
+
+	// Stop stops serving the plugin for a node.  The volumes are kept.
+	Stop(n node.Node) error
+
+	// Start serves the plugin for a node again after it was stopped.
+	Start(n node.Node) error
+
+	// Inspect returns the state of the volume with the given name.
+	Inspect(name string) (*Volume, error)
+
+	// Close stops serving the plugin for all nodes.
+	Close()
+}
+
+// New returns a new mock CSI plugin without any volumes.
+func New() Plugin {
+	return newPlugin()
+}
@@ -0,0 +1,633 @@
+package sanity
+
+import (
+	"fmt"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+)
+
+var checks = []Check{
+	{
+		Name:        "GetPluginInfo: name and version",
+		Description: "The plugin reports a name and a vendor version.",
+		run:         checkPluginInfo,
+	},
+	{
+		Name:        "Probe: ready",
+		Description: "The plugin reports that it is ready.",
+		run:         checkProbe,
+	},
+	{
+		Name:        "NodeGetInfo: node ID",
+		Description: "The plugin reports the ID of the node.",
+		run:         checkNodeGetInfo,
+	},
+	{
+		Name:        "CreateVolume: name is required",
+		Description: "CreateVolume without a name returns INVALID_ARGUMENT.",
+		run:         checkCreateVolumeNoName,
+	},
+	{
+		Name:        "CreateVolume: capabilities are required",
+		Description: "CreateVolume without volume capabilities returns INVALID_ARGUMENT.",
+		run:         checkCreateVolumeNoCapabilities,
+	},
+	{
+		Name:        "CreateVolume: idempotent",
+		Description: "CreateVolume twice with the same name and capacity returns the same volume.",
+		run:         checkCreateVolumeIdempotent,
+	},
+	{
+		Name:        "CreateVolume: incompatible capacity",
+		Description: "CreateVolume with the name of an existing volume and an incompatible capacity returns ALREADY_EXISTS.",
+		run:         checkCreateVolumeIncompatible,
+	},
+	{
+		Name:        "DeleteVolume: volume ID is required",
+		Description: "DeleteVolume without a volume ID returns INVALID_ARGUMENT.",
+		run:         checkDeleteVolumeNoID,
+	},
+	{
+		Name:        "DeleteVolume: missing volume",
+		Description: "DeleteVolume of a volume that does not exist returns OK.",
+		run:         checkDeleteVolumeMissing,
+	},
+	{
+		Name:        "DeleteVolume: idempotent",
+		Description: "DeleteVolume twice returns OK.",
+		run:         checkDeleteVolumeIdempotent,
+	},
+	{
+		Name:        "ValidateVolumeCapabilities: missing volume",
+		Description: "ValidateVolumeCapabilities of a volume that does not exist returns NOT_FOUND.",
+		run:         checkValidateMissing,
+	},
+	{
+		Name:        "ValidateVolumeCapabilities: confirmed",
+		Description: "ValidateVolumeCapabilities confirms the capabilities a volume was created with.",
+		run:         checkValidateConfirmed,
+	},
+	{
+		Name:        "ListVolumes: pagination",
+		Description: "ListVolumes returns every volume when paging through them one at a time.",
+		run:         checkListVolumesPagination,
+	},
+	{
+		Name:        "ControllerPublishVolume: missing volume",
+		Description: "ControllerPublishVolume of a volume that does not exist returns NOT_FOUND.",
+		run:         checkControllerPublishMissing,
+	},
+	{
+		Name:        "ControllerPublishVolume: idempotent",
+		Description: "ControllerPublishVolume twice on the same node returns OK.",
+		run:         checkControllerPublishIdempotent,
+	},
+	{
+		Name:        "ControllerUnpublishVolume: idempotent",
+		Description: "ControllerUnpublishVolume twice returns OK.",
+		run:         checkControllerUnpublishIdempotent,
+	},
+	{
+		Name:        "NodeStageVolume: staging path is required",
+		Description: "NodeStageVolume without a staging target path returns INVALID_ARGUMENT.",
+		run:         checkNodeStageNoPath,
+	},
+	{
+		Name:        "NodeStageVolume: idempotent",
+		Description: "NodeStageVolume twice with the same staging target path returns OK.",
+		run:         checkNodeStageIdempotent,
+	},
+	{
+		Name:        "NodeUnstageVolume: idempotent",
+		Description: "NodeUnstageVolume twice returns OK.",
+		run:         checkNodeUnstageIdempotent,
+	},
+	{
+		Name:        "NodePublishVolume: target path is required",
+		Description: "NodePublishVolume without a target path returns INVALID_ARGUMENT.",
+		run:         checkNodePublishNoPath,
+	},
+	{
+		Name:        "NodePublishVolume: missing volume",
+		Description: "NodePublishVolume of a volume that does not exist returns NOT_FOUND.",
+		run:         checkNodePublishMissing,
+	},
+	{
+		Name:        "NodePublishVolume: idempotent",
+		Description: "NodePublishVolume twice with the same target path returns OK.",
+		run:         checkNodePublishIdempotent,
+	},
+	{
+		Name:        "NodeUnpublishVolume: idempotent",
+		Description: "NodeUnpublishVolume twice returns OK.",
+		run:         checkNodeUnpublishIdempotent,
+	},
+	{
+		Name:        "NodeUnpublishVolume: missing volume",
+		Description: "NodeUnpublishVolume of a volume that does not exist returns NOT_FOUND.",
+		run:         checkNodeUnpublishMissing,
+	},
+}
+
+// missingID is a volume ID that no plugin is expected to know.
+const missingID = "torpedo-sanity-missing-volume"
+
+func checkPluginInfo(c *client) error {
+	ctx, cancel := c.context()
+	defer cancel()
+	info, err := c.identity.GetPluginInfo(ctx, &csi.GetPluginInfoRequest{})
+	if err != nil {
+		return fmt.Errorf("GetPluginInfo failed: %v", err)
+	}
+	if info.Name == "" {
+		return fmt.Errorf("GetPluginInfo returned an empty name")
+	}
+	if info.VendorVersion == "" {
+		return fmt.Errorf("GetPluginInfo returned an empty vendor version")
+	}
+	return nil
+}
+
+func checkProbe(c *client) error {
+	ctx, cancel := c.context()
+	defer cancel()
+	resp, err := c.identity.Probe(ctx, &csi.ProbeRequest{})
+	if err != nil {
+		return fmt.Errorf("Probe failed: %v", err)
+	}
+	if resp.Ready != nil && !resp.Ready.Value {
+		return fmt.Errorf("Probe reported that the plugin is not ready")
+	}
+	return nil
+}
+
+func checkNodeGetInfo(c *client) error {
+	id, err := c.nodeID()
+	if err != nil {
+		return err
+	}
+	if id == "" {
+		return fmt.Errorf("NodeGetInfo returned an empty node ID")
+	}
+	return nil
+}
+
+func checkCreateVolumeNoName(c *client) error {
+	if err := c.requireController(csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME); err != nil {
+		return err
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+	req := c.createRequest("")
+	resp, err := c.controller.CreateVolume(ctx, req)
+	if err == nil {
+		c.deleteVolume(resp.Volume, &err)
+	}
+	return expect("CreateVolume", err, codes.InvalidArgument)
+}
+
+func checkCreateVolumeNoCapabilities(c *client) error {
+	if err := c.requireController(csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME); err != nil {
+		return err
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+	req := c.createRequest(c.name())
+	req.VolumeCapabilities = nil
+	resp, err := c.controller.CreateVolume(ctx, req)
+	if err == nil {
+		c.deleteVolume(resp.Volume, &err)
+	}
+	return expect("CreateVolume", err, codes.InvalidArgument)
+}
+
+func checkCreateVolumeIdempotent(c *client) (err error) {
+	if err := c.requireController(csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME); err != nil {
+		return err
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+	req := c.createRequest(c.name())
+	first, err := c.controller.CreateVolume(ctx, req)
+	if err != nil {
+		return fmt.Errorf("CreateVolume failed: %v", err)
+	}
+	defer c.deleteVolume(first.Volume, &err)
+
+	second, err := c.controller.CreateVolume(ctx, req)
+	if err != nil {
+		return fmt.Errorf("the second CreateVolume failed: %v", err)
+	}
+	if second.Volume.VolumeId != first.Volume.VolumeId {
+		return fmt.Errorf(
+			"the second CreateVolume returned volume %v instead of %v",
+			second.Volume.VolumeId,
+			first.Volume.VolumeId,
+		)
+	}
+	return nil
+}
+
+func checkCreateVolumeIncompatible(c *client) (err error) {
+	if err := c.requireController(csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME); err != nil {
+		return err
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+	req := c.createRequest(c.name())
+	first, err := c.controller.CreateVolume(ctx, req)
+	if err != nil {
+		return fmt.Errorf("CreateVolume failed: %v", err)
+	}
+	defer c.deleteVolume(first.Volume, &err)
+
+	capacity := 10 * c.cfg.Capacity
+	if first.Volume.CapacityBytes >= capacity {
+		capacity = 10 * first.Volume.CapacityBytes
+	}
+	req.CapacityRange = &csi.CapacityRange{
+		RequiredBytes: capacity,
+		LimitBytes:    capacity,
+	}
+	second, err := c.controller.CreateVolume(ctx, req)
+	if err == nil && second.Volume.VolumeId != first.Volume.VolumeId {
+		c.deleteVolume(second.Volume, &err)
+	}
+	return expect("CreateVolume", err, codes.AlreadyExists)
+}
+
+func checkDeleteVolumeNoID(c *client) error {
+	if err := c.requireController(csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME); err != nil {
+		return err
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+	_, err := c.controller.DeleteVolume(ctx, &csi.DeleteVolumeRequest{})
+	return expect("DeleteVolume", err, codes.InvalidArgument)
+}
+
+func checkDeleteVolumeMissing(c *client) error {
+	if err := c.requireController(csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME); err != nil {
+		return err
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+	_, err := c.controller.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: missingID})
+	return expect("DeleteVolume", err, codes.OK)
+}
+
+func checkDeleteVolumeIdempotent(c *client) error {
+	vol, err := c.createVolume()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+	req := &csi.DeleteVolumeRequest{VolumeId: vol.VolumeId}
+	if _, err := c.controller.DeleteVolume(ctx, req); err != nil {
+		return fmt.Errorf("DeleteVolume failed: %v", err)
+	}
+	_, err = c.controller.DeleteVolume(ctx, req)
+	return expect("the second DeleteVolume", err, codes.OK)
+}
+
+func checkValidateMissing(c *client) error {
+	ctx, cancel := c.context()
+	defer cancel()
+	_, err := c.controller.ValidateVolumeCapabilities(
+		ctx,
+		&csi.ValidateVolumeCapabilitiesRequest{
+			VolumeId:           missingID,
+			VolumeCapabilities: []*csi.VolumeCapability{c.capability()},
+		},
+	)
+	return expect("ValidateVolumeCapabilities", err, codes.NotFound)
+}
+
+func checkValidateConfirmed(c *client) (err error) {
+	vol, err := c.createVolume()
+	if err != nil {
+		return err
+	}
+	defer c.deleteVolume(vol, &err)
+
+	ctx, cancel := c.context()
+	defer cancel()
+	resp, err := c.controller.ValidateVolumeCapabilities(
+		ctx,
+		&csi.ValidateVolumeCapabilitiesRequest{
+			VolumeId:           vol.VolumeId,
+			VolumeContext:      vol.VolumeContext,
+			VolumeCapabilities: []*csi.VolumeCapability{c.capability()},
+			Parameters:         c.cfg.Parameters,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("ValidateVolumeCapabilities failed: %v", err)
+	}
+	if resp.Confirmed == nil {
+		return fmt.Errorf(
+			"ValidateVolumeCapabilities did not confirm the capabilities: %v",
+			resp.Message,
+		)
+	}
+	return nil
+}
+
+func checkListVolumesPagination(c *client) (err error) {
+	if err := c.requireController(csi.ControllerServiceCapability_RPC_LIST_VOLUMES); err != nil {
+		return err
+	}
+
+	created := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		var vol *csi.Volume
+		if vol, err = c.createVolume(); err != nil {
+			return err
+		}
+		defer c.deleteVolume(vol, &err)
+		created[vol.VolumeId] = true
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+	token := ""
+	for pages := 0; ; pages++ {
+		resp, err := c.controller.ListVolumes(ctx, &csi.ListVolumesRequest{
+			MaxEntries:    1,
+			StartingToken: token,
+		})
+		if err != nil {
+			return fmt.Errorf("ListVolumes failed: %v", err)
+		}
+		if len(resp.Entries) > 1 {
+			return fmt.Errorf("ListVolumes returned %v entries, expected at most 1", len(resp.Entries))
+		}
+		for _, entry := range resp.Entries {
+			delete(created, entry.Volume.VolumeId)
+		}
+		if token = resp.NextToken; token == "" {
+			break
+		}
+		if pages > 10000 {
+			return fmt.Errorf("ListVolumes did not stop returning a next token")
+		}
+	}
+
+	for id := range created {
+		return fmt.Errorf("ListVolumes did not return volume %v", id)
+	}
+	return nil
+}
+
+func checkControllerPublishMissing(c *client) error {
+	if err := c.requireController(csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME); err != nil {
+		return err
+	}
+	nodeID, err := c.nodeID()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+	_, err = c.controller.ControllerPublishVolume(ctx, &csi.ControllerPublishVolumeRequest{
+		VolumeId:         missingID,
+		NodeId:           nodeID,
+		VolumeCapability: c.capability(),
+	})
+	return expect("ControllerPublishVolume", err, codes.NotFound)
+}
+
+func checkControllerPublishIdempotent(c *client) (err error) {
+	if err := c.requireController(csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME); err != nil {
+		return err
+	}
+	vol, err := c.createVolume()
+	if err != nil {
+		return err
+	}
+	defer c.deleteVolume(vol, &err)
+
+	p, err := c.controllerPublish(vol)
+	if err != nil {
+		return err
+	}
+	defer c.unstage(p, &err)
+
+	ctx, cancel := c.context()
+	defer cancel()
+	_, err = c.controller.ControllerPublishVolume(ctx, c.publishRequest(p))
+	return expect("the second ControllerPublishVolume", err, codes.OK)
+}
+
+func checkControllerUnpublishIdempotent(c *client) (err error) {
+	if err := c.requireController(csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME); err != nil {
+		return err
+	}
+	vol, err := c.createVolume()
+	if err != nil {
+		return err
+	}
+	defer c.deleteVolume(vol, &err)
+
+	p, err := c.controllerPublish(vol)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+	req := &csi.ControllerUnpublishVolumeRequest{
+		VolumeId: vol.VolumeId,
+		NodeId:   p.nodeID,
+	}
+	if _, err := c.controller.ControllerUnpublishVolume(ctx, req); err != nil {
+		return fmt.Errorf("ControllerUnpublishVolume failed: %v", err)
+	}
+	_, err = c.controller.ControllerUnpublishVolume(ctx, req)
+	return expect("the second ControllerUnpublishVolume", err, codes.OK)
+}
+
+func checkNodeStageNoPath(c *client) (err error) {
+	if err := c.requireNode(csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME); err != nil {
+		return err
+	}
+	vol, err := c.createVolume()
+	if err != nil {
+		return err
+	}
+	defer c.deleteVolume(vol, &err)
+
+	p, err := c.controllerPublish(vol)
+	if err != nil {
+		return err
+	}
+	defer c.unstage(p, &err)
+
+	ctx, cancel := c.context()
+	defer cancel()
+	req := c.stageRequest(p)
+	req.StagingTargetPath = ""
+	_, err = c.node.NodeStageVolume(ctx, req)
+	return expect("NodeStageVolume", err, codes.InvalidArgument)
+}
+
+func checkNodeStageIdempotent(c *client) (err error) {
+	if err := c.requireNode(csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME); err != nil {
+		return err
+	}
+	vol, err := c.createVolume()
+	if err != nil {
+		return err
+	}
+	defer c.deleteVolume(vol, &err)
+
+	p, err := c.stage(vol)
+	if err != nil {
+		return err
+	}
+	defer c.unstage(p, &err)
+
+	ctx, cancel := c.context()
+	defer cancel()
+	_, err = c.node.NodeStageVolume(ctx, c.stageRequest(p))
+	return expect("the second NodeStageVolume", err, codes.OK)
+}
+
+func checkNodeUnstageIdempotent(c *client) (err error) {
+	if err := c.requireNode(csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME); err != nil {
+		return err
+	}
+	vol, err := c.createVolume()
+	if err != nil {
+		return err
+	}
+	defer c.deleteVolume(vol, &err)
+
+	p, err := c.stage(vol)
+	if err != nil {
+		return err
+	}
+	// The check unstages the volume itself; cleanup only unpublishes it.
+	p.staged = false
+	defer c.unstage(p, &err)
+
+	ctx, cancel := c.context()
+	defer cancel()
+	req := &csi.NodeUnstageVolumeRequest{
+		VolumeId:          vol.VolumeId,
+		StagingTargetPath: c.stagingPath(vol),
+	}
+	if _, err := c.node.NodeUnstageVolume(ctx, req); err != nil {
+		return fmt.Errorf("NodeUnstageVolume failed: %v", err)
+	}
+	_, err = c.node.NodeUnstageVolume(ctx, req)
+	return expect("the second NodeUnstageVolume", err, codes.OK)
+}
+
+func checkNodePublishNoPath(c *client) (err error) {
+	vol, err := c.createVolume()
+	if err != nil {
+		return err
+	}
+	defer c.deleteVolume(vol, &err)
+
+	p, err := c.stage(vol)
+	if err != nil {
+		return err
+	}
+	defer c.unstage(p, &err)
+
+	ctx, cancel := c.context()
+	defer cancel()
+	req := c.nodePublishRequest(p)
+	req.TargetPath = ""
+	_, err = c.node.NodePublishVolume(ctx, req)
+	return expect("NodePublishVolume", err, codes.InvalidArgument)
+}
+
+func checkNodePublishMissing(c *client) error {
+	ctx, cancel := c.context()
+	defer cancel()
+	vol := &csi.Volume{VolumeId: missingID}
+	p := &published{
+		vol:    vol,
+		staged: c.nodeCaps[csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME],
+	}
+	_, err := c.node.NodePublishVolume(ctx, c.nodePublishRequest(p))
+	return expect("NodePublishVolume", err, codes.NotFound)
+}
+
+func checkNodePublishIdempotent(c *client) (err error) {
+	vol, err := c.createVolume()
+	if err != nil {
+		return err
+	}
+	defer c.deleteVolume(vol, &err)
+
+	p, err := c.stage(vol)
+	if err != nil {
+		return err
+	}
+	defer c.unstage(p, &err)
+
+	ctx, cancel := c.context()
+	defer cancel()
+	req := c.nodePublishRequest(p)
+	if _, err := c.node.NodePublishVolume(ctx, req); err != nil {
+		return fmt.Errorf("NodePublishVolume failed: %v", err)
+	}
+	defer c.nodeUnpublish(p, &err)
+
+	_, err = c.node.NodePublishVolume(ctx, req)
+	return expect("the second NodePublishVolume", err, codes.OK)
+}
+
+func checkNodeUnpublishIdempotent(c *client) (err error) {
+	vol, err := c.createVolume()
+	if err != nil {
+		return err
+	}
+	defer c.deleteVolume(vol, &err)
+
+	p, err := c.stage(vol)
+	if err != nil {
+		return err
+	}
+	defer c.unstage(p, &err)
+
+	ctx, cancel := c.context()
+	defer cancel()
+	if _, err := c.node.NodePublishVolume(ctx, c.nodePublishRequest(p)); err != nil {
+		return fmt.Errorf("NodePublishVolume failed: %v", err)
+	}
+
+	req := &csi.NodeUnpublishVolumeRequest{
+		VolumeId:   vol.VolumeId,
+		TargetPath: c.targetPath(vol),
+	}
+	if _, err := c.node.NodeUnpublishVolume(ctx, req); err != nil {
+		return fmt.Errorf("NodeUnpublishVolume failed: %v", err)
+	}
+	_, err = c.node.NodeUnpublishVolume(ctx, req)
+	return expect("the second NodeUnpublishVolume", err, codes.OK)
+}
+
+func checkNodeUnpublishMissing(c *client) error {
+	ctx, cancel := c.context()
+	defer cancel()
+	_, err := c.node.NodeUnpublishVolume(ctx, &csi.NodeUnpublishVolumeRequest{
+		VolumeId:   missingID,
+		TargetPath: c.targetPath(&csi.Volume{VolumeId: missingID}),
+	})
+	return expect("NodeUnpublishVolume", err, codes.NotFound)
+}
@@ -0,0 +1,336 @@
+package sanity
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	torpedocsi "github.com/portworx/torpedo/drivers/volume/csi"
+	"github.com/portworx/torpedo/tests"
+)
+
+const (
+	// defaultCapacity is the capacity of the volumes that are created if
+	// none is configured.
+	defaultCapacity = 1 << 30
+	// rpcTimeout is how long to wait for a CSI call to complete.
+	rpcTimeout = time.Minute
+)
+
+// client runs the checks against a plugin.
+type client struct {
+	cfg        Config
+	conn       *grpc.ClientConn
+	identity   csi.IdentityClient
+	controller csi.ControllerClient
+	node       csi.NodeClient
+	plugin     string
+	// controllerCaps and nodeCaps are the RPCs the plugin supports.
+	controllerCaps map[csi.ControllerServiceCapability_RPC_Type]bool
+	nodeCaps       map[csi.NodeServiceCapability_RPC_Type]bool
+	// volumes is the number of volumes created so far, used to generate
+	// unique volume names.
+	volumes int
+}
+
+// published is a volume that was made available on the node.
+type published struct {
+	vol            *csi.Volume
+	nodeID         string
+	publishContext map[string]string
+	staged         bool
+}
+
+func newClient(cfg Config) (*client, error) {
+	if cfg.StagingPath == "" {
+		cfg.StagingPath = DefaultStagingPath
+	}
+	if cfg.TargetPath == "" {
+		cfg.TargetPath = DefaultTargetPath
+	}
+	if cfg.Capacity == 0 {
+		cfg.Capacity = defaultCapacity
+	}
+
+	conn, err := torpedocsi.Dial(cfg.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	c := &client{
+		cfg:            cfg,
+		conn:           conn,
+		identity:       csi.NewIdentityClient(conn),
+		controller:     csi.NewControllerClient(conn),
+		node:           csi.NewNodeClient(conn),
+		controllerCaps: make(map[csi.ControllerServiceCapability_RPC_Type]bool),
+		nodeCaps:       make(map[csi.NodeServiceCapability_RPC_Type]bool),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	info, err := c.identity.GetPluginInfo(ctx, &csi.GetPluginInfoRequest{})
+	if err != nil {
+		c.close()
+		return nil, fmt.Errorf("cannot reach the CSI plugin at %v: %v", cfg.Endpoint, err)
+	}
+	c.plugin = info.Name + " " + info.VendorVersion
+	log.Printf("Checking the CSI plugin %v at %v.\n", c.plugin, cfg.Endpoint)
+
+	// A plugin without a controller or node service does not support
+	// any of their optional RPCs.
+	if resp, err := c.controller.ControllerGetCapabilities(
+		ctx,
+		&csi.ControllerGetCapabilitiesRequest{},
+	); err == nil {
+		for _, capability := range resp.Capabilities {
+			c.controllerCaps[capability.GetRpc().GetType()] = true
+		}
+	}
+	if resp, err := c.node.NodeGetCapabilities(
+		ctx,
+		&csi.NodeGetCapabilitiesRequest{},
+	); err == nil {
+		for _, capability := range resp.Capabilities {
+			c.nodeCaps[capability.GetRpc().GetType()] = true
+		}
+	}
+	return c, nil
+}
+
+func (c *client) close() {
+	if err := c.conn.Close(); err != nil {
+		log.Printf("Could not close the connection to %v: %v\n", c.cfg.Endpoint, err)
+	}
+}
+
+// context returns the context an RPC is called with.
+func (c *client) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), rpcTimeout)
+}
+
+// requireController skips a check if the plugin does not support an RPC of
+// the controller service.
+func (c *client) requireController(rpc csi.ControllerServiceCapability_RPC_Type) error {
+	if !c.controllerCaps[rpc] {
+		return tests.Skip("the plugin does not have the %v controller capability", rpc)
+	}
+	return nil
+}
+
+// requireNode skips a check if the plugin does not support an RPC of the
+// node service.
+func (c *client) requireNode(rpc csi.NodeServiceCapability_RPC_Type) error {
+	if !c.nodeCaps[rpc] {
+		return tests.Skip("the plugin does not have the %v node capability", rpc)
+	}
+	return nil
+}
+
+// name returns a unique volume name.
+func (c *client) name() string {
+	c.volumes++
+	return "torpedo-sanity-" +
+		strconv.FormatInt(time.Now().Unix(), 10) + "-" +
+		strconv.Itoa(c.volumes)
+}
+
+func (c *client) capability() *csi.VolumeCapability {
+	return &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Mount{
+			Mount: &csi.VolumeCapability_MountVolume{},
+		},
+		AccessMode: &csi.VolumeCapability_AccessMode{
+			Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+		},
+	}
+}
+
+func (c *client) createRequest(name string) *csi.CreateVolumeRequest {
+	return &csi.CreateVolumeRequest{
+		Name:               name,
+		CapacityRange:      &csi.CapacityRange{RequiredBytes: c.cfg.Capacity},
+		VolumeCapabilities: []*csi.VolumeCapability{c.capability()},
+		Parameters:         c.cfg.Parameters,
+	}
+}
+
+// createVolume creates a volume for a check.  The volume must be deleted
+// with deleteVolume.
+func (c *client) createVolume() (*csi.Volume, error) {
+	if err := c.requireController(csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+	resp, err := c.controller.CreateVolume(ctx, c.createRequest(c.name()))
+	if err != nil {
+		return nil, fmt.Errorf("CreateVolume failed: %v", err)
+	}
+	return resp.Volume, nil
+}
+
+// deleteVolume deletes a volume created by a check.  It is deferred by the
+// check, and fails the check if it did not fail already.
+func (c *client) deleteVolume(vol *csi.Volume, err *error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	if _, e := c.controller.DeleteVolume(
+		ctx,
+		&csi.DeleteVolumeRequest{VolumeId: vol.VolumeId},
+	); e != nil && *err == nil {
+		*err = fmt.Errorf("DeleteVolume failed during cleanup: %v", e)
+	}
+}
+
+// nodeID returns the ID the plugin knows the node by.
+func (c *client) nodeID() (string, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	info, err := c.node.NodeGetInfo(ctx, &csi.NodeGetInfoRequest{})
+	if err != nil {
+		return "", fmt.Errorf("NodeGetInfo failed: %v", err)
+	}
+	return info.NodeId, nil
+}
+
+func (c *client) stagingPath(vol *csi.Volume) string {
+	return filepath.Join(c.cfg.StagingPath, vol.VolumeId)
+}
+
+func (c *client) targetPath(vol *csi.Volume) string {
+	return filepath.Join(c.cfg.TargetPath, vol.VolumeId)
+}
+
+// controllerPublish publishes a volume on the node if the plugin supports
+// it.
+func (c *client) controllerPublish(vol *csi.Volume) (*published, error) {
+	p := &published{vol: vol}
+	if !c.controllerCaps[csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME] {
+		return p, nil
+	}
+
+	var err error
+	if p.nodeID, err = c.nodeID(); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+	resp, err := c.controller.ControllerPublishVolume(ctx, c.publishRequest(p))
+	if err != nil {
+		return nil, fmt.Errorf("ControllerPublishVolume failed: %v", err)
+	}
+	p.publishContext = resp.PublishContext
+	return p, nil
+}
+
+// stage controller publishes and stages a volume on the node, as supported
+// by the plugin.
+func (c *client) stage(vol *csi.Volume) (*published, error) {
+	p, err := c.controllerPublish(vol)
+	if err != nil {
+		return nil, err
+	}
+	if !c.nodeCaps[csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME] {
+		return p, nil
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+	if _, err := c.node.NodeStageVolume(ctx, c.stageRequest(p)); err != nil {
+		c.unstage(p, &err)
+		return nil, fmt.Errorf("NodeStageVolume failed: %v", err)
+	}
+	p.staged = true
+	return p, nil
+}
+
+// unstage reverses stage.  It is deferred by the check, and fails the check
+// if it did not fail already.
+func (c *client) unstage(p *published, err *error) {
+	ctx, cancel := c.context()
+	defer cancel()
+
+	if p.staged {
+		if _, e := c.node.NodeUnstageVolume(ctx, &csi.NodeUnstageVolumeRequest{
+			VolumeId:          p.vol.VolumeId,
+			StagingTargetPath: c.stagingPath(p.vol),
+		}); e != nil && *err == nil {
+			*err = fmt.Errorf("NodeUnstageVolume failed during cleanup: %v", e)
+		}
+	}
+	if p.nodeID != "" {
+		if _, e := c.controller.ControllerUnpublishVolume(ctx, &csi.ControllerUnpublishVolumeRequest{
+			VolumeId: p.vol.VolumeId,
+			NodeId:   p.nodeID,
+		}); e != nil && *err == nil {
+			*err = fmt.Errorf("ControllerUnpublishVolume failed during cleanup: %v", e)
+		}
+	}
+}
+
+func (c *client) publishRequest(p *published) *csi.ControllerPublishVolumeRequest {
+	return &csi.ControllerPublishVolumeRequest{
+		VolumeId:         p.vol.VolumeId,
+		NodeId:           p.nodeID,
+		VolumeCapability: c.capability(),
+		VolumeContext:    p.vol.VolumeContext,
+	}
+}
+
+func (c *client) stageRequest(p *published) *csi.NodeStageVolumeRequest {
+	return &csi.NodeStageVolumeRequest{
+		VolumeId:          p.vol.VolumeId,
+		PublishContext:    p.publishContext,
+		StagingTargetPath: c.stagingPath(p.vol),
+		VolumeCapability:  c.capability(),
+		VolumeContext:     p.vol.VolumeContext,
+	}
+}
+
+func (c *client) nodePublishRequest(p *published) *csi.NodePublishVolumeRequest {
+	req := &csi.NodePublishVolumeRequest{
+		VolumeId:         p.vol.VolumeId,
+		PublishContext:   p.publishContext,
+		TargetPath:       c.targetPath(p.vol),
+		VolumeCapability: c.capability(),
+		VolumeContext:    p.vol.VolumeContext,
+	}
+	if p.staged {
+		req.StagingTargetPath = c.stagingPath(p.vol)
+	}
+	return req
+}
+
+// expect checks that an RPC returned the expected status code.
+func expect(rpc string, err error, code codes.Code) error {
+	if got := status.Code(err); got != code {
+		if err == nil {
+			return fmt.Errorf("%v returned %v, expected %v", rpc, got, code)
+		}
+		return fmt.Errorf("%v returned %v, expected %v: %v", rpc, got, code, err)
+	}
+	return nil
+}
+
+// nodeUnpublish unpublishes a volume that a check published.  It is
+// deferred by the check, and fails the check if it did not fail already.
+func (c *client) nodeUnpublish(p *published, err *error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	if _, e := c.node.NodeUnpublishVolume(ctx, &csi.NodeUnpublishVolumeRequest{
+		VolumeId:   p.vol.VolumeId,
+		TargetPath: c.targetPath(p.vol),
+	}); e != nil && *err == nil {
+		*err = fmt.Errorf("NodeUnpublishVolume failed during cleanup: %v", e)
+	}
+}
@@ -0,0 +1,67 @@
+package sanity
+
+import (
+	"time"
+
+	"github.com/portworx/torpedo/tests"
+)
+
+const (
+	// DefaultStagingPath is where volumes are staged by the checks.
+	DefaultStagingPath = "/var/lib/torpedo/csi-sanity/staging"
+	// DefaultTargetPath is where volumes are published by the checks.
+	DefaultTargetPath = "/var/lib/torpedo/csi-sanity/target"
+)
+
+// Config describes the plugin the checks run against.
+type Config struct {
+	// Endpoint of the CSI plugin, for example unix:///run/csi.sock.  The
+	// plugin must serve the Identity, Controller and Node services on it.
+	Endpoint string
+	// StagingPath is the staging target path used on the node.
+	StagingPath string
+	// TargetPath is the target path used on the node.
+	TargetPath string
+	// Parameters are passed to CreateVolume.
+	Parameters map[string]string
+	// Capacity of the volumes that are created, in bytes.
+	Capacity int64
+}
+
+// Check is a single contract check of a CSI RPC.
+type Check struct {
+	// Name identifies the RPC and the rule that is checked.
+	Name string
+	// Description of the rule from the CSI specification.
+	Description string
+	// run runs the check.  It returns a SkipError if the plugin does not
+	// support the RPC.
+	run func(*client) error
+}
+
+// List returns all checks in the order in which they are run.
+func List() []Check {
+	list := make([]Check, len(checks))
+	copy(list, checks)
+	return list
+}
+
+// Run runs all checks against the plugin.  It returns the name and version
+// of the plugin and the result of each check.  An error is returned if the
+// plugin cannot be reached at all.
+func Run(cfg Config) (string, []tests.Result, error) {
+	c, err := newClient(cfg)
+	if err != nil {
+		return "", nil, err
+	}
+	defer c.close()
+
+	results := make([]tests.Result, 0, len(checks))
+	for _, check := range checks {
+		start := time.Now()
+		result := tests.NewResult(check.Name, check.run(c))
+		result.Duration = time.Since(start)
+		results = append(results, result)
+	}
+	return c.plugin, results, nil
+}
@@ -0,0 +1,41 @@
+package sanity_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/portworx/torpedo/drivers/node"
+	"github.com/portworx/torpedo/drivers/volume/csi/mock"
+	"github.com/portworx/torpedo/drivers/volume/csi/sanity"
+	"github.com/portworx/torpedo/tests"
+)
+
+func TestMockPluginPassesTheChecks(t *testing.T) {
+	endpoint := "unix://" + filepath.Join(t.TempDir(), "csi.sock")
+	plugin := mock.New()
+	defer plugin.Close()
+	if err := plugin.Serve(node.Node{ID: "node1"}, endpoint); err != nil {
+		t.Fatal(err)
+	}
+
+	name, results, err := sanity.Run(sanity.Config{
+		Endpoint:    endpoint,
+		StagingPath: sanity.DefaultStagingPath,
+		TargetPath:  sanity.DefaultTargetPath,
+		Capacity:    1 << 30,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := mock.PluginName + " " + mock.PluginVersion; name != want {
+		t.Errorf("expected plugin %q, got %q", want, name)
+	}
+	if len(results) != len(sanity.List()) {
+		t.Errorf("expected %v results, got %v", len(sanity.List()), len(results))
+	}
+	for _, result := range results {
+		if result.Status != tests.Passed && result.Status != tests.Skipped {
+			t.Errorf("%v: %v %v", result.Name, result.Status, result.Err)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package dvdi
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// contentType is the media type of the plugin protocol.
+	contentType = "application/vnd.docker.plugins.v1.2+json"
+	// callTimeout is how long to wait for a plugin call to complete.
+	callTimeout = 2 * time.Minute
+)
+
+// client talks the plugin protocol to a plugin.
+type client struct {
+	http *http.Client
+	url  string
+}
+
+// specFile is the format of a JSON plugin spec file.
+type specFile struct {
+	Name      string
+	Addr      string
+	TLSConfig *struct {
+		InsecureSkipVerify bool
+		CAFile             string
+		CertFile           string
+		KeyFile            string
+	}
+}
+
+type volumeRequest struct {
+	Name string
+	Opts map[string]string `json:",omitempty"`
+	ID   string            `json:",omitempty"`
+}
+
+type errResponse struct {
+	Err string
+}
+
+type mountResponse struct {
+	Mountpoint string
+}
+
+type getResponse struct {
+	Volume *Volume
+}
+
+type listResponse struct {
+	Volumes []Volume
+}
+
+type capabilitiesResponse struct {
+	Capabilities Capabilities
+}
+
+type activateResponse struct {
+	Implements []string
+}
+
+func dial(endpoint string) (*client, error) {
+	switch filepath.Ext(endpoint) {
+	case ".spec":
+		data, err := ioutil.ReadFile(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		return newClient(strings.TrimSpace(string(data)), nil)
+	case ".json":
+		data, err := ioutil.ReadFile(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		spec := specFile{}
+		if err := json.Unmarshal(data, &spec); err != nil {
+			return nil, fmt.Errorf("could not parse %v: %v", endpoint, err)
+		}
+		var tlsConfig *tls.Config
+		if spec.TLSConfig != nil {
+			if tlsConfig, err = loadTLS(
+				spec.TLSConfig.CAFile,
+				spec.TLSConfig.CertFile,
+				spec.TLSConfig.KeyFile,
+				spec.TLSConfig.InsecureSkipVerify,
+			); err != nil {
+				return nil, err
+			}
+		}
+		return newClient(spec.Addr, tlsConfig)
+	}
+	return newClient(endpoint, nil)
+}
+
+// discover returns the endpoint of a legacy plugin the way Docker finds it
+// on this host: its socket, or else its spec file.
+func discover(plugin string) (string, error) {
+	socket := filepath.Join(SocketDir, plugin+".sock")
+	if _, err := os.Stat(socket); err == nil {
+		return "unix://" + socket, nil
+	}
+	for _, dir := range SpecDirs {
+		for _, ext := range []string{".spec", ".json"} {
+			spec := filepath.Join(dir, plugin+ext)
+			if _, err := os.Stat(spec); err == nil {
+				return spec, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("could not find the socket or spec file of plugin %v", plugin)
+}
+
+// newClient returns a client for a plugin at a unix://, tcp://, http:// or
+// https:// address.
+func newClient(address string, tlsConfig *tls.Config) (*client, error) {
+	transport := &http.Transport{TLSClientConfig: tlsConfig}
+	c := &client{http: &http.Client{Transport: transport, Timeout: callTimeout}}
+
+	scheme := "http://"
+	if tlsConfig != nil {
+		scheme = "https://"
+	}
+	switch {
+	case strings.HasPrefix(address, "unix://"):
+		socket := strings.TrimPrefix(address, "unix://")
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			dialer := net.Dialer{}
+			return dialer.DialContext(ctx, "unix", socket)
+		}
+		c.url = "http://plugin"
+	case strings.HasPrefix(address, "tcp://"):
+		c.url = scheme + strings.TrimPrefix(address, "tcp://")
+	case strings.HasPrefix(address, "http://"), strings.HasPrefix(address, "https://"):
+		c.url = address
+	default:
+		return nil, fmt.Errorf("invalid plugin address %v", address)
+	}
+	c.url = strings.TrimSuffix(c.url, "/")
+	return c, nil
+}
+
+func (c *client) Activate() error {
+	response := activateResponse{}
+	if err := c.call("/Plugin.Activate", nil, &response); err != nil {
+		return err
+	}
+	for _, implements := range response.Implements {
+		if implements == "VolumeDriver" {
+			return nil
+		}
+	}
+	return fmt.Errorf("the plugin does not implement VolumeDriver")
+}
+
+func (c *client) Create(name string, opts map[string]string) error {
+	return c.call("/VolumeDriver.Create", &volumeRequest{Name: name, Opts: opts}, nil)
+}
+
+func (c *client) Remove(name string) error {
+	return c.call("/VolumeDriver.Remove", &volumeRequest{Name: name}, nil)
+}
+
+func (c *client) Mount(name, id string) (string, error) {
+	response := mountResponse{}
+	err := c.call("/VolumeDriver.Mount", &volumeRequest{Name: name, ID: id}, &response)
+	return response.Mountpoint, err
+}
+
+func (c *client) Unmount(name, id string) error {
+	return c.call("/VolumeDriver.Unmount", &volumeRequest{Name: name, ID: id}, nil)
+}
+
+func (c *client) Path(name string) (string, error) {
+	response := mountResponse{}
+	err := c.call("/VolumeDriver.Path", &volumeRequest{Name: name}, &response)
+	return response.Mountpoint, err
+}
+
+func (c *client) Get(name string) (*Volume, error) {
+	response := getResponse{}
+	if err := c.call("/VolumeDriver.Get", &volumeRequest{Name: name}, &response); err != nil {
+		return nil, err
+	}
+	if response.Volume == nil {
+		return nil, fmt.Errorf("the plugin did not return volume %v", name)
+	}
+	return response.Volume, nil
+}
+
+func (c *client) List() ([]Volume, error) {
+	response := listResponse{}
+	if err := c.call("/VolumeDriver.List", struct{}{}, &response); err != nil {
+		return nil, err
+	}
+	return response.Volumes, nil
+}
+
+func (c *client) Capabilities() (Capabilities, error) {
+	response := capabilitiesResponse{}
+	if err := c.call("/VolumeDriver.Capabilities", struct{}{}, &response); err != nil {
+		return Capabilities{}, err
+	}
+	if response.Capabilities.Scope == "" {
+		// Plugins that do not report a scope are local.
+		response.Capabilities.Scope = ScopeLocal
+	}
+	return response.Capabilities, nil
+}
+
+// call posts a request to the plugin and decodes the response.  An error
+// reported by the plugin in the Err field is returned as is.
+func (c *client) call(path string, request, response interface{}) error {
+	body := &bytes.Buffer{}
+	if request != nil {
+		if err := json.NewEncoder(body).Encode(request); err != nil {
+			return err
+		}
+	}
+
+	httpRequest, err := http.NewRequest("POST", c.url+path, body)
+	if err != nil {
+		return err
+	}
+	httpRequest.Header.Set("Accept", contentType)
+	httpRequest.Header.Set("Content-Type", contentType)
+
+	httpResponse, err := c.http.Do(httpRequest)
+	if err != nil {
+		return err
+	}
+	defer httpResponse.Body.Close()
+
+	data, err := ioutil.ReadAll(httpResponse.Body)
+	if err != nil {
+		return err
+	}
+
+	pluginErr := errResponse{}
+	if err := json.Unmarshal(data, &pluginErr); err == nil && pluginErr.Err != "" {
+		return fmt.Errorf("%v", pluginErr.Err)
+	}
+	if httpResponse.StatusCode != http.StatusOK {
+		return fmt.Errorf(
+			"%v failed with status %v: %v",
+			path,
+			httpResponse.Status,
+			strings.TrimSpace(string(data)),
+		)
+	}
+	if response == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, response); err != nil {
+		return fmt.Errorf("could not decode the response of %v: %v", path, err)
+	}
+	return nil
+}
+
+// loadTLS returns the TLS configuration of a plugin spec file.
+func loadTLS(caFile, certFile, keyFile string, insecure bool) (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: insecure}
+	if caFile != "" {
+		ca, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("could not load the CA certificates in %v", caFile)
+		}
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,284 @@
+package conformance
+
+import (
+	"fmt"
+
+	"github.com/portworx/torpedo/drivers/volume/dvdi"
+	"github.com/portworx/torpedo/tests"
+)
+
+var checks = []Check{
+	{
+		Name:        "Plugin.Activate: implements VolumeDriver",
+		Description: "The plugin handshake reports that the plugin implements VolumeDriver.",
+		run:         checkActivate,
+	},
+	{
+		Name:        "VolumeDriver.Capabilities: scope",
+		Description: "The plugin reports a global or local scope.",
+		run:         checkScope,
+	},
+	{
+		Name:        "VolumeDriver.Create: volume is listed",
+		Description: "A created volume is returned by Get and List.",
+		run:         checkCreateListed,
+	},
+	{
+		Name:        "VolumeDriver.Get: missing volume",
+		Description: "Get of a volume that does not exist fails.",
+		run:         checkGetMissing,
+	},
+	{
+		Name:        "VolumeDriver.Path: empty before Mount",
+		Description: "Path of a volume that is not mounted returns an empty mountpoint.",
+		run:         checkPathBeforeMount,
+	},
+	{
+		Name:        "VolumeDriver.Mount: mountpoint",
+		Description: "Mount returns a mountpoint, which Path returns while the volume is mounted.",
+		run:         checkMountpoint,
+	},
+	{
+		Name:        "VolumeDriver.Mount: missing volume",
+		Description: "Mount of a volume that does not exist fails.",
+		run:         checkMountMissing,
+	},
+	{
+		Name:        "VolumeDriver.Mount: one Unmount per ID",
+		Description: "A volume mounted with two IDs stays mounted until both IDs have unmounted it.",
+		run:         checkMountTwice,
+	},
+	{
+		Name:        "VolumeDriver.Unmount: Path is empty",
+		Description: "Path of a volume returns an empty mountpoint once it is unmounted.",
+		run:         checkPathAfterUnmount,
+	},
+	{
+		Name:        "VolumeDriver.Remove: in use",
+		Description: "Remove of a mounted volume fails and keeps the volume.",
+		run:         checkRemoveInUse,
+	},
+	{
+		Name:        "VolumeDriver.Remove: volume is gone",
+		Description: "A removed volume is no longer returned by Get and List.",
+		run:         checkRemoveGone,
+	},
+	{
+		Name:        "VolumeDriver.Capabilities: scope is honored",
+		Description: "A volume of a global plugin is visible on every node, a volume of a local plugin only on the node it was created on.",
+		run:         checkScopeHonored,
+	},
+}
+
+func checkActivate(c *client) error {
+	if err := c.plugin.Activate(); err != nil {
+		return fmt.Errorf("Activate failed: %v", err)
+	}
+	return nil
+}
+
+func checkScope(c *client) error {
+	if c.scope != dvdi.ScopeGlobal && c.scope != dvdi.ScopeLocal {
+		return fmt.Errorf(
+			"Capabilities returned scope %q, expected %q or %q",
+			c.scope,
+			dvdi.ScopeGlobal,
+			dvdi.ScopeLocal,
+		)
+	}
+	return nil
+}
+
+func checkCreateListed(c *client) (err error) {
+	name, err := c.createVolume()
+	if err != nil {
+		return err
+	}
+	defer c.removeVolume(name, &err)
+
+	vol, err := c.plugin.Get(name)
+	if err != nil {
+		return fmt.Errorf("Get failed: %v", err)
+	}
+	if vol.Name != name {
+		return fmt.Errorf("Get returned volume %v instead of %v", vol.Name, name)
+	}
+	return expectListed(c.plugin, name, true)
+}
+
+func checkGetMissing(c *client) error {
+	_, err := c.plugin.Get(c.name())
+	return expectFailure("Get", err)
+}
+
+func checkPathBeforeMount(c *client) (err error) {
+	name, err := c.createVolume()
+	if err != nil {
+		return err
+	}
+	defer c.removeVolume(name, &err)
+
+	return c.expectPath(name, "")
+}
+
+func checkMountpoint(c *client) (err error) {
+	name, err := c.createVolume()
+	if err != nil {
+		return err
+	}
+	defer c.removeVolume(name, &err)
+
+	id, mountpoint, err := c.mount(name)
+	if err != nil {
+		return err
+	}
+	defer c.unmount(name, id, &err)
+
+	if mountpoint == "" {
+		return fmt.Errorf("Mount returned an empty mountpoint")
+	}
+	return c.expectPath(name, mountpoint)
+}
+
+func checkMountMissing(c *client) error {
+	_, err := c.plugin.Mount(c.name(), c.mountID())
+	return expectFailure("Mount", err)
+}
+
+func checkMountTwice(c *client) (err error) {
+	name, err := c.createVolume()
+	if err != nil {
+		return err
+	}
+	defer c.removeVolume(name, &err)
+
+	first, mountpoint, err := c.mount(name)
+	if err != nil {
+		return err
+	}
+	second, _, err := c.mount(name)
+	if err != nil {
+		c.unmount(name, first, &err)
+		return err
+	}
+
+	if err := c.plugin.Unmount(name, first); err != nil {
+		c.unmount(name, second, &err)
+		return fmt.Errorf("Unmount of the first ID failed: %v", err)
+	}
+	if err := c.expectPath(name, mountpoint); err != nil {
+		c.unmount(name, second, &err)
+		return fmt.Errorf("after unmounting the first ID: %v", err)
+	}
+
+	if err := c.plugin.Unmount(name, second); err != nil {
+		return fmt.Errorf("Unmount of the second ID failed: %v", err)
+	}
+	if err := c.expectPath(name, ""); err != nil {
+		return fmt.Errorf("after unmounting both IDs: %v", err)
+	}
+	return nil
+}
+
+func checkPathAfterUnmount(c *client) (err error) {
+	name, err := c.createVolume()
+	if err != nil {
+		return err
+	}
+	defer c.removeVolume(name, &err)
+
+	id, _, err := c.mount(name)
+	if err != nil {
+		return err
+	}
+	if err := c.plugin.Unmount(name, id); err != nil {
+		return fmt.Errorf("Unmount failed: %v", err)
+	}
+	return c.expectPath(name, "")
+}
+
+func checkRemoveInUse(c *client) (err error) {
+	name, err := c.createVolume()
+	if err != nil {
+		return err
+	}
+	defer c.removeVolume(name, &err)
+
+	id, _, err := c.mount(name)
+	if err != nil {
+		return err
+	}
+	defer c.unmount(name, id, &err)
+
+	if err := expectFailure("Remove", c.plugin.Remove(name)); err != nil {
+		return err
+	}
+	if _, err := c.plugin.Get(name); err != nil {
+		return fmt.Errorf("Get failed after the failed Remove: %v", err)
+	}
+	return nil
+}
+
+func checkRemoveGone(c *client) error {
+	name, err := c.createVolume()
+	if err != nil {
+		return err
+	}
+	if err := c.plugin.Remove(name); err != nil {
+		return fmt.Errorf("Remove failed: %v", err)
+	}
+	if _, err := c.plugin.Get(name); err == nil {
+		return fmt.Errorf("Get returned the removed volume")
+	}
+	return expectListed(c.plugin, name, false)
+}
+
+func checkScopeHonored(c *client) (err error) {
+	if len(c.peers) == 0 {
+		return tests.Skip("the plugin is not checked on other nodes")
+	}
+
+	name, err := c.createVolume()
+	if err != nil {
+		return err
+	}
+	defer c.removeVolume(name, &err)
+
+	for i, peer := range c.peers {
+		_, err := peer.Get(name)
+		switch {
+		case c.scope == dvdi.ScopeGlobal && err != nil:
+			return fmt.Errorf(
+				"the volume of a global plugin is not visible at %v: %v",
+				c.cfg.Peers[i],
+				err,
+			)
+		case c.scope != dvdi.ScopeGlobal && err == nil:
+			return fmt.Errorf(
+				"the volume of a local plugin is visible at %v",
+				c.cfg.Peers[i],
+			)
+		}
+	}
+	return nil
+}
+
+// expectListed checks whether List returns a volume.
+func expectListed(plugin dvdi.Client, name string, listed bool) error {
+	volumes, err := plugin.List()
+	if err != nil {
+		return fmt.Errorf("List failed: %v", err)
+	}
+	for _, vol := range volumes {
+		if vol.Name == name {
+			if !listed {
+				return fmt.Errorf("List returned volume %v", name)
+			}
+			return nil
+		}
+	}
+	if listed {
+		return fmt.Errorf("List did not return volume %v", name)
+	}
+	return nil
+}
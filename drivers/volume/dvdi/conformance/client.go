@@ -0,0 +1,123 @@
+package conformance
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/portworx/torpedo/drivers/volume/dvdi"
+)
+
+// client runs the checks against a plugin.
+type client struct {
+	cfg    Config
+	plugin dvdi.Client
+	peers  []dvdi.Client
+	scope  string
+	// volumes is the number of volumes created so far, used to generate
+	// unique volume names.
+	volumes int
+	// mounts is the number of mount IDs generated so far.
+	mounts int
+}
+
+func newClient(cfg Config) (*client, error) {
+	plugin, err := dvdi.Dial(cfg.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if err := plugin.Activate(); err != nil {
+		return nil, fmt.Errorf("cannot activate the plugin at %v: %v", cfg.Endpoint, err)
+	}
+	capabilities, err := plugin.Capabilities()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get the capabilities of the plugin at %v: %v", cfg.Endpoint, err)
+	}
+	log.Printf(
+		"Checking the Docker volume plugin at %v with %v scope.\n",
+		cfg.Endpoint,
+		capabilities.Scope,
+	)
+
+	c := &client{cfg: cfg, plugin: plugin, scope: capabilities.Scope}
+	for _, endpoint := range cfg.Peers {
+		peer, err := dvdi.Dial(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		c.peers = append(c.peers, peer)
+	}
+	return c, nil
+}
+
+// name returns a unique volume name.
+func (c *client) name() string {
+	c.volumes++
+	return "torpedo-conformance-" +
+		strconv.FormatInt(time.Now().Unix(), 10) + "-" +
+		strconv.Itoa(c.volumes)
+}
+
+// mountID returns a unique mount ID.
+func (c *client) mountID() string {
+	c.mounts++
+	return "torpedo-conformance-" + strconv.Itoa(c.mounts)
+}
+
+// createVolume creates a volume for a check.  The volume must be removed
+// with removeVolume.
+func (c *client) createVolume() (string, error) {
+	name := c.name()
+	if err := c.plugin.Create(name, c.cfg.Opts); err != nil {
+		return "", fmt.Errorf("Create failed: %v", err)
+	}
+	return name, nil
+}
+
+// removeVolume removes a volume created by a check.  It is deferred by the
+// check, and fails the check if it did not fail already.
+func (c *client) removeVolume(name string, err *error) {
+	if e := c.plugin.Remove(name); e != nil && *err == nil {
+		*err = fmt.Errorf("Remove failed during cleanup: %v", e)
+	}
+}
+
+// mount mounts a volume for a check.  The volume must be unmounted with
+// unmount.
+func (c *client) mount(name string) (string, string, error) {
+	id := c.mountID()
+	mountpoint, err := c.plugin.Mount(name, id)
+	if err != nil {
+		return "", "", fmt.Errorf("Mount failed: %v", err)
+	}
+	return id, mountpoint, nil
+}
+
+// unmount unmounts a volume a check mounted.  It is deferred by the check,
+// and fails the check if it did not fail already.
+func (c *client) unmount(name, id string, err *error) {
+	if e := c.plugin.Unmount(name, id); e != nil && *err == nil {
+		*err = fmt.Errorf("Unmount failed during cleanup: %v", e)
+	}
+}
+
+// expectPath checks the mountpoint Path returns for a volume.
+func (c *client) expectPath(name, mountpoint string) error {
+	path, err := c.plugin.Path(name)
+	if err != nil {
+		return fmt.Errorf("Path failed: %v", err)
+	}
+	if path != mountpoint {
+		return fmt.Errorf("Path returned %q, expected %q", path, mountpoint)
+	}
+	return nil
+}
+
+// expectFailure checks that a plugin call failed.
+func expectFailure(call string, err error) error {
+	if err == nil {
+		return fmt.Errorf("%v succeeded, expected it to fail", call)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package conformance
+
+import (
+	"time"
+
+	"github.com/portworx/torpedo/tests"
+)
+
+// Config describes the plugin the checks run against.
+type Config struct {
+	// Endpoint of the plugin, such as unix:///run/docker/plugins/foo.sock,
+	// tcp://10.0.0.1:8080 or the path to its spec file.
+	Endpoint string
+	// Peers are the endpoints of the same plugin on other nodes.  They
+	// are used to check that the plugin honors its scope, which is skipped
+	// without peers.
+	Peers []string
+	// Opts are passed to /VolumeDriver.Create.
+	Opts map[string]string
+}
+
+// Check is a single check of the plugin protocol semantics.
+type Check struct {
+	// Name identifies the plugin call and the rule that is checked.
+	Name string
+	// Description of the rule Docker relies on.
+	Description string
+	// run runs the check.  It returns a SkipError if the check does not
+	// apply to the plugin.
+	run func(*client) error
+}
+
+// List returns all checks in the order in which they are run.
+func List() []Check {
+	list := make([]Check, len(checks))
+	copy(list, checks)
+	return list
+}
+
+// Run runs all checks against the plugin and returns the result of each
+// check.  An error is returned if the plugin cannot be reached at all.
+func Run(cfg Config) ([]tests.Result, error) {
+	c, err := newClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]tests.Result, 0, len(checks))
+	for _, check := range checks {
+		start := time.Now()
+		result := tests.NewResult(check.Name, check.run(c))
+		result.Duration = time.Since(start)
+		results = append(results, result)
+	}
+	return results, nil
+}
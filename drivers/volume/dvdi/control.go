@@ -0,0 +1,222 @@
+package dvdi
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/portworx/torpedo/config"
+	"github.com/portworx/torpedo/drivers/node"
+)
+
+// control stops and starts the plugin on a node.
+type control interface {
+	// stop makes the plugin exit on a node.
+	stop(n node.Node) error
+	// start starts the plugin on a node.
+	start(n node.Node) error
+	// version returns the version of the plugin on a node.
+	version(n node.Node) (string, error)
+	// endpoint returns the endpoint of the plugin on a node, or an empty
+	// string if it is unknown.
+	endpoint(n node.Node) (string, error)
+}
+
+// managedPlugin controls a plugin installed with docker plugin install
+// through the Docker plugins API.
+type managedPlugin struct {
+	config *config.Config
+	name   string
+}
+
+// containerPlugin controls a legacy plugin that runs in a Docker container.
+type containerPlugin struct {
+	config    *config.Config
+	container string
+}
+
+// systemdPlugin controls a legacy plugin that runs as a systemd unit.
+type systemdPlugin struct {
+	config *config.Config
+	unit   string
+}
+
+// pluginInfo is the part of the Docker plugin inspect response the driver
+// uses.
+type pluginInfo struct {
+	ID              string `json:"Id"`
+	Name            string
+	PluginReference string
+	Enabled         bool
+	Config          struct {
+		Interface struct {
+			Socket string
+		}
+	}
+}
+
+func (p *managedPlugin) stop(n node.Node) error {
+	// Force disabling the plugin, since it is in use by the test task.
+	return dockerCall(
+		p.config.Lookup(n.MgmtIP),
+		"POST",
+		"/plugins/"+url.PathEscape(p.name)+"/disable?force=1",
+		nil,
+	)
+}
+
+func (p *managedPlugin) start(n node.Node) error {
+	return dockerCall(
+		p.config.Lookup(n.MgmtIP),
+		"POST",
+		"/plugins/"+url.PathEscape(p.name)+"/enable?timeout=30",
+		nil,
+	)
+}
+
+func (p *managedPlugin) version(n node.Node) (string, error) {
+	info, err := p.inspect(n)
+	if err != nil {
+		return "", err
+	}
+	return info.PluginReference, nil
+}
+
+// endpoint returns the socket of the plugin.  Docker creates the socket of
+// a managed plugin in a directory named after the plugin ID.
+func (p *managedPlugin) endpoint(n node.Node) (string, error) {
+	info, err := p.inspect(n)
+	if err != nil {
+		return "", err
+	}
+	if info.Config.Interface.Socket == "" {
+		return "", fmt.Errorf("plugin %v does not have a socket", p.name)
+	}
+	return "unix://" + filepath.Join(SocketDir, info.ID, info.Config.Interface.Socket), nil
+}
+
+func (p *managedPlugin) inspect(n node.Node) (*pluginInfo, error) {
+	info := &pluginInfo{}
+	if err := dockerCall(
+		p.config.Lookup(n.MgmtIP),
+		"GET",
+		"/plugins/"+url.PathEscape(p.name)+"/json",
+		info,
+	); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (p *containerPlugin) stop(n node.Node) error {
+	cfgNode := p.config.Lookup(n.MgmtIP)
+	docker, err := cfgNode.DockerClient()
+	if err != nil {
+		return err
+	}
+	return docker.StopContainer(p.container, 10)
+}
+
+func (p *containerPlugin) start(n node.Node) error {
+	cfgNode := p.config.Lookup(n.MgmtIP)
+	docker, err := cfgNode.DockerClient()
+	if err != nil {
+		return err
+	}
+	return docker.StartContainer(p.container, nil)
+}
+
+// version returns the image of the plugin container.
+func (p *containerPlugin) version(n node.Node) (string, error) {
+	cfgNode := p.config.Lookup(n.MgmtIP)
+	docker, err := cfgNode.DockerClient()
+	if err != nil {
+		return "", err
+	}
+	info, err := docker.InspectContainer(p.container)
+	if err != nil {
+		return "", err
+	}
+	return info.Config.Image, nil
+}
+
+func (p *containerPlugin) endpoint(n node.Node) (string, error) {
+	return "", nil
+}
+
+func (p *systemdPlugin) stop(n node.Node) error {
+	return node.NewExecutor(p.config, n).StopService(p.unit)
+}
+
+func (p *systemdPlugin) start(n node.Node) error {
+	return node.NewExecutor(p.config, n).StartService(p.unit)
+}
+
+// version returns the unit of the plugin, since systemd does not know the
+// version of the software it runs.
+func (p *systemdPlugin) version(n node.Node) (string, error) {
+	return "systemd unit " + p.unit, nil
+}
+
+func (p *systemdPlugin) endpoint(n node.Node) (string, error) {
+	return "", nil
+}
+
+// dockerCall calls the Docker API of a node and decodes the response, if
+// any.  It is used for the plugins API, which the Docker client does not
+// support.
+func dockerCall(cfgNode config.Node, method, path string, response interface{}) error {
+	var tlsConfig *tls.Config
+	if cfgNode.Docker.TLS.Cert != "" {
+		var err error
+		if tlsConfig, err = loadTLS(
+			cfgNode.Docker.TLS.CA,
+			cfgNode.Docker.TLS.Cert,
+			cfgNode.Docker.TLS.Key,
+			false,
+		); err != nil {
+			return err
+		}
+	}
+	c, err := newClient(cfgNode.Docker.Endpoint, tlsConfig)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(method, c.url+path, nil)
+	if err != nil {
+		return err
+	}
+	httpResponse, err := c.http.Do(request)
+	if err != nil {
+		return err
+	}
+	defer httpResponse.Body.Close()
+
+	data, err := ioutil.ReadAll(httpResponse.Body)
+	if err != nil {
+		return err
+	}
+	if httpResponse.StatusCode < 200 || httpResponse.StatusCode >= 300 {
+		dockerErr := struct{ Message string }{}
+		if err := json.Unmarshal(data, &dockerErr); err == nil && dockerErr.Message != "" {
+			return fmt.Errorf("%v %v failed: %v", method, path, dockerErr.Message)
+		}
+		return fmt.Errorf(
+			"%v %v failed with status %v: %v",
+			method,
+			path,
+			httpResponse.Status,
+			strings.TrimSpace(string(data)),
+		)
+	}
+	if response == nil {
+		return nil
+	}
+	return json.Unmarshal(data, response)
+}
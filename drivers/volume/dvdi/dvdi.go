@@ -0,0 +1,145 @@
+package dvdi
+
+import (
+	"github.com/portworx/torpedo/drivers/node"
+	"github.com/portworx/torpedo/drivers/volume"
+)
+
+const (
+	// Name is the name the DVDI volume driver is registered under.
+	Name = "dvdi"
+	// SocketDir is where Docker looks for the sockets of legacy plugins.
+	SocketDir = "/run/docker/plugins"
+	// ScopeGlobal is the scope of a plugin whose volumes are visible on
+	// every node.
+	ScopeGlobal = "global"
+	// ScopeLocal is the scope of a plugin whose volumes are only visible
+	// on the node they were created on.
+	ScopeLocal = "local"
+)
+
+var (
+	// SpecDirs are where Docker looks for the spec files of legacy
+	// plugins, in order.
+	SpecDirs = []string{"/etc/docker/plugins", "/usr/lib/docker/plugins"}
+)
+
+// Control is how the plugin is stopped and started on a node.
+type Control int
+
+const (
+	// ManagedPlugin is a plugin installed with docker plugin install.  It
+	// is stopped and started by disabling and enabling it.
+	ManagedPlugin Control = iota
+	// Container is a legacy plugin that runs in a Docker container.
+	Container
+	// Systemd is a legacy plugin that runs as a systemd unit.
+	Systemd
+)
+
+// Volume is a volume as reported by the plugin.
+type Volume struct {
+	// Name of the volume.
+	Name string
+	// Mountpoint is the path the volume is mounted at on the node, if any.
+	Mountpoint string
+	// Status is plugin specific status information.
+	Status map[string]interface{}
+}
+
+// Capabilities are the capabilities the plugin reports.
+type Capabilities struct {
+	// Scope is ScopeGlobal or ScopeLocal.
+	Scope string
+}
+
+// Client talks the Docker volume plugin protocol to a plugin.  Errors the
+// plugin reports in the Err field of a response are returned as is.
+type Client interface {
+	// Activate handshakes with the plugin and checks that it implements
+	// VolumeDriver.
+	Activate() error
+	// Create calls /VolumeDriver.Create.
+	Create(name string, opts map[string]string) error
+	// Remove calls /VolumeDriver.Remove.
+	Remove(name string) error
+	// Mount calls /VolumeDriver.Mount and returns the mountpoint.
+	Mount(name, id string) (string, error)
+	// Unmount calls /VolumeDriver.Unmount.
+	Unmount(name, id string) error
+	// Path calls /VolumeDriver.Path and returns the mountpoint.
+	Path(name string) (string, error)
+	// Get calls /VolumeDriver.Get.
+	Get(name string) (*Volume, error)
+	// List calls /VolumeDriver.List.
+	List() ([]Volume, error)
+	// Capabilities calls /VolumeDriver.Capabilities.  Plugins that do not
+	// report a scope are local.
+	Capabilities() (Capabilities, error)
+}
+
+// Driver is a volume driver for any Docker volume plugin.  It talks the
+// Docker volume plugin protocol (DVDI) to the plugin on each node, over the
+// plugin's unix socket or the address in its spec file.
+//
+// The driver is configured with the volume options:
+//
+//	plugin     name of the plugin as Docker knows it, required
+//	control    plugin, container or systemd, defaults to plugin
+//	container  container of a legacy plugin, defaults to the plugin name
+//	unit       systemd unit of a legacy plugin, defaults to <plugin>.service
+//
+// The volume endpoint is the address of the plugin, such as
+// unix:///run/docker/plugins/foo.sock, tcp://{address}:8080 or the path to
+// a spec file.  {address} and {id} are replaced with the address and ID of
+// each node.  By default, the plugin is discovered the way Docker discovers
+// it on the node Torpedo runs on.
+type Driver interface {
+	volume.Driver
+
+	// Create creates a volume with /VolumeDriver.Create on a node.  The
+	// name can be an inline volume specification, such as
+	// size=10G,name=foo, in which case the other options are passed to
+	// the plugin as volume options.
+	Create(n node.Node, name string) error
+
+	// Mount mounts a volume on a node with /VolumeDriver.Mount.
+	Mount(n node.Node, name string) error
+
+	// Unmount unmounts a volume on a node with /VolumeDriver.Unmount.
+	Unmount(n node.Node, name string) error
+
+	// Delete removes a volume with /VolumeDriver.Remove on a node.
+	Delete(n node.Node, name string) error
+
+	// Get returns a volume with /VolumeDriver.Get on a node.
+	Get(n node.Node, name string) (*Volume, error)
+
+	// List returns the volumes with /VolumeDriver.List on a node.
+	List(n node.Node) ([]Volume, error)
+
+	// Exists returns true if the plugin lists the volume on any node.  A
+	// volume is assumed to exist if the plugin cannot be reached.
+	Exists(name string) bool
+
+	// Capabilities returns the capabilities of the plugin on a node with
+	// /VolumeDriver.Capabilities.
+	Capabilities(n node.Node) (Capabilities, error)
+}
+
+// New returns a new DVDI volume driver.  It must be initialized with Init
+// before use.
+func New() Driver {
+	return newDriver()
+}
+
+// Dial returns a client for the plugin at an endpoint, which is either the
+// address of the plugin, such as unix:///run/docker/plugins/foo.sock or
+// tcp://10.0.0.1:8080, or the path to its spec file.
+func Dial(endpoint string) (Client, error) {
+	return dial(endpoint)
+}
+
+func init() {
+	volume.Register(Name, New())
+}
@@ -0,0 +1,396 @@
+package dvdi
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/portworx/torpedo/config"
+	"github.com/portworx/torpedo/drivers/node"
+	"github.com/portworx/torpedo/drivers/volume"
+)
+
+const (
+	// startTimeout is how long to wait for the plugin to become usable.
+	startTimeout = 2 * time.Minute
+)
+
+type driver struct {
+	sync.Mutex
+	plugin   string
+	endpoint string
+	control  control
+	nodes    []node.Node
+	clients  map[string]*client
+	// mounts holds the nodes each volume is mounted on.
+	mounts map[string]map[string]bool
+}
+
+func newDriver() *driver {
+	return &driver{
+		clients: make(map[string]*client),
+		mounts:  make(map[string]map[string]bool),
+	}
+}
+
+// String returns the name of the plugin, which is the volume driver name
+// Docker knows it by.
+func (d *driver) String() string {
+	if d.plugin == "" {
+		return Name
+	}
+	return d.plugin
+}
+
+func (d *driver) Init(cfg *config.Config) error {
+	nodes, err := node.FromConfig(cfg)
+	if err != nil {
+		return err
+	}
+	if len(nodes) == 0 {
+		return fmt.Errorf("there are no nodes in the cluster")
+	}
+
+	opts := cfg.Volume.Options
+	plugin := opts["plugin"]
+	if plugin == "" {
+		return fmt.Errorf("the plugin volume option is not set")
+	}
+
+	d.Lock()
+	defer d.Unlock()
+	d.plugin = plugin
+	d.endpoint = cfg.Volume.Endpoint
+	d.nodes = nodes
+	switch opts["control"] {
+	case "", "plugin":
+		d.control = &managedPlugin{config: cfg, name: plugin}
+	case "container":
+		d.control = &containerPlugin{
+			config:    cfg,
+			container: option(opts, "container", plugin),
+		}
+	case "systemd":
+		d.control = &systemdPlugin{
+			config: cfg,
+			unit:   option(opts, "unit", plugin+".service"),
+		}
+	default:
+		return fmt.Errorf(
+			"unknown plugin control %v, expected plugin, container or systemd",
+			opts["control"],
+		)
+	}
+
+	first := d.firstNode()
+	c, err := d.client(first)
+	if err != nil {
+		return err
+	}
+	if err := c.Activate(); err != nil {
+		return fmt.Errorf("cannot activate plugin %v on %v: %v", plugin, first.MgmtIP, err)
+	}
+	capabilities, err := c.Capabilities()
+	if err != nil {
+		return err
+	}
+
+	log.Printf(
+		"Using the Docker volume plugin %v with %v scope.\n",
+		plugin,
+		capabilities.Scope,
+	)
+	return nil
+}
+
+func (d *driver) Version() (string, error) {
+	return d.control.version(d.firstNode())
+}
+
+// CleanupVolume unmounts the volume from every node it is mounted on and
+// removes it from every node the plugin reports it on.
+func (d *driver) CleanupVolume(name string) error {
+	d.Lock()
+	defer d.Unlock()
+
+	name = volume.ParseName(name)
+	for _, n := range d.nodes {
+		if d.mounts[name][n.ID] {
+			if err := d.unmount(n, name); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, n := range d.nodes {
+		c, err := d.client(n)
+		if err != nil {
+			log.Printf("Cannot reach plugin %v on %v: %v\n", d.plugin, n.MgmtIP, err)
+			continue
+		}
+		if _, err := c.Get(name); err != nil {
+			continue
+		}
+		if err := c.Remove(name); err != nil {
+			return fmt.Errorf(
+				"error while removing %v on %v because of: %v",
+				name,
+				n.MgmtIP,
+				err,
+			)
+		}
+		log.Printf("Successfully removed volume %v on %v\n", name, n.MgmtIP)
+	}
+	delete(d.mounts, name)
+	return nil
+}
+
+func (d *driver) StopDriver(n node.Node) error {
+	if err := d.control.stop(n); err != nil {
+		return err
+	}
+
+	d.Lock()
+	defer d.Unlock()
+	delete(d.clients, n.ID)
+	return nil
+}
+
+func (d *driver) StartDriver(n node.Node) error {
+	d.Lock()
+	defer d.Unlock()
+
+	// The plugin may listen on a new socket, so find it again.
+	delete(d.clients, n.ID)
+	return d.control.start(n)
+}
+
+// WaitStart waits for the plugin on the node to activate.
+func (d *driver) WaitStart(n node.Node) error {
+	d.Lock()
+	defer d.Unlock()
+
+	var err error
+	for start := time.Now(); time.Since(start) < startTimeout; time.Sleep(time.Second) {
+		var c *client
+		if c, err = d.client(n); err != nil {
+			delete(d.clients, n.ID)
+			continue
+		}
+		if err = c.Activate(); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("plugin %v did not start on %v: %v", d.plugin, n.MgmtIP, err)
+}
+
+func (d *driver) Create(n node.Node, name string) error {
+	d.Lock()
+	defer d.Unlock()
+
+	c, err := d.client(n)
+	if err != nil {
+		return err
+	}
+	volName, opts := parseSpec(name)
+	if err := c.Create(volName, opts); err != nil {
+		return err
+	}
+	log.Printf("Created volume %v on %v\n", volName, n.MgmtIP)
+	return nil
+}
+
+func (d *driver) Mount(n node.Node, name string) error {
+	d.Lock()
+	defer d.Unlock()
+
+	name = volume.ParseName(name)
+	c, err := d.client(n)
+	if err != nil {
+		return err
+	}
+	mountpoint, err := c.Mount(name, mountID(n))
+	if err != nil {
+		return err
+	}
+
+	if d.mounts[name] == nil {
+		d.mounts[name] = make(map[string]bool)
+	}
+	d.mounts[name][n.ID] = true
+	log.Printf("Mounted volume %v on %v at %v\n", name, n.MgmtIP, mountpoint)
+	return nil
+}
+
+func (d *driver) Unmount(n node.Node, name string) error {
+	d.Lock()
+	defer d.Unlock()
+
+	return d.unmount(n, volume.ParseName(name))
+}
+
+func (d *driver) Delete(n node.Node, name string) error {
+	d.Lock()
+	defer d.Unlock()
+
+	name = volume.ParseName(name)
+	c, err := d.client(n)
+	if err != nil {
+		return err
+	}
+	if err := c.Remove(name); err != nil {
+		return err
+	}
+	delete(d.mounts, name)
+	return nil
+}
+
+func (d *driver) Get(n node.Node, name string) (*Volume, error) {
+	d.Lock()
+	defer d.Unlock()
+
+	c, err := d.client(n)
+	if err != nil {
+		return nil, err
+	}
+	return c.Get(volume.ParseName(name))
+}
+
+func (d *driver) List(n node.Node) ([]Volume, error) {
+	d.Lock()
+	defer d.Unlock()
+
+	c, err := d.client(n)
+	if err != nil {
+		return nil, err
+	}
+	return c.List()
+}
+
+func (d *driver) Exists(name string) bool {
+	d.Lock()
+	defer d.Unlock()
+
+	name = volume.ParseName(name)
+	for _, n := range d.nodes {
+		c, err := d.client(n)
+		if err != nil {
+			return true
+		}
+		volumes, err := c.List()
+		if err != nil {
+			return true
+		}
+		for _, v := range volumes {
+			if v.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (d *driver) Capabilities(n node.Node) (Capabilities, error) {
+	d.Lock()
+	defer d.Unlock()
+
+	c, err := d.client(n)
+	if err != nil {
+		return Capabilities{}, err
+	}
+	return c.Capabilities()
+}
+
+func (d *driver) unmount(n node.Node, name string) error {
+	c, err := d.client(n)
+	if err != nil {
+		return err
+	}
+	if err := c.Unmount(name, mountID(n)); err != nil {
+		return err
+	}
+	delete(d.mounts[name], n.ID)
+	return nil
+}
+
+// firstNode returns the node Torpedo runs on if it is in the cluster, and
+// the first node otherwise.
+func (d *driver) firstNode() node.Node {
+	for _, n := range d.nodes {
+		if n.Local {
+			return n
+		}
+	}
+	return d.nodes[0]
+}
+
+// client returns a client for the plugin on a node.  The plugin is found at
+// the configured endpoint, or else the way Docker finds it.
+func (d *driver) client(n node.Node) (*client, error) {
+	if c, ok := d.clients[n.ID]; ok {
+		return c, nil
+	}
+
+	endpoint := d.endpoint
+	if endpoint != "" {
+		endpoint = strings.Replace(endpoint, "{address}", n.MgmtIP, -1)
+		endpoint = strings.Replace(endpoint, "{id}", n.ID, -1)
+	} else {
+		var err error
+		if endpoint, err = d.control.endpoint(n); err != nil {
+			return nil, err
+		}
+		if endpoint == "" {
+			if endpoint, err = discover(d.plugin); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if strings.HasPrefix(endpoint, "unix://") && !n.Local {
+		return nil, fmt.Errorf(
+			"the socket %v of plugin %v on %v can only be reached on the node Torpedo runs on, configure a tcp endpoint instead",
+			endpoint,
+			d.plugin,
+			n.MgmtIP,
+		)
+	}
+
+	c, err := dial(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	d.clients[n.ID] = c
+	return c, nil
+}
+
+// mountID is the ID Torpedo mounts volumes with on a node.  The plugin
+// counts the mounts of a volume by ID.
+func mountID(n node.Node) string {
+	return "torpedo-" + n.ID
+}
+
+// parseSpec returns the name and the options of an inline volume
+// specification.
+func parseSpec(spec string) (string, map[string]string) {
+	name := volume.ParseName(spec)
+	opts := make(map[string]string)
+	if !strings.Contains(spec, "=") {
+		return name, opts
+	}
+
+	for _, opt := range strings.Split(spec, ",") {
+		if kv := strings.SplitN(opt, "=", 2); len(kv) == 2 && kv[0] != "name" {
+			opts[kv[0]] = kv[1]
+		}
+	}
+	return name, opts
+}
+
+func option(opts map[string]string, key, def string) string {
+	if v, ok := opts[key]; ok && v != "" {
+		return v
+	}
+	return def
+}
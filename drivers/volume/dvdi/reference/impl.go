@@ -0,0 +1,475 @@
+package reference
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/portworx/torpedo/drivers/node"
+	"github.com/portworx/torpedo/drivers/volume/dvdi"
+)
+
+const (
+	// dataDir is the directory in a volume that is its mountpoint.
+	dataDir = "_data"
+	// imageFile is the loop file in a volume that backs it.
+	imageFile = "disk.img"
+	// optsFile is the file in a volume that holds its options.
+	optsFile = "opts.json"
+)
+
+type plugin struct {
+	sync.Mutex
+	cfg       Config
+	endpoints map[string]string
+	servers   map[string]*http.Server
+	// mounts holds the IDs each volume directory is mounted with on each
+	// node.
+	mounts map[string]map[string]map[string]bool
+}
+
+// server serves the plugin for a single node.
+type server struct {
+	plugin *plugin
+	nodeID string
+}
+
+type volumeRequest struct {
+	Name string
+	Opts map[string]string
+	ID   string
+}
+
+type errResponse struct {
+	Err string
+}
+
+type mountResponse struct {
+	Mountpoint string
+}
+
+type getResponse struct {
+	Volume *dvdi.Volume
+}
+
+type listResponse struct {
+	Volumes []dvdi.Volume
+}
+
+func newPlugin(cfg Config) *plugin {
+	if cfg.Root == "" {
+		cfg.Root = DefaultRoot
+	}
+	if cfg.Scope == "" {
+		cfg.Scope = dvdi.ScopeLocal
+	}
+	return &plugin{
+		cfg:       cfg,
+		endpoints: make(map[string]string),
+		servers:   make(map[string]*http.Server),
+		mounts:    make(map[string]map[string]map[string]bool),
+	}
+}
+
+func (p *plugin) Serve(n node.Node, endpoint string) error {
+	p.Lock()
+	defer p.Unlock()
+
+	if _, ok := p.servers[n.ID]; ok {
+		return fmt.Errorf("the plugin is already serving %v", n.ID)
+	}
+	p.endpoints[n.ID] = endpoint
+	return p.serve(n.ID)
+}
+
+func (p *plugin) Stop(n node.Node) error {
+	p.Lock()
+	defer p.Unlock()
+
+	s, ok := p.servers[n.ID]
+	if !ok {
+		return fmt.Errorf("the plugin is not running on %v", n.ID)
+	}
+	delete(p.servers, n.ID)
+	return s.Close()
+}
+
+func (p *plugin) Start(n node.Node) error {
+	p.Lock()
+	defer p.Unlock()
+
+	if _, ok := p.endpoints[n.ID]; !ok {
+		return fmt.Errorf("the plugin was never served on %v", n.ID)
+	}
+	if _, ok := p.servers[n.ID]; ok {
+		return fmt.Errorf("the plugin is not stopped on %v", n.ID)
+	}
+	return p.serve(n.ID)
+}
+
+func (p *plugin) Close() {
+	p.Lock()
+	defer p.Unlock()
+
+	for id, s := range p.servers {
+		if err := s.Close(); err != nil {
+			log.Printf("Could not stop the reference plugin on %v: %v\n", id, err)
+		}
+		delete(p.servers, id)
+	}
+}
+
+func (p *plugin) serve(id string) error {
+	endpoint := p.endpoints[id]
+	var l net.Listener
+	var err error
+	switch {
+	case strings.HasPrefix(endpoint, "unix://"):
+		socket := strings.TrimPrefix(endpoint, "unix://")
+		if err := os.MkdirAll(filepath.Dir(socket), 0755); err != nil {
+			return err
+		}
+		if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		l, err = net.Listen("unix", socket)
+	case strings.HasPrefix(endpoint, "tcp://"):
+		l, err = net.Listen("tcp", strings.TrimPrefix(endpoint, "tcp://"))
+	default:
+		return fmt.Errorf("invalid plugin endpoint %v", endpoint)
+	}
+	if err != nil {
+		return err
+	}
+
+	srv := &server{plugin: p, nodeID: id}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/Plugin.Activate", srv.activate)
+	mux.HandleFunc("/VolumeDriver.Create", srv.handle(srv.create))
+	mux.HandleFunc("/VolumeDriver.Remove", srv.handle(srv.remove))
+	mux.HandleFunc("/VolumeDriver.Mount", srv.handle(srv.mount))
+	mux.HandleFunc("/VolumeDriver.Unmount", srv.handle(srv.unmount))
+	mux.HandleFunc("/VolumeDriver.Path", srv.handle(srv.path))
+	mux.HandleFunc("/VolumeDriver.Get", srv.handle(srv.get))
+	mux.HandleFunc("/VolumeDriver.List", srv.handle(srv.list))
+	mux.HandleFunc("/VolumeDriver.Capabilities", srv.handle(srv.capabilities))
+
+	s := &http.Server{Handler: mux}
+	p.servers[id] = s
+	go func() {
+		// Serve returns once the server is closed.
+		if err := s.Serve(l); err != nil && err != http.ErrServerClosed {
+			log.Printf("The reference plugin on %v failed: %v\n", id, err)
+		}
+	}()
+	return nil
+}
+
+// dir returns the directory of a volume as seen from a node.
+func (p *plugin) dir(nodeID, name string) string {
+	if p.cfg.Scope == dvdi.ScopeGlobal {
+		return filepath.Join(p.cfg.Root, name)
+	}
+	return filepath.Join(p.cfg.Root, nodeID, name)
+}
+
+// volume returns the directory of an existing volume as seen from a node.
+func (p *plugin) volume(nodeID, name string) (string, error) {
+	if err := validName(name); err != nil {
+		return "", err
+	}
+	dir := p.dir(nodeID, name)
+	if _, err := os.Stat(filepath.Join(dir, optsFile)); err != nil {
+		return "", fmt.Errorf("volume %v does not exist", name)
+	}
+	return dir, nil
+}
+
+func (s *server) activate(w http.ResponseWriter, r *http.Request) {
+	reply(w, struct{ Implements []string }{[]string{"VolumeDriver"}})
+}
+
+// handle decodes the request of a plugin call, runs it with the plugin
+// locked and replies with its response or error.
+func (s *server) handle(
+	call func(request *volumeRequest) (interface{}, error),
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		request := &volumeRequest{}
+		if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+			reply(w, &errResponse{Err: fmt.Sprintf("invalid request: %v", err)})
+			return
+		}
+
+		s.plugin.Lock()
+		response, err := call(request)
+		s.plugin.Unlock()
+		if err != nil {
+			reply(w, &errResponse{Err: err.Error()})
+			return
+		}
+		reply(w, response)
+	}
+}
+
+func (s *server) create(request *volumeRequest) (interface{}, error) {
+	if err := validName(request.Name); err != nil {
+		return nil, err
+	}
+	if _, err := s.plugin.volume(s.nodeID, request.Name); err == nil {
+		// The volume exists already, which Docker does not treat as an
+		// error.
+		return &errResponse{}, nil
+	}
+
+	dir := s.plugin.dir(s.nodeID, request.Name)
+	if err := os.MkdirAll(filepath.Join(dir, dataDir), 0755); err != nil {
+		return nil, err
+	}
+	if size, ok := request.Opts["size"]; ok && s.plugin.cfg.Loop {
+		if err := createImage(filepath.Join(dir, imageFile), size); err != nil {
+			if rmErr := os.RemoveAll(dir); rmErr != nil {
+				log.Printf("Could not clean up %v: %v\n", dir, rmErr)
+			}
+			return nil, err
+		}
+	}
+
+	opts, err := json.Marshal(request.Opts)
+	if err != nil {
+		return nil, err
+	}
+	// The options file is written last, since it marks the volume as
+	// created.
+	if err := ioutil.WriteFile(filepath.Join(dir, optsFile), opts, 0644); err != nil {
+		return nil, err
+	}
+	return &errResponse{}, nil
+}
+
+func (s *server) remove(request *volumeRequest) (interface{}, error) {
+	dir, err := s.plugin.volume(s.nodeID, request.Name)
+	if err != nil {
+		return nil, err
+	}
+	for nodeID, mounts := range s.plugin.mounts {
+		if len(mounts[dir]) > 0 {
+			return nil, fmt.Errorf("volume %v is in use on %v", request.Name, nodeID)
+		}
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	return &errResponse{}, nil
+}
+
+func (s *server) mount(request *volumeRequest) (interface{}, error) {
+	dir, err := s.plugin.volume(s.nodeID, request.Name)
+	if err != nil {
+		return nil, err
+	}
+	if request.ID == "" {
+		return nil, fmt.Errorf("a mount ID is required")
+	}
+
+	mounts := s.plugin.mounts[s.nodeID]
+	if mounts == nil {
+		mounts = make(map[string]map[string]bool)
+		s.plugin.mounts[s.nodeID] = mounts
+	}
+	if len(mounts[dir]) == 0 {
+		if err := mountImage(dir); err != nil {
+			return nil, err
+		}
+		mounts[dir] = make(map[string]bool)
+	}
+	mounts[dir][request.ID] = true
+	return &mountResponse{Mountpoint: filepath.Join(dir, dataDir)}, nil
+}
+
+func (s *server) unmount(request *volumeRequest) (interface{}, error) {
+	dir, err := s.plugin.volume(s.nodeID, request.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	mounts := s.plugin.mounts[s.nodeID]
+	if !mounts[dir][request.ID] {
+		return nil, fmt.Errorf(
+			"volume %v is not mounted with ID %v",
+			request.Name,
+			request.ID,
+		)
+	}
+	if len(mounts[dir]) == 1 {
+		if err := unmountImage(dir); err != nil {
+			return nil, err
+		}
+	}
+	delete(mounts[dir], request.ID)
+	return &errResponse{}, nil
+}
+
+func (s *server) path(request *volumeRequest) (interface{}, error) {
+	dir, err := s.plugin.volume(s.nodeID, request.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &mountResponse{Mountpoint: s.mountpoint(dir)}, nil
+}
+
+func (s *server) get(request *volumeRequest) (interface{}, error) {
+	dir, err := s.plugin.volume(s.nodeID, request.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &getResponse{Volume: s.describe(request.Name, dir)}, nil
+}
+
+func (s *server) list(request *volumeRequest) (interface{}, error) {
+	root := s.plugin.dir(s.nodeID, "")
+	entries, err := ioutil.ReadDir(root)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	volumes := make([]dvdi.Volume, 0, len(entries))
+	for _, entry := range entries {
+		dir, err := s.plugin.volume(s.nodeID, entry.Name())
+		if err != nil {
+			// Not a volume, for example the directory of a node.
+			continue
+		}
+		volumes = append(volumes, *s.describe(entry.Name(), dir))
+	}
+	sort.Slice(volumes, func(i, j int) bool { return volumes[i].Name < volumes[j].Name })
+	return &listResponse{Volumes: volumes}, nil
+}
+
+func (s *server) capabilities(request *volumeRequest) (interface{}, error) {
+	return struct{ Capabilities dvdi.Capabilities }{
+		dvdi.Capabilities{Scope: s.plugin.cfg.Scope},
+	}, nil
+}
+
+// mountpoint returns the mountpoint of a volume on the node, or an empty
+// string if it is not mounted there.
+func (s *server) mountpoint(dir string) string {
+	if len(s.plugin.mounts[s.nodeID][dir]) == 0 {
+		return ""
+	}
+	return filepath.Join(dir, dataDir)
+}
+
+func (s *server) describe(name, dir string) *dvdi.Volume {
+	backing := "directory"
+	if _, err := os.Stat(filepath.Join(dir, imageFile)); err == nil {
+		backing = "loop"
+	}
+	return &dvdi.Volume{
+		Name:       name,
+		Mountpoint: s.mountpoint(dir),
+		Status: map[string]interface{}{
+			"backing": backing,
+			"mounts":  len(s.plugin.mounts[s.nodeID][dir]),
+		},
+	}
+}
+
+// validName returns an error if a volume name cannot be used as the name
+// of its directory.
+func validName(name string) error {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("invalid volume name %q", name)
+	}
+	return nil
+}
+
+func reply(w http.ResponseWriter, response interface{}) {
+	w.Header().Set("Content-Type", "application/vnd.docker.plugins.v1.2+json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Could not reply to a plugin call: %v\n", err)
+	}
+}
+
+// createImage creates a sparse loop file of the given size, such as 10G,
+// with an ext4 filesystem.
+func createImage(path, size string) error {
+	bytes, err := parseSize(size)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = f.Truncate(bytes)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return run("mkfs.ext4", "-q", "-F", path)
+}
+
+// mountImage mounts the loop file of a volume on its mountpoint, if the
+// volume has one.
+func mountImage(dir string) error {
+	image := filepath.Join(dir, imageFile)
+	if _, err := os.Stat(image); os.IsNotExist(err) {
+		return nil
+	}
+	return run("mount", "-o", "loop", image, filepath.Join(dir, dataDir))
+}
+
+// unmountImage unmounts the loop file of a volume, if the volume has one.
+func unmountImage(dir string) error {
+	if _, err := os.Stat(filepath.Join(dir, imageFile)); os.IsNotExist(err) {
+		return nil
+	}
+	return run("umount", filepath.Join(dir, dataDir))
+}
+
+func run(name string, args ...string) error {
+	if out, err := exec.Command(name, args...).CombinedOutput(); err != nil {
+		return fmt.Errorf(
+			"%v %v failed: %v: %v",
+			name,
+			strings.Join(args, " "),
+			err,
+			strings.TrimSpace(string(out)),
+		)
+	}
+	return nil
+}
+
+// parseSize parses a size such as 10G into bytes.  A size without a unit is
+// in gigabytes.
+func parseSize(size string) (int64, error) {
+	units := map[string]int64{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30, "T": 1 << 40}
+	mult := int64(1 << 30)
+	s := strings.ToUpper(size)
+	if len(s) > 0 {
+		if m, ok := units[s[len(s)-1:]]; ok {
+			mult = m
+			s = s[:len(s)-1]
+		}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid volume size %v", size)
+	}
+	return n * mult, nil
+}
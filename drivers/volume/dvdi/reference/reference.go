@@ -0,0 +1,57 @@
+package reference
+
+import (
+	"github.com/portworx/torpedo/drivers/node"
+)
+
+const (
+	// PluginName is the name the reference plugin is known by.
+	PluginName = "torpedo-reference"
+	// DefaultRoot is where the reference plugin keeps its volumes.
+	DefaultRoot = "/var/lib/torpedo/reference"
+)
+
+// Config configures the reference plugin.
+type Config struct {
+	// Root is the directory the volumes are kept in.  Defaults to
+	// DefaultRoot.
+	Root string
+	// Scope is dvdi.ScopeGlobal or dvdi.ScopeLocal.  The volumes of a
+	// global plugin are shared by all nodes, the volumes of a local
+	// plugin are kept in a directory per node.  Defaults to local.
+	Scope string
+	// Loop backs volumes that are created with a size option by a loop
+	// file with an ext4 filesystem, which is mounted while the volume is
+	// in use.  This requires root privileges, mkfs.ext4 and mount.  Other
+	// volumes are plain directories.
+	Loop bool
+}
+
+// Plugin is a Docker volume plugin backed by local directories or loop
+// files.  It implements the plugin protocol the way Docker expects: a
+// volume is mounted until every ID it was mounted with has unmounted it,
+// Path is empty while the volume is not mounted, and a volume that is in use
+// cannot be removed.
+//
+// The plugin serves one endpoint per node, and the nodes share the root
+// directory.  It is the reference the DVDI conformance checks are run
+// against, and can be used with the dvdi volume driver to run the Torpedo
+// scenarios on a single host.
+type Plugin interface {
+	// Serve serves the plugin for a node on a unix or tcp endpoint.
+	Serve(n node.Node, endpoint string) error
+
+	// Stop stops serving the plugin for a node.  Volumes stay mounted.
+	Stop(n node.Node) error
+
+	// Start serves the plugin for a node again after it was stopped.
+	Start(n node.Node) error
+
+	// Close stops serving the plugin for all nodes.
+	Close()
+}
+
+// New returns a new reference plugin.
+func New(cfg Config) Plugin {
+	return newPlugin(cfg)
+}
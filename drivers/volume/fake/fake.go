@@ -0,0 +1,63 @@
+package fake
+
+import (
+	"github.com/portworx/torpedo/drivers/node"
+	"github.com/portworx/torpedo/drivers/volume"
+)
+
+// Name is the name the fake volume driver is registered under.
+const Name = "fake"
+
+// Volume is the state of a fake volume.
+type Volume struct {
+	// Name of the volume.
+	Name string
+	// AttachedOn is the ID of the node the volume is attached on, if any.
+	AttachedOn string
+	// Mounts is the number of active mounts of the volume on each node.
+	Mounts map[string]int
+}
+
+// Driver is an in-memory volume driver that models how a real provider
+// tracks volumes, attachments and mounts on each node.
+//
+// A volume is attached on at most one node at a time, and mounting it on a
+// node attaches it there.  While the driver is stopped on a node, every
+// operation on that node fails and Unmount calls are lost.  Lost Unmount
+// calls are replayed when the driver starts again, which leaves the volume
+// attached but not mounted.  A volume that is attached but not mounted, or
+// that is attached on a node whose driver is down, is force detached when
+// it is used on another node.
+type Driver interface {
+	volume.Driver
+
+	// Create creates a volume.  The name can be an inline volume
+	// specification, such as size=10G,name=foo.
+	Create(n node.Node, name string) error
+
+	// Mount attaches the volume on the node and mounts it.
+	Mount(n node.Node, name string) error
+
+	// Unmount unmounts the volume on the node.
+	Unmount(n node.Node, name string) error
+
+	// Delete detaches and deletes the volume.  It fails if the volume is
+	// mounted on a node where the driver is up.
+	Delete(n node.Node, name string) error
+
+	// Inspect returns the state of the volume.
+	Inspect(name string) (*Volume, error)
+
+	// Exists returns true if the volume exists.
+	Exists(name string) bool
+}
+
+// New returns a new fake volume driver.  It must be initialized with Init
+// before use.
+func New() Driver {
+	return newDriver()
+}
+
+func init() {
+	volume.Register(Name, New())
+}
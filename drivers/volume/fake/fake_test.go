@@ -0,0 +1,200 @@
+package fake
+
+import (
+	"testing"
+
+	"github.com/portworx/torpedo/config"
+	"github.com/portworx/torpedo/drivers/node"
+)
+
+const spec = "size=10G,repl=2,name=vol"
+
+func newTestDriver(t *testing.T) (Driver, node.Node, node.Node) {
+	d := New()
+	if err := d.Init(config.FromAddresses([]string{"192.0.2.1", "192.0.2.2"})); err != nil {
+		t.Fatal(err)
+	}
+	x := node.Node{ID: "192.0.2.1"}
+	y := node.Node{ID: "192.0.2.2"}
+	if err := d.Create(x, spec); err != nil {
+		t.Fatal(err)
+	}
+	return d, x, y
+}
+
+func inspect(t *testing.T, d Driver) *Volume {
+	vol, err := d.Inspect("vol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return vol
+}
+
+func TestCreateParsesInlineSpec(t *testing.T) {
+	d, x, _ := newTestDriver(t)
+	if !d.Exists("vol") || !d.Exists(spec) {
+		t.Fatalf("expected volume vol to exist")
+	}
+	// Creating an existing volume succeeds.
+	if err := d.Create(x, "vol"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLostUnmountIsReplayed(t *testing.T) {
+	d, x, _ := newTestDriver(t)
+	if err := d.Mount(x, spec); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.StopDriver(x); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Unmount(x, spec); err == nil {
+		t.Fatalf("expected Unmount to fail while the driver is down")
+	}
+	if vol := inspect(t, d); vol.Mounts[x.ID] != 1 {
+		t.Fatalf("expected the lost Unmount to leave the volume mounted, got %v mounts", vol.Mounts[x.ID])
+	}
+
+	if err := d.StartDriver(x); err != nil {
+		t.Fatal(err)
+	}
+	vol := inspect(t, d)
+	if vol.Mounts[x.ID] != 0 {
+		t.Errorf("expected the lost Unmount to be replayed, got %v mounts", vol.Mounts[x.ID])
+	}
+	if vol.AttachedOn != x.ID {
+		t.Errorf("expected the volume to stay attached on %v, it is attached on %q", x.ID, vol.AttachedOn)
+	}
+}
+
+func TestMountedVolumeIsNotForceDetached(t *testing.T) {
+	d, x, y := newTestDriver(t)
+	if err := d.Mount(x, spec); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Mount(y, spec); err == nil {
+		t.Fatalf("expected Mount on %v to fail while the volume is mounted on %v", y.ID, x.ID)
+	}
+	if vol := inspect(t, d); vol.AttachedOn != x.ID {
+		t.Errorf("expected the volume to stay attached on %v, it is attached on %q", x.ID, vol.AttachedOn)
+	}
+}
+
+func TestUnmountedVolumeIsForceDetached(t *testing.T) {
+	d, x, y := newTestDriver(t)
+	if err := d.Mount(x, spec); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Unmount(x, spec); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Mount(y, spec); err != nil {
+		t.Fatal(err)
+	}
+	vol := inspect(t, d)
+	if vol.AttachedOn != y.ID || vol.Mounts[y.ID] != 1 || vol.Mounts[x.ID] != 0 {
+		t.Errorf("expected the volume to be mounted on %v only, got %+v", y.ID, vol)
+	}
+}
+
+func TestVolumeOnDownNodeIsForceDetached(t *testing.T) {
+	d, x, y := newTestDriver(t)
+	if err := d.Mount(x, spec); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.StopDriver(x); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Mount(y, spec); err != nil {
+		t.Fatal(err)
+	}
+	if vol := inspect(t, d); vol.AttachedOn != y.ID {
+		t.Fatalf("expected the volume to be attached on %v, it is attached on %q", y.ID, vol.AttachedOn)
+	}
+
+	// The stale mount is gone, so the lost Unmount has nothing to replay
+	// and the new mount is left alone.
+	if err := d.Unmount(x, spec); err == nil {
+		t.Fatalf("expected Unmount to fail while the driver is down")
+	}
+	if err := d.StartDriver(x); err != nil {
+		t.Fatal(err)
+	}
+	if vol := inspect(t, d); vol.Mounts[y.ID] != 1 {
+		t.Errorf("expected the volume to stay mounted on %v, got %v mounts", y.ID, vol.Mounts[y.ID])
+	}
+	if err := d.Unmount(x, spec); err == nil {
+		t.Errorf("expected Unmount on %v to fail after the force detach", x.ID)
+	}
+}
+
+func TestCleanupVolumeWhileDriverDown(t *testing.T) {
+	d, x, _ := newTestDriver(t)
+	if err := d.Mount(x, spec); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.StopDriver(x); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.CleanupVolume(spec); err == nil {
+		t.Fatalf("expected CleanupVolume to fail while the driver is down where the volume is attached")
+	}
+	if !d.Exists("vol") {
+		t.Fatalf("expected the volume to survive the failed cleanup")
+	}
+
+	if err := d.StartDriver(x); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.CleanupVolume(spec); err != nil {
+		t.Fatal(err)
+	}
+	if d.Exists("vol") {
+		t.Errorf("expected the volume to be deleted")
+	}
+	// Cleaning up a volume that does not exist succeeds.
+	if err := d.CleanupVolume(spec); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCleanupVolumeWhileOtherDriverDown(t *testing.T) {
+	d, x, y := newTestDriver(t)
+	if err := d.Mount(x, spec); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.StopDriver(y); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.CleanupVolume(spec); err != nil {
+		t.Fatal(err)
+	}
+	if d.Exists("vol") {
+		t.Errorf("expected the volume to be deleted")
+	}
+}
+
+func TestDeleteMountedVolume(t *testing.T) {
+	d, x, y := newTestDriver(t)
+	if err := d.Mount(x, spec); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Delete(y, spec); err == nil {
+		t.Fatalf("expected Delete to fail while the volume is mounted on %v", x.ID)
+	}
+
+	if err := d.StopDriver(x); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Delete(y, spec); err != nil {
+		t.Fatal(err)
+	}
+	if d.Exists("vol") {
+		t.Errorf("expected the volume to be deleted")
+	}
+}
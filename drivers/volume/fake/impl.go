@@ -0,0 +1,258 @@
+package fake
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/portworx/torpedo/config"
+	"github.com/portworx/torpedo/drivers/node"
+	"github.com/portworx/torpedo/drivers/volume"
+)
+
+type driver struct {
+	sync.Mutex
+	nodes   map[string]node.Node
+	down    map[string]bool
+	volumes map[string]*Volume
+	// lost holds the Unmount calls per node that were lost while the
+	// driver was down on that node.
+	lost map[string][]string
+}
+
+func newDriver() *driver {
+	return &driver{
+		nodes:   make(map[string]node.Node),
+		down:    make(map[string]bool),
+		volumes: make(map[string]*Volume),
+		lost:    make(map[string][]string),
+	}
+}
+
+func (d *driver) String() string {
+	return Name
+}
+
+func (d *driver) Init(cfg *config.Config) error {
+	nodes, err := node.FromConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	d.Lock()
+	defer d.Unlock()
+	for _, n := range nodes {
+		d.nodes[n.ID] = n
+	}
+	return nil
+}
+
+func (d *driver) Version() (string, error) {
+	return Name, nil
+}
+
+func (d *driver) CleanupVolume(name string) error {
+	d.Lock()
+	defer d.Unlock()
+
+	vol, ok := d.volumes[volume.ParseName(name)]
+	if !ok {
+		return nil
+	}
+	if vol.AttachedOn != "" && d.down[vol.AttachedOn] {
+		return fmt.Errorf(
+			"cannot detach %v, the driver is down on %v",
+			vol.Name,
+			vol.AttachedOn,
+		)
+	}
+	delete(d.volumes, vol.Name)
+	return nil
+}
+
+func (d *driver) StopDriver(n node.Node) error {
+	d.Lock()
+	defer d.Unlock()
+	if err := d.checkNode(n); err != nil {
+		return err
+	}
+	if d.down[n.ID] {
+		return fmt.Errorf("the %v driver is not running on %v", Name, n.ID)
+	}
+	d.down[n.ID] = true
+	return nil
+}
+
+func (d *driver) StartDriver(n node.Node) error {
+	d.Lock()
+	defer d.Unlock()
+	if err := d.checkNode(n); err != nil {
+		return err
+	}
+	if !d.down[n.ID] {
+		return fmt.Errorf("the %v driver is not stopped on %v", Name, n.ID)
+	}
+	delete(d.down, n.ID)
+
+	// Replay the Unmount calls that were lost while the driver was down.
+	for _, name := range d.lost[n.ID] {
+		if vol, ok := d.volumes[name]; ok && vol.Mounts[n.ID] > 0 {
+			log.Printf("Replaying lost unmount of %v on %v\n", name, n.ID)
+			vol.Mounts[n.ID]--
+		}
+	}
+	delete(d.lost, n.ID)
+	return nil
+}
+
+func (d *driver) WaitStart(n node.Node) error {
+	d.Lock()
+	defer d.Unlock()
+	if err := d.checkUp(n); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (d *driver) Create(n node.Node, name string) error {
+	d.Lock()
+	defer d.Unlock()
+	if err := d.checkUp(n); err != nil {
+		return err
+	}
+
+	name = volume.ParseName(name)
+	if _, ok := d.volumes[name]; !ok {
+		d.volumes[name] = &Volume{
+			Name:   name,
+			Mounts: make(map[string]int),
+		}
+	}
+	return nil
+}
+
+func (d *driver) Mount(n node.Node, name string) error {
+	d.Lock()
+	defer d.Unlock()
+	if err := d.checkUp(n); err != nil {
+		return err
+	}
+
+	vol, err := d.getVolume(name)
+	if err != nil {
+		return err
+	}
+
+	if vol.AttachedOn != "" && vol.AttachedOn != n.ID {
+		if vol.Mounts[vol.AttachedOn] > 0 && !d.down[vol.AttachedOn] {
+			return fmt.Errorf(
+				"volume %v is mounted on %v",
+				vol.Name,
+				vol.AttachedOn,
+			)
+		}
+		log.Printf("Force detaching %v from %v\n", vol.Name, vol.AttachedOn)
+		vol.Mounts = make(map[string]int)
+	}
+
+	vol.AttachedOn = n.ID
+	vol.Mounts[n.ID]++
+	return nil
+}
+
+func (d *driver) Unmount(n node.Node, name string) error {
+	d.Lock()
+	defer d.Unlock()
+	if err := d.checkNode(n); err != nil {
+		return err
+	}
+
+	vol, err := d.getVolume(name)
+	if err != nil {
+		return err
+	}
+
+	if d.down[n.ID] {
+		d.lost[n.ID] = append(d.lost[n.ID], vol.Name)
+		return fmt.Errorf("the %v driver is down on %v", Name, n.ID)
+	}
+	if vol.Mounts[n.ID] == 0 {
+		return fmt.Errorf("volume %v is not mounted on %v", vol.Name, n.ID)
+	}
+
+	vol.Mounts[n.ID]--
+	return nil
+}
+
+func (d *driver) Delete(n node.Node, name string) error {
+	d.Lock()
+	defer d.Unlock()
+	if err := d.checkUp(n); err != nil {
+		return err
+	}
+
+	vol, err := d.getVolume(name)
+	if err != nil {
+		return err
+	}
+
+	for id, mounts := range vol.Mounts {
+		if mounts > 0 && !d.down[id] {
+			return fmt.Errorf("volume %v is mounted on %v", vol.Name, id)
+		}
+	}
+	delete(d.volumes, vol.Name)
+	return nil
+}
+
+func (d *driver) Inspect(name string) (*Volume, error) {
+	d.Lock()
+	defer d.Unlock()
+
+	vol, err := d.getVolume(name)
+	if err != nil {
+		return nil, err
+	}
+
+	v := *vol
+	v.Mounts = make(map[string]int)
+	for id, mounts := range vol.Mounts {
+		v.Mounts[id] = mounts
+	}
+	return &v, nil
+}
+
+func (d *driver) Exists(name string) bool {
+	d.Lock()
+	defer d.Unlock()
+	_, ok := d.volumes[volume.ParseName(name)]
+	return ok
+}
+
+func (d *driver) getVolume(name string) (*Volume, error) {
+	vol, ok := d.volumes[volume.ParseName(name)]
+	if !ok {
+		return nil, fmt.Errorf("no such volume %v", name)
+	}
+	return vol, nil
+}
+
+// checkNode returns an error if the node is not in the cluster.
+func (d *driver) checkNode(n node.Node) error {
+	if _, ok := d.nodes[n.ID]; !ok {
+		return fmt.Errorf("no such node %v", n.ID)
+	}
+	return nil
+}
+
+// checkUp returns an error if the node is not in the cluster or the driver
+// is down on it.
+func (d *driver) checkUp(n node.Node) error {
+	if err := d.checkNode(n); err != nil {
+		return err
+	}
+	if d.down[n.ID] {
+		return fmt.Errorf("the %v driver is down on %v", Name, n.ID)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package osd
+
+import (
+	"fmt"
+
+	"github.com/portworx/torpedo/config"
+	"github.com/portworx/torpedo/drivers/node"
+)
+
+// containerControl controls a backend that runs in a Docker container.
+type containerControl struct {
+	config    *config.Config
+	container string
+}
+
+// systemdControl controls a backend that runs as a systemd unit.
+type systemdControl struct {
+	config *config.Config
+	unit   string
+}
+
+// noControl is used when neither a control nor the container or unit volume
+// option is given.  The backend cannot be stopped and started.
+type noControl struct {
+	driver string
+}
+
+func (c *containerControl) Stop(n node.Node) error {
+	cfgNode := c.config.Lookup(n.MgmtIP)
+	docker, err := cfgNode.DockerClient()
+	if err != nil {
+		return err
+	}
+	return docker.StopContainer(c.container, 10)
+}
+
+func (c *containerControl) Start(n node.Node) error {
+	cfgNode := c.config.Lookup(n.MgmtIP)
+	docker, err := cfgNode.DockerClient()
+	if err != nil {
+		return err
+	}
+	return docker.StartContainer(c.container, nil)
+}
+
+func (c *systemdControl) Stop(n node.Node) error {
+	return node.NewExecutor(c.config, n).StopService(c.unit)
+}
+
+func (c *systemdControl) Start(n node.Node) error {
+	return node.NewExecutor(c.config, n).StartService(c.unit)
+}
+
+func (c *noControl) Stop(n node.Node) error {
+	return c.err()
+}
+
+func (c *noControl) Start(n node.Node) error {
+	return c.err()
+}
+
+func (c *noControl) err() error {
+	return fmt.Errorf(
+		"do not know how to stop and start openstorage driver %v, set the container or unit volume option",
+		c.driver,
+	)
+}
@@ -0,0 +1,517 @@
+package osd
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libopenstorage/openstorage/api"
+	clusterclient "github.com/libopenstorage/openstorage/api/client/cluster"
+	volumeclient "github.com/libopenstorage/openstorage/api/client/volume"
+	"github.com/libopenstorage/openstorage/volume"
+
+	"github.com/portworx/torpedo/config"
+	"github.com/portworx/torpedo/drivers/node"
+	torpedovolume "github.com/portworx/torpedo/drivers/volume"
+)
+
+const (
+	// defaultSize is the size of a volume that does not specify one.
+	defaultSize = 1 << 30
+	// defaultVersion is the openstorage API version used by default.
+	defaultVersion = "v1"
+	// startTimeout is how long to wait for the backend to become usable.
+	startTimeout = 2 * time.Minute
+)
+
+type driver struct {
+	sync.Mutex
+	osdDriver string
+	version   string
+	endpoint  string
+	mountDir  string
+	control   Control
+	nodes     []node.Node
+	clients   map[string]volume.VolumeDriver
+}
+
+func newDriver(control Control) *driver {
+	return &driver{
+		control: control,
+		clients: make(map[string]volume.VolumeDriver),
+	}
+}
+
+// String returns the openstorage driver name of the backend, which is the
+// volume driver name Docker knows it by.
+func (d *driver) String() string {
+	if d.osdDriver == "" {
+		return Name
+	}
+	return d.osdDriver
+}
+
+func (d *driver) Init(cfg *config.Config) error {
+	nodes, err := node.FromConfig(cfg)
+	if err != nil {
+		return err
+	}
+	if len(nodes) == 0 {
+		return fmt.Errorf("there are no nodes in the cluster")
+	}
+
+	opts := cfg.Volume.Options
+	osdDriver := opts["driver"]
+	if osdDriver == "" {
+		return fmt.Errorf("the driver volume option is not set")
+	}
+
+	d.Lock()
+	defer d.Unlock()
+	d.osdDriver = osdDriver
+	d.version = option(opts, "version", defaultVersion)
+	d.mountDir = option(opts, "mountDir", DefaultMountDir)
+	d.endpoint = cfg.Volume.Endpoint
+	if d.endpoint == "" {
+		d.endpoint = "http://{address}:" + strconv.Itoa(cfg.Volume.Port)
+	}
+	d.nodes = nodes
+	if d.control == nil {
+		switch {
+		case opts["container"] != "":
+			d.control = &containerControl{config: cfg, container: opts["container"]}
+		case opts["unit"] != "":
+			d.control = &systemdControl{config: cfg, unit: opts["unit"]}
+		default:
+			d.control = &noControl{driver: osdDriver}
+		}
+	}
+
+	first := d.firstNode()
+	c, err := d.client(first)
+	if err != nil {
+		return err
+	}
+	if _, err := c.Enumerate(&api.VolumeLocator{}, nil); err != nil {
+		return fmt.Errorf(
+			"cannot reach openstorage driver %v on %v: %v",
+			osdDriver,
+			first.MgmtIP,
+			err,
+		)
+	}
+
+	log.Printf("Using the openstorage driver %v.\n", osdDriver)
+	d.logCluster(first)
+	return nil
+}
+
+// Version returns the openstorage driver name and the API versions the
+// backend supports.
+func (d *driver) Version() (string, error) {
+	versions, err := volumeclient.GetSupportedDriverVersions(
+		d.osdDriver,
+		d.nodeEndpoint(d.firstNode()),
+	)
+	if err != nil {
+		return "", err
+	}
+	if len(versions) == 0 {
+		return d.osdDriver, nil
+	}
+	return fmt.Sprintf("%v (API %v)", d.osdDriver, strings.Join(versions, ", ")), nil
+}
+
+// CleanupVolume unmounts the volume at all its mount paths, detaches it and
+// deletes it.
+func (d *driver) CleanupVolume(name string) error {
+	d.Lock()
+	defer d.Unlock()
+
+	c, err := d.client(d.firstNode())
+	if err != nil {
+		return err
+	}
+	name = torpedovolume.ParseName(name)
+	v, err := find(c, name)
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		return nil
+	}
+
+	for _, path := range v.AttachPath {
+		if err := c.Unmount(v.Id, path); err != nil {
+			return fmt.Errorf(
+				"error while unmounting %v at %v because of: %v",
+				name,
+				path,
+				err,
+			)
+		}
+	}
+	if v.AttachedOn != "" {
+		if err := c.Detach(v.Id); err != nil {
+			return fmt.Errorf("error while detaching %v because of: %v", name, err)
+		}
+	}
+	if err := c.Delete(v.Id); err != nil {
+		return fmt.Errorf("error while deleting %v because of: %v", name, err)
+	}
+	log.Printf("Successfully removed openstorage volume %v\n", name)
+	return nil
+}
+
+func (d *driver) StopDriver(n node.Node) error {
+	return d.control.Stop(n)
+}
+
+func (d *driver) StartDriver(n node.Node) error {
+	return d.control.Start(n)
+}
+
+// WaitStart waits for the backend on the node to enumerate its volumes.
+func (d *driver) WaitStart(n node.Node) error {
+	d.Lock()
+	defer d.Unlock()
+
+	c, err := d.client(n)
+	if err != nil {
+		return err
+	}
+	for start := time.Now(); time.Since(start) < startTimeout; time.Sleep(time.Second) {
+		if _, err = c.Enumerate(&api.VolumeLocator{}, nil); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf(
+		"openstorage driver %v did not start on %v: %v",
+		d.osdDriver,
+		n.MgmtIP,
+		err,
+	)
+}
+
+func (d *driver) Create(n node.Node, name string) error {
+	d.Lock()
+	defer d.Unlock()
+
+	c, err := d.client(n)
+	if err != nil {
+		return err
+	}
+	locator, spec, err := parseSpec(name)
+	if err != nil {
+		return err
+	}
+	if v, err := find(c, locator.Name); err != nil {
+		return err
+	} else if v != nil {
+		return nil
+	}
+	id, err := c.Create(locator, &api.Source{}, spec)
+	if err != nil {
+		return err
+	}
+
+	v, err := inspect(c, id)
+	if err != nil {
+		return err
+	}
+	if v.Locator == nil || v.Locator.Name != locator.Name {
+		return fmt.Errorf("volume %v was not created with name %v", id, locator.Name)
+	}
+	if v.Spec == nil || v.Spec.Size != spec.Size {
+		return fmt.Errorf("volume %v was not created with size %v", locator.Name, spec.Size)
+	}
+	if spec.HaLevel != 0 && v.Spec.HaLevel != spec.HaLevel {
+		return fmt.Errorf(
+			"volume %v has replication level %v instead of %v",
+			locator.Name,
+			v.Spec.HaLevel,
+			spec.HaLevel,
+		)
+	}
+	log.Printf("Created volume %v with ID %v on %v\n", locator.Name, id, n.MgmtIP)
+	return nil
+}
+
+func (d *driver) Mount(n node.Node, name string) error {
+	d.Lock()
+	defer d.Unlock()
+
+	c, err := d.client(n)
+	if err != nil {
+		return err
+	}
+	name = torpedovolume.ParseName(name)
+	v, err := get(c, name)
+	if err != nil {
+		return err
+	}
+	if _, err := c.Attach(v.Id, nil); err != nil {
+		return err
+	}
+	path := filepath.Join(d.mountDir, name)
+	if err := c.Mount(v.Id, path); err != nil {
+		return err
+	}
+
+	if v, err = inspect(c, v.Id); err != nil {
+		return err
+	}
+	for _, attachPath := range v.AttachPath {
+		if attachPath == path {
+			log.Printf("Mounted volume %v on %v at %v\n", name, n.MgmtIP, path)
+			return nil
+		}
+	}
+	return fmt.Errorf("volume %v is not reported as mounted at %v", name, path)
+}
+
+func (d *driver) Unmount(n node.Node, name string) error {
+	d.Lock()
+	defer d.Unlock()
+
+	c, err := d.client(n)
+	if err != nil {
+		return err
+	}
+	name = torpedovolume.ParseName(name)
+	v, err := get(c, name)
+	if err != nil {
+		return err
+	}
+	if err := c.Unmount(v.Id, filepath.Join(d.mountDir, name)); err != nil {
+		return err
+	}
+	return c.Detach(v.Id)
+}
+
+func (d *driver) Delete(n node.Node, name string) error {
+	d.Lock()
+	defer d.Unlock()
+
+	c, err := d.client(n)
+	if err != nil {
+		return err
+	}
+	v, err := get(c, torpedovolume.ParseName(name))
+	if err != nil {
+		return err
+	}
+	return c.Delete(v.Id)
+}
+
+func (d *driver) Inspect(name string) (*api.Volume, error) {
+	d.Lock()
+	defer d.Unlock()
+
+	c, err := d.client(d.firstNode())
+	if err != nil {
+		return nil, err
+	}
+	return get(c, torpedovolume.ParseName(name))
+}
+
+func (d *driver) Exists(name string) bool {
+	d.Lock()
+	defer d.Unlock()
+
+	c, err := d.client(d.firstNode())
+	if err != nil {
+		return true
+	}
+	v, err := find(c, torpedovolume.ParseName(name))
+	return err != nil || v != nil
+}
+
+func (d *driver) Enumerate() ([]*api.Volume, error) {
+	d.Lock()
+	defer d.Unlock()
+
+	c, err := d.client(d.firstNode())
+	if err != nil {
+		return nil, err
+	}
+	return c.Enumerate(&api.VolumeLocator{}, nil)
+}
+
+// logCluster logs the nodes of the openstorage cluster.  Not every backend
+// runs a cluster, so errors are only logged.
+func (d *driver) logCluster(n node.Node) {
+	clnt, err := clusterclient.NewClusterClient(d.nodeEndpoint(n), "v1")
+	if err != nil {
+		log.Printf("Cannot reach the openstorage cluster on %v: %v\n", n.MgmtIP, err)
+		return
+	}
+	cluster, err := clusterclient.ClusterManager(clnt).Enumerate()
+	if err != nil {
+		log.Printf("Cannot enumerate the openstorage cluster on %v: %v\n", n.MgmtIP, err)
+		return
+	}
+
+	log.Printf("The following openstorage nodes are in the cluster:\n")
+	for _, n := range cluster.Nodes {
+		log.Printf(
+			"\tNode ID: %v\tNode IP: %v\tNode Status: %v\n",
+			n.Id,
+			n.DataIp,
+			n.Status,
+		)
+	}
+}
+
+// firstNode returns the node Torpedo runs on if it is in the cluster, and
+// the first node otherwise.
+func (d *driver) firstNode() node.Node {
+	for _, n := range d.nodes {
+		if n.Local {
+			return n
+		}
+	}
+	return d.nodes[0]
+}
+
+// nodeEndpoint returns the endpoint of the backend on a node.
+func (d *driver) nodeEndpoint(n node.Node) string {
+	endpoint := strings.Replace(d.endpoint, "{address}", n.MgmtIP, -1)
+	return strings.Replace(endpoint, "{id}", n.ID, -1)
+}
+
+// client returns a client for the backend on a node.
+func (d *driver) client(n node.Node) (volume.VolumeDriver, error) {
+	if c, ok := d.clients[n.ID]; ok {
+		return c, nil
+	}
+
+	endpoint := d.nodeEndpoint(n)
+	if strings.HasPrefix(endpoint, "unix://") && !n.Local {
+		return nil, fmt.Errorf(
+			"the socket %v of openstorage driver %v on %v can only be reached on the node Torpedo runs on, configure an http endpoint instead",
+			endpoint,
+			d.osdDriver,
+			n.MgmtIP,
+		)
+	}
+	clnt, err := volumeclient.NewDriverClient(endpoint, d.osdDriver, d.version)
+	if err != nil {
+		return nil, err
+	}
+	c := volumeclient.VolumeDriver(clnt)
+	d.clients[n.ID] = c
+	return c, nil
+}
+
+// find returns a volume by name, or nil if there is none.
+func find(c volume.VolumeDriver, name string) (*api.Volume, error) {
+	volumes, err := c.Enumerate(&api.VolumeLocator{Name: name}, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range volumes {
+		if v.Locator != nil && v.Locator.Name == name {
+			return v, nil
+		}
+	}
+	return nil, nil
+}
+
+// get returns a volume by name.
+func get(c volume.VolumeDriver, name string) (*api.Volume, error) {
+	v, err := find(c, name)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, fmt.Errorf("volume %v does not exist", name)
+	}
+	return v, nil
+}
+
+// inspect returns a volume by ID.
+func inspect(c volume.VolumeDriver, id string) (*api.Volume, error) {
+	volumes, err := c.Inspect([]string{id})
+	if err != nil {
+		return nil, err
+	}
+	if len(volumes) != 1 {
+		return nil, fmt.Errorf("cannot inspect volume %v", id)
+	}
+	return volumes[0], nil
+}
+
+// parseSpec returns the locator and the volume specification of an inline
+// volume specification.  The size and repl options are the size and the
+// replication level of the volume, the other options are volume labels.
+func parseSpec(spec string) (*api.VolumeLocator, *api.VolumeSpec, error) {
+	locator := &api.VolumeLocator{
+		Name:         torpedovolume.ParseName(spec),
+		VolumeLabels: make(map[string]string),
+	}
+	volumeSpec := &api.VolumeSpec{
+		Size:         defaultSize,
+		Format:       api.FSType_FS_TYPE_EXT4,
+		VolumeLabels: make(map[string]string),
+	}
+	if !strings.Contains(spec, "=") {
+		return locator, volumeSpec, nil
+	}
+
+	for _, opt := range strings.Split(spec, ",") {
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "name":
+		case "size":
+			size, err := parseSize(kv[1])
+			if err != nil {
+				return nil, nil, err
+			}
+			volumeSpec.Size = size
+		case "repl":
+			repl, err := strconv.ParseInt(kv[1], 10, 64)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid replication level %v", kv[1])
+			}
+			volumeSpec.HaLevel = repl
+		default:
+			volumeSpec.VolumeLabels[kv[0]] = kv[1]
+		}
+	}
+	return locator, volumeSpec, nil
+}
+
+// parseSize parses a size such as 10G into bytes.  A size without a unit is
+// in gigabytes.
+func parseSize(size string) (uint64, error) {
+	units := map[string]uint64{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30, "T": 1 << 40}
+	mult := uint64(1 << 30)
+	s := strings.ToUpper(size)
+	if len(s) > 0 {
+		if m, ok := units[s[len(s)-1:]]; ok {
+			mult = m
+			s = s[:len(s)-1]
+		}
+	}
+
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid volume size %v", size)
+	}
+	return n * mult, nil
+}
+
+func option(opts map[string]string, key, def string) string {
+	if v, ok := opts[key]; ok && v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,82 @@
+package osd
+
+import (
+	"github.com/libopenstorage/openstorage/api"
+
+	"github.com/portworx/torpedo/drivers/node"
+	"github.com/portworx/torpedo/drivers/volume"
+)
+
+const (
+	// Name is the name the openstorage volume driver is registered under.
+	Name = "osd"
+	// DefaultMountDir is where volumes are mounted on a node.
+	DefaultMountDir = "/var/lib/torpedo/osd"
+)
+
+// Control stops and starts the openstorage backend on a node.
+type Control interface {
+	// Stop makes the backend exit or get killed on a node.
+	Stop(n node.Node) error
+	// Start starts the backend on a node.
+	Start(n node.Node) error
+}
+
+// Driver is a volume driver for any openstorage backend, such as pxd, nfs,
+// btrfs or aws.  It talks to the openstorage REST API of the backend on
+// each node.
+//
+// The driver is configured with the volume options:
+//
+//	driver     openstorage driver name of the backend, required
+//	version    openstorage API version, defaults to v1
+//	container  container the backend runs in
+//	unit       systemd unit the backend runs as
+//	mountDir   where volumes are mounted, defaults to DefaultMountDir
+//
+// The volume endpoint is the openstorage REST endpoint, such as
+// http://{address}:9001 or unix:///var/lib/osd/driver/nfs.sock.  {address}
+// and {id} are replaced with the address and ID of each node.  It defaults
+// to the volume port on each node.
+//
+// The driver is only registered as osd.  It reports the openstorage driver
+// name, so that tasks ask Docker for the backend itself.
+type Driver interface {
+	volume.Driver
+
+	// Create creates a volume.  The name can be an inline volume
+	// specification, such as size=10G,repl=2,name=foo.  The volume is
+	// inspected to verify that the backend honored the specification.
+	// Creating a volume that already exists succeeds.
+	Create(n node.Node, name string) error
+
+	// Mount attaches a volume on a node and mounts it.
+	Mount(n node.Node, name string) error
+
+	// Unmount unmounts a volume on a node and detaches it.
+	Unmount(n node.Node, name string) error
+
+	// Delete deletes a volume.
+	Delete(n node.Node, name string) error
+
+	// Inspect returns a volume by name.
+	Inspect(name string) (*api.Volume, error)
+
+	// Enumerate returns all volumes of the backend.
+	Enumerate() ([]*api.Volume, error)
+
+	// Exists returns true if the backend has the volume.  A volume is
+	// assumed to exist if the backend cannot be reached.
+	Exists(name string) bool
+}
+
+// New returns an openstorage volume driver that stops and starts the backend
+// with the given control.  If control is nil, the backend is stopped and
+// started through the container or unit volume option.
+func New(control Control) Driver {
+	return newDriver(control)
+}
+
+func init() {
+	volume.Register(Name, New(nil))
+}
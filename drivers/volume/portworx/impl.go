@@ -3,8 +3,10 @@ package portworx
 import (
 	"fmt"
 	"log"
-	"os"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	dockerclient "github.com/fsouza/go-dockerclient"
@@ -14,37 +16,79 @@ import (
 	volumeclient "github.com/libopenstorage/openstorage/api/client/volume"
 	"github.com/libopenstorage/openstorage/cluster"
 	"github.com/libopenstorage/openstorage/volume"
+
+	"github.com/portworx/torpedo/config"
+	"github.com/portworx/torpedo/drivers/node"
 )
 
-var (
-	docker *dockerclient.Client
+const (
+	// startTimeout is how long to wait for Portworx to become usable on a
+	// node.
+	startTimeout = 2 * time.Minute
 )
 
 type portworx struct {
-	hostConfig     *dockerclient.HostConfig
+	sync.Mutex
+	config         *config.Config
+	nodes          []node.Node
 	clusterManager cluster.Cluster
 	volDriver      volume.VolumeDriver
+	containerName  *regexp.Regexp
+	containerLabel string
+	unit           string
+	// hostConfigs holds the host configuration of the stopped Portworx
+	// containers by node ID.
+	hostConfigs map[string]*dockerclient.HostConfig
+	// clusterManagers holds a cluster client for each node by node ID.
+	clusterManagers map[string]cluster.Cluster
 }
 
 func (d *portworx) String() string {
-	return "pxd"
+	return Name
 }
 
-func (d *portworx) Init() error {
-	log.Printf("Using the Portworx volume portworx.\n")
+func (d *portworx) Init(cfg *config.Config) error {
+	log.Printf("Using the Portworx volume driver.\n")
+
+	nodes, err := node.FromConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	opts := cfg.Volume.Options
+	pattern := opts["containerName"]
+	if pattern == "" && opts["containerLabel"] == "" {
+		pattern = DefaultContainerName
+	}
+	var containerName *regexp.Regexp
+	if pattern != "" {
+		if containerName, err = regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid containerName volume option %v: %v", pattern, err)
+		}
+	}
 
-	n := "127.0.0.1"
-	if len(nodes) > 0 {
-		n = nodes[0]
+	d.Lock()
+	defer d.Unlock()
+	d.config = cfg
+	d.nodes = nodes
+	d.containerName = containerName
+	d.containerLabel = opts["containerLabel"]
+	d.unit = opts["unit"]
+	if d.unit == "" {
+		d.unit = DefaultUnit
 	}
+	d.hostConfigs = make(map[string]*dockerclient.HostConfig)
+	d.clusterManagers = make(map[string]cluster.Cluster)
 
-	clnt, err := clusterclient.NewClusterClient("http://"+n+":9001", "v1")
+	endpoint := d.endpoint(d.firstNode())
+
+	clnt, err := clusterclient.NewClusterClient(endpoint, "v1")
 	if err != nil {
 		return err
 	}
 	d.clusterManager = clusterclient.ClusterManager(clnt)
 
-	clnt, err = volumeclient.NewDriverClient("http://"+n+":9001", "pxd", "")
+	clnt, err = volumeclient.NewDriverClient(endpoint, Name, "")
 	if err != nil {
 		return err
 	}
@@ -68,6 +112,30 @@ func (d *portworx) Init() error {
 	return nil
 }
 
+// Version returns the image of the Portworx container, which carries the
+// Portworx release as its tag, or the version pxctl reports for a systemd
+// install.
+func (d *portworx) Version() (string, error) {
+	if len(d.nodes) == 0 {
+		return "", fmt.Errorf("there are no nodes in the cluster")
+	}
+	// The first node is the one firstNode returns.
+	first := d.nodes[0]
+
+	install, info, err := d.detect(first)
+	if err != nil {
+		return "", err
+	}
+	if install == systemdInstall {
+		version, err := node.NewExecutor(d.config, first).RunCommand(pxctl + " --version")
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(version), nil
+	}
+	return info.Config.Image, nil
+}
+
 func (d *portworx) CleanupVolume(name string) error {
 	locator := &api.VolumeLocator{}
 
@@ -112,7 +180,7 @@ func (d *portworx) CleanupVolume(name string) error {
 				return err
 			}
 
-			log.Printf("Succesfully removed Portworx volume %v\n", name)
+			log.Printf("Successfully removed Portworx volume %v\n", name)
 
 			return nil
 		}
@@ -121,86 +189,195 @@ func (d *portworx) CleanupVolume(name string) error {
 	return nil
 }
 
-// Portworx runs as a container - so all we need to do is ask docker to
-// stop the running portworx container.
-func (d *portworx) Stop(ip string) error {
-	endpoint := "tcp://" + ip + ":2375"
-	docker, err := dockerclient.NewClient(endpoint)
+// StopDriver stops the Portworx container, or the Portworx systemd unit if
+// the node has no Portworx container.
+func (d *portworx) StopDriver(n node.Node) error {
+	install, info, err := d.detect(n)
 	if err != nil {
 		return err
 	}
 
-	if err = docker.Ping(); err != nil {
+	if install == systemdInstall {
+		log.Printf("Stopping Portworx systemd unit %v on %v\n", d.unit, n.MgmtIP)
+		return node.NewExecutor(d.config, n).StopService(d.unit)
+	}
+
+	if !info.State.Running {
+		return fmt.Errorf(
+			"portworx container with ID %v is not running on %v",
+			info.ID,
+			n.MgmtIP,
+		)
+	}
+
+	d.Lock()
+	d.hostConfigs[n.ID] = info.HostConfig
+	d.Unlock()
+
+	cfgNode := d.config.Lookup(n.MgmtIP)
+	docker, err := cfgNode.DockerClient()
+	if err != nil {
 		return err
 	}
+	log.Printf("Stopping Portworx container with ID %v on %v\n", info.ID, n.MgmtIP)
+	return docker.StopContainer(info.ID, 0)
+}
 
-	// Find and stop the Portworx container
-	lo := dockerclient.ListContainersOptions{
-		All:  true,
-		Size: false,
+// WaitStart waits for Portworx on the node to report itself as up.  The
+// status is asked from the cluster through another node when possible,
+// since the REST API of the node itself may not be up yet.
+func (d *portworx) WaitStart(n node.Node) error {
+	var status api.Status
+	var err error
+	for start := time.Now(); time.Since(start) < startTimeout; time.Sleep(time.Second) {
+		if status, err = d.nodeStatus(n); err == nil && status == api.Status_STATUS_OK {
+			return nil
+		}
 	}
 
-	allContainers, err := docker.ListContainers(lo)
+	if err != nil {
+		return fmt.Errorf(
+			"Portworx did not start up on %v in time: %v",
+			n.MgmtIP,
+			err,
+		)
+	}
+	return fmt.Errorf(
+		"Portworx did not start up on %v in time: Status is %v",
+		n.MgmtIP,
+		status,
+	)
+}
+
+// StartDriver starts the Portworx container, or the Portworx systemd unit if
+// the node has no Portworx container, and waits for Portworx to come up.
+func (d *portworx) StartDriver(n node.Node) error {
+	install, info, err := d.detect(n)
 	if err != nil {
 		return err
 	}
 
-	for _, c := range allContainers {
-		info, err := docker.InspectContainer(c.ID)
-		if err != nil {
+	if install == systemdInstall {
+		log.Printf("Starting Portworx systemd unit %v on %v\n", d.unit, n.MgmtIP)
+		if err = node.NewExecutor(d.config, n).StartService(d.unit); err != nil {
 			return err
 		}
+		return d.WaitStart(n)
+	}
 
-		if strings.Contains(info.Config.Image, "px") {
-			if !info.State.Running {
-				return fmt.Errorf(
-					"portworx container with ID %v is not running",
-					c.ID,
-				)
-			}
+	if info.State.Running {
+		return fmt.Errorf(
+			"portworx container with ID %v is not stopped on %v",
+			info.ID,
+			n.MgmtIP,
+		)
+	}
 
-			d.hostConfig = info.HostConfig
-			log.Printf("Stopping Portworx container with ID: %v\n", c.ID)
-			if err = docker.StopContainer(c.ID, 0); err != nil {
-				return err
-			}
-			return nil
-		}
+	d.Lock()
+	hostConfig := d.hostConfigs[n.ID]
+	delete(d.hostConfigs, n.ID)
+	d.Unlock()
+
+	cfgNode := d.config.Lookup(n.MgmtIP)
+	docker, err := cfgNode.DockerClient()
+	if err != nil {
+		return err
+	}
+	log.Printf("Starting Portworx container with ID %v on %v\n", info.ID, n.MgmtIP)
+	if err = docker.StartContainer(info.ID, hostConfig); err != nil {
+		return err
 	}
 
-	return fmt.Errorf("Could not find the Portworx container on %v", ip)
+	return d.WaitStart(n)
 }
 
-func (d *portworx) WaitStart(ip string) error {
-	// Wait for Portworx to become usable.
-	status, _ := d.clusterManager.NodeStatus()
-	for i := 0; status != api.Status_STATUS_OK; i++ {
-		if i > 60 {
-			return fmt.Errorf(
-				"Portworx did not start up in time: Status is %v",
-				status,
-			)
+// nodeStatus returns the status of Portworx on a node as the cluster
+// reports it.
+func (d *portworx) nodeStatus(n node.Node) (api.Status, error) {
+	cm, err := d.peerClusterManager(n)
+	if err != nil {
+		return api.Status_STATUS_NONE, err
+	}
+
+	cluster, err := cm.Enumerate()
+	if err != nil {
+		return api.Status_STATUS_NONE, err
+	}
+	for _, pxNode := range cluster.Nodes {
+		if !isNode(pxNode, n) {
+			continue
 		}
 
-		time.Sleep(1 * time.Second)
-		status, _ = d.clusterManager.NodeStatus()
+		info, err := cm.Inspect(pxNode.Id)
+		if err != nil {
+			return api.Status_STATUS_NONE, err
+		}
+		return info.Status, nil
 	}
+	return api.Status_STATUS_NONE, fmt.Errorf(
+		"%v is not a node of the Portworx cluster",
+		n.MgmtIP,
+	)
+}
 
-	return nil
+// isNode returns true if a Portworx node is the given node.  They match by
+// ID or by address.
+func isNode(pxNode api.Node, n node.Node) bool {
+	for _, id := range []string{pxNode.Id, pxNode.MgmtIp, pxNode.DataIp} {
+		if id != "" && (id == n.ID || id == n.MgmtIP || id == n.DataIP) {
+			return true
+		}
+	}
+	return false
 }
 
-func (d *portworx) Start(ip string) error {
-	endpoint := "tcp://" + ip + ":2375"
-	docker, err := dockerclient.NewClient(endpoint)
+// peerClusterManager returns a cluster client on a storage node other than
+// the given node, or on the node itself if there is no other.
+func (d *portworx) peerClusterManager(n node.Node) (cluster.Cluster, error) {
+	d.Lock()
+	defer d.Unlock()
+
+	peer := n
+	for _, other := range d.nodes {
+		if other.ID != n.ID && other.IsStorage() {
+			peer = other
+			break
+		}
+	}
+
+	if cm, ok := d.clusterManagers[peer.ID]; ok {
+		return cm, nil
+	}
+	clnt, err := clusterclient.NewClusterClient(d.endpoint(peer.MgmtIP), "v1")
 	if err != nil {
-		return err
+		return nil, err
 	}
+	cm := clusterclient.ClusterManager(clnt)
+	d.clusterManagers[peer.ID] = cm
+	return cm, nil
+}
 
-	if err = docker.Ping(); err != nil {
-		return err
+// firstNode returns the address of the first node in the cluster, which is
+// used to talk to the Portworx cluster.
+func (d *portworx) firstNode() string {
+	if len(d.config.Nodes) > 0 {
+		return d.config.Nodes[0].Address
 	}
+	return "127.0.0.1"
+}
+
+// endpoint returns the Portworx REST endpoint on a node.
+func (d *portworx) endpoint(address string) string {
+	return "http://" + address + ":" + strconv.Itoa(d.config.Volume.Port)
+}
 
-	// Find and stop the Portworx container
+// findContainer returns the Portworx container managed by the given Docker
+// daemon.  It is the only container whose name and labels match the
+// containerName and containerLabel volume options.
+func (d *portworx) findContainer(
+	docker *dockerclient.Client,
+	address string,
+) (*dockerclient.Container, error) {
 	lo := dockerclient.ListContainersOptions{
 		All:  true,
 		Size: false,
@@ -208,38 +385,68 @@ func (d *portworx) Start(ip string) error {
 
 	allContainers, err := docker.ListContainers(lo)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	var matches []dockerclient.APIContainers
 	for _, c := range allContainers {
-		info, err := docker.InspectContainer(c.ID)
-		if err != nil {
-			return err
+		if d.matchContainer(c) {
+			matches = append(matches, c)
 		}
+	}
 
-		if strings.Contains(info.Config.Image, "px") {
-			if info.State.Running {
-				return fmt.Errorf(
-					"portworx container with ID %v is not stopped",
-					c.ID,
-				)
-			}
+	switch len(matches) {
+	case 0:
+		return nil, &notFoundError{address: address}
+	case 1:
+		return docker.InspectContainer(matches[0].ID)
+	}
 
-			log.Printf("Starting Portworx container with ID: %v\n", c.ID)
-			if err = docker.StartContainer(c.ID, d.hostConfig); err != nil {
-				return err
-			}
+	ids := make([]string, 0, len(matches))
+	for _, c := range matches {
+		ids = append(ids, c.ID)
+	}
+	return nil, fmt.Errorf(
+		"Found %v Portworx containers on %v (%v), set the containerName or containerLabel volume option",
+		len(matches),
+		address,
+		strings.Join(ids, ", "),
+	)
+}
 
-			return d.WaitStart(ip)
+// matchContainer returns true if a container has a name matching the
+// containerName option and carries the containerLabel option.
+func (d *portworx) matchContainer(c dockerclient.APIContainers) bool {
+	if d.containerLabel != "" {
+		kv := strings.SplitN(d.containerLabel, "=", 2)
+		value, ok := c.Labels[kv[0]]
+		if !ok || (len(kv) == 2 && value != kv[1]) {
+			return false
 		}
 	}
 
-	log.Printf("Could not fine the Portworx container.\n")
-	return fmt.Errorf("Could not find the Portworx container on %v", ip)
+	if d.containerName == nil {
+		return true
+	}
+	for _, name := range c.Names {
+		// Docker reports the names with a leading slash.
+		if d.containerName.MatchString(strings.TrimPrefix(name, "/")) {
+			return true
+		}
+	}
+	return false
 }
 
-func init() {
-	nodes = strings.Split(os.Getenv("CLUSTER_NODES"), ",")
+// notFoundError is returned when there is no Portworx container on a node.
+type notFoundError struct {
+	address string
+}
+
+func (e *notFoundError) Error() string {
+	return fmt.Sprintf("Could not find the Portworx container on %v", e.address)
+}
 
-	register("pxd", &portworx{})
+func isNotFound(err error) bool {
+	_, ok := err.(*notFoundError)
+	return ok
 }
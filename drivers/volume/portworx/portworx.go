@@ -0,0 +1,32 @@
+package portworx
+
+import (
+	"github.com/portworx/torpedo/drivers/volume"
+)
+
+const (
+	// Name is the name the Portworx volume driver is registered under.
+	//
+	// The driver finds the Portworx container on each node with the volume
+	// options:
+	//
+	//	containerName   regular expression the container name must match,
+	//	                defaults to DefaultContainerName
+	//	containerLabel  label the container must carry, as key or key=value
+	//	unit            systemd unit of a systemd (OCI) install, defaults to
+	//	                DefaultUnit
+	//
+	// When only containerLabel is set, the container name is not checked.
+	// A node without a matching container is a systemd install, whose unit
+	// is controlled with systemctl over SSH.
+	Name = "pxd"
+	// DefaultContainerName matches the names the Portworx container is
+	// usually run with.
+	DefaultContainerName = "^(portworx|px|px-enterprise|px-dev)$"
+	// DefaultUnit is the systemd unit of a systemd (OCI) install.
+	DefaultUnit = "portworx"
+)
+
+func init() {
+	volume.Register(Name, &portworx{})
+}
@@ -0,0 +1,58 @@
+package portworx
+
+import (
+	"fmt"
+	"strings"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+
+	"github.com/portworx/torpedo/drivers/node"
+)
+
+// install is how Portworx is installed on a node.
+type install int
+
+const (
+	// containerInstall runs Portworx in a Docker container.
+	containerInstall install = iota
+	// systemdInstall runs Portworx as a systemd unit, as the OCI install
+	// does.
+	systemdInstall
+)
+
+// pxctl is the Portworx command line tool of a systemd install.
+const pxctl = "/opt/pwx/bin/pxctl"
+
+// detect returns how Portworx is installed on a node, and its container for
+// a container install.  A node without a matching container is a systemd
+// install if it has the Portworx unit.
+func (d *portworx) detect(n node.Node) (install, *dockerclient.Container, error) {
+	cfgNode := d.config.Lookup(n.MgmtIP)
+	docker, containerErr := cfgNode.DockerClient()
+	if containerErr == nil {
+		containerErr = docker.Ping()
+	}
+	if containerErr == nil {
+		info, err := d.findContainer(docker, n.MgmtIP)
+		if err == nil {
+			return containerInstall, info, nil
+		}
+		if !isNotFound(err) {
+			return containerInstall, nil, err
+		}
+		containerErr = err
+	}
+
+	state, err := node.NewExecutor(d.config, n).RunCommand(
+		"systemctl show --property=LoadState " + d.unit,
+	)
+	if err == nil && strings.TrimSpace(state) == "LoadState=loaded" {
+		return systemdInstall, nil, nil
+	}
+	return containerInstall, nil, fmt.Errorf(
+		"Could not find the Portworx container (%v) or systemd unit %v on %v",
+		containerErr,
+		d.unit,
+		n.MgmtIP,
+	)
+}
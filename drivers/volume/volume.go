@@ -2,8 +2,10 @@ package volume
 
 import (
 	"errors"
-	"os"
 	"strings"
+
+	"github.com/portworx/torpedo/config"
+	"github.com/portworx/torpedo/drivers/node"
 )
 
 // Driver defines an external volume driver interface that must be implemented
@@ -14,8 +16,11 @@ type Driver interface {
 	// String returns the string name of this driver.
 	String() string
 
-	// Init initializes the volume driver.
-	Init() error
+	// Init initializes the volume driver with the cluster configuration.
+	Init(*config.Config) error
+
+	// Version returns the version of the volume driver software.
+	Version() (string, error)
 
 	// CleanupVolume forcefully unmounts/detaches and deletes a storage volume.
 	// This is only called by Torpedo during cleanup operations, it is not
@@ -23,21 +28,21 @@ type Driver interface {
 	CleanupVolume(name string) error
 
 	// Stop must cause the volume driver to exit or get killed on a given node.
-	StopDriver(ip string) error
+	StopDriver(n node.Node) error
 
 	// Start must cause the volume driver to start on a given node.
-	StartDriver(ip string) error
+	StartDriver(n node.Node) error
 
 	// WaitStart must wait till the volume driver becomes usable on a given node.
-	WaitStart(ip string) error
+	WaitStart(n node.Node) error
 }
 
 var (
-	nodes   []string
 	drivers = make(map[string]Driver)
 )
 
-func register(name string, d Driver) error {
+// Register registers an external storage provider.
+func Register(name string, d Driver) error {
 	drivers[name] = d
 	return nil
 }
@@ -52,6 +57,16 @@ func Get(name string) (Driver, error) {
 	return nil, errors.New("No such volume driver installed")
 }
 
-func init() {
-	nodes = strings.Split(os.Getenv("CLUSTER_NODES"), ",")
+// ParseName returns the name of a volume from an inline volume specification
+// such as size=10G,repl=2,name=foo.  A plain volume name is returned as is.
+func ParseName(spec string) string {
+	if !strings.Contains(spec, "=") {
+		return spec
+	}
+	for _, opt := range strings.Split(spec, ",") {
+		if kv := strings.SplitN(opt, "=", 2); len(kv) == 2 && kv[0] == "name" {
+			return kv[1]
+		}
+	}
+	return spec
 }
@@ -0,0 +1,78 @@
+package report
+
+import (
+	"log"
+	"strings"
+
+	"github.com/portworx/torpedo/config"
+	"github.com/portworx/torpedo/drivers/scheduler"
+	"github.com/portworx/torpedo/drivers/volume"
+)
+
+const unknown = "unknown"
+
+// Fingerprint collects the specifics of the environment the tests are run
+// in.  The kernel and Docker versions are those of the Docker daemons of the
+// cluster nodes, reached as set in the cluster configuration.  Nodes with
+// different versions have all their versions listed.  Information that
+// cannot be collected is reported as unknown.
+func Fingerprint(
+	cfg *config.Config,
+	s scheduler.Driver,
+	v volume.Driver,
+) (*Environment, error) {
+	env := &Environment{
+		Kernel:        unknown,
+		Docker:        unknown,
+		VolumeVersion: unknown,
+	}
+
+	nodes, err := s.GetNodes()
+	if err != nil {
+		return nil, err
+	}
+	var kernels, dockers []string
+	for _, n := range nodes {
+		if n.Hostname != "" && n.Hostname != n.MgmtIP {
+			env.Nodes = append(env.Nodes, n.Hostname+" ("+n.MgmtIP+")")
+		} else {
+			env.Nodes = append(env.Nodes, n.MgmtIP)
+		}
+
+		cfgNode := cfg.Lookup(n.MgmtIP)
+		docker, err := cfgNode.DockerClient()
+		if err != nil {
+			log.Printf("Could not connect to Docker on %v: %v\n", n.MgmtIP, err)
+			continue
+		}
+		info, err := docker.Info()
+		if err != nil {
+			log.Printf("Could not get the Docker daemon information of %v: %v\n", n.MgmtIP, err)
+			continue
+		}
+		kernels = appendNew(kernels, info.KernelVersion)
+		dockers = appendNew(dockers, info.ServerVersion)
+	}
+	if len(kernels) > 0 {
+		env.Kernel = strings.Join(kernels, ", ")
+		env.Docker = strings.Join(dockers, ", ")
+	}
+
+	if version, err := v.Version(); err != nil {
+		log.Printf("Could not get the %v volume driver version: %v\n", v.String(), err)
+	} else {
+		env.VolumeVersion = version
+	}
+
+	return env, nil
+}
+
+// appendNew appends s to list unless it is already in it.
+func appendNew(list []string, s string) []string {
+	for _, l := range list {
+		if l == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
@@ -0,0 +1,49 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+type jsonSuite struct {
+	Scheduler string       `json:"scheduler"`
+	Volume    string       `json:"volume"`
+	Timestamp time.Time    `json:"timestamp"`
+	Tests     []jsonResult `json:"tests"`
+}
+
+type jsonResult struct {
+	Name     string  `json:"name"`
+	Status   string  `json:"status"`
+	Duration float64 `json:"duration"`
+	Error    string  `json:"error,omitempty"`
+	Reason   string  `json:"reason,omitempty"`
+	Stdout   string  `json:"stdout,omitempty"`
+	Stderr   string  `json:"stderr,omitempty"`
+}
+
+// WriteJSON writes the suite results as JSON.  Durations are in seconds.
+func WriteJSON(w io.Writer, suite *Suite) error {
+	out := jsonSuite{
+		Scheduler: suite.Scheduler,
+		Volume:    suite.Volume,
+		Timestamp: suite.Timestamp,
+		Tests:     make([]jsonResult, 0, len(suite.Results)),
+	}
+	for _, result := range suite.Results {
+		out.Tests = append(out.Tests, jsonResult{
+			Name:     result.Name,
+			Status:   result.Status.String(),
+			Duration: result.Duration.Seconds(),
+			Error:    errorString(result),
+			Reason:   result.Reason,
+			Stdout:   result.Stdout,
+			Stderr:   result.Stderr,
+		})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(out)
+}
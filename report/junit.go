@@ -0,0 +1,97 @@
+package report
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/portworx/torpedo/tests"
+)
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Properties []junitProperty `xml:"properties>property"`
+	TestCases  []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+	SystemErr string        `xml:"system-err,omitempty"`
+}
+
+type junitMessage struct {
+	Message  string `xml:"message,attr"`
+	Contents string `xml:",chardata"`
+}
+
+// WriteJUnit writes the suite results as JUnit XML.  Tests that are skipped
+// or not implemented are reported as skipped test cases.
+func WriteJUnit(w io.Writer, suite *Suite) error {
+	classname := fmt.Sprintf("torpedo.%v.%v", suite.Scheduler, suite.Volume)
+	testSuite := junitTestSuite{
+		Name:      "torpedo",
+		Tests:     len(suite.Results),
+		Timestamp: suite.Timestamp.Format(time.RFC3339),
+		Properties: []junitProperty{
+			{Name: "scheduler", Value: suite.Scheduler},
+			{Name: "volume", Value: suite.Volume},
+		},
+	}
+
+	var total time.Duration
+	for _, result := range suite.Results {
+		total += result.Duration
+		testCase := junitTestCase{
+			Name:      result.Name,
+			Classname: classname,
+			Time:      seconds(result.Duration),
+			SystemOut: result.Stdout,
+			SystemErr: result.Stderr,
+		}
+		switch result.Status {
+		case tests.Failed:
+			testSuite.Failures++
+			testCase.Failure = &junitMessage{
+				Message:  errorString(result),
+				Contents: errorString(result),
+			}
+		case tests.Skipped, tests.NotImplemented:
+			testSuite.Skipped++
+			testCase.Skipped = &junitMessage{Message: reasonString(result)}
+		}
+		testSuite.TestCases = append(testSuite.TestCases, testCase)
+	}
+	testSuite.Time = seconds(total)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(junitTestSuites{Suites: []junitTestSuite{testSuite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
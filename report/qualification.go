@@ -0,0 +1,155 @@
+package report
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"strings"
+	"text/template"
+
+	"github.com/portworx/torpedo/tests"
+)
+
+const markdownTemplate = `# Torpedo Qualification Report
+
+* Storage provider: {{.Volume}}
+* Scheduler: {{.Scheduler}}
+* Date: {{.Timestamp.Format "2006-01-02 15:04:05 MST"}}
+
+## Environment
+| Kernel | Docker | Volume Driver Version | Nodes |
+|--------|--------|-----------------------|-------|
+| {{cell .Environment.Kernel}} | {{cell .Environment.Docker}} | {{cell .Environment.VolumeVersion}} | {{cell (join .Environment.Nodes)}} |
+
+## Test Results
+| Test/Scenario | Acceptance vs Runtime Test | Expected Result | Status | Duration | Error |
+|---------------|----------------------------|-----------------|--------|----------|-------|
+{{range .Rows}}| {{cell .Description}} | {{.Category}} | {{cell .ExpectedResult}} | {{.Status}} | {{.Duration}} | {{cell .Error}} |
+{{end}}
+## Qualified External Storage Providers
+Add the following row to the "Qualified External Storage Providers" table in the Torpedo README:
+
+` + "```" + `
+| {{cell .Volume}} | {{cell .Information}} | {{cell .Coverage}} |
+` + "```" + `
+`
+
+const htmlTemplate = `<!DOCTYPE html>
+<html>
+<head><title>Torpedo Qualification Report</title></head>
+<body>
+<h1>Torpedo Qualification Report</h1>
+<ul>
+<li>Storage provider: {{.Volume}}</li>
+<li>Scheduler: {{.Scheduler}}</li>
+<li>Date: {{.Timestamp.Format "2006-01-02 15:04:05 MST"}}</li>
+</ul>
+<h2>Environment</h2>
+<table border="1">
+<tr><th>Kernel</th><th>Docker</th><th>Volume Driver Version</th><th>Nodes</th></tr>
+<tr><td>{{.Environment.Kernel}}</td><td>{{.Environment.Docker}}</td><td>{{.Environment.VolumeVersion}}</td><td>{{join .Environment.Nodes}}</td></tr>
+</table>
+<h2>Test Results</h2>
+<table border="1">
+<tr><th>Test/Scenario</th><th>Acceptance vs Runtime Test</th><th>Expected Result</th><th>Status</th><th>Duration</th><th>Error</th></tr>
+{{range .Rows}}<tr><td>{{.Description}}</td><td>{{.Category}}</td><td>{{.ExpectedResult}}</td><td>{{.Status}}</td><td>{{.Duration}}</td><td>{{.Error}}</td></tr>
+{{end}}</table>
+<h2>Qualified External Storage Providers</h2>
+<pre>| {{cell .Volume}} | {{cell .Information}} | {{cell .Coverage}} |</pre>
+</body>
+</html>
+`
+
+type qualification struct {
+	*Suite
+	Rows        []qualificationRow
+	Information string
+	Coverage    string
+}
+
+type qualificationRow struct {
+	Description    string
+	Category       string
+	ExpectedResult string
+	Status         string
+	Duration       string
+	Error          string
+}
+
+// funcs are the functions of both templates.  cell makes a string safe to
+// use in a Markdown table cell; the HTML template only uses it for the row
+// to paste into the README, and escapes everything else itself.
+var funcs = map[string]interface{}{
+	"join": func(s []string) string {
+		return strings.Join(s, ", ")
+	},
+	"cell": markdownCell,
+}
+
+// WriteQualification writes a qualification report for a storage provider.
+// The suite must have its Environment set.
+func WriteQualification(w io.Writer, suite *Suite, format Format) error {
+	q := newQualification(suite)
+	if format == HTML {
+		t, err := htmltemplate.New("html").Funcs(funcs).Parse(htmlTemplate)
+		if err != nil {
+			return err
+		}
+		return t.Execute(w, q)
+	}
+
+	t, err := template.New("markdown").Funcs(funcs).Parse(markdownTemplate)
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, q)
+}
+
+func newQualification(suite *Suite) *qualification {
+	q := &qualification{Suite: suite}
+
+	passed, acceptance, acceptancePassed := 0, 0, 0
+	for _, result := range suite.Results {
+		row := qualificationRow{
+			Description: result.Name,
+			Status:      result.Status.String(),
+			Duration:    seconds(result.Duration) + "s",
+			Error:       errorString(result),
+		}
+		if row.Error == "" {
+			row.Error = reasonString(result)
+		}
+
+		spec, err := tests.Get(result.Name)
+		if err == nil {
+			row.Description = spec.Description
+			row.Category = spec.Category.String()
+			row.ExpectedResult = spec.ExpectedResult
+			if spec.Category == tests.Acceptance {
+				acceptance++
+				if result.Status == tests.Passed {
+					acceptancePassed++
+				}
+			}
+		}
+		if result.Status == tests.Passed {
+			passed++
+		}
+		q.Rows = append(q.Rows, row)
+	}
+
+	q.Information = fmt.Sprintf("Scheduler: %v, Docker: %v, Kernel: %v, Version: %v",
+		suite.Scheduler,
+		suite.Environment.Docker,
+		suite.Environment.Kernel,
+		suite.Environment.VolumeVersion,
+	)
+	q.Coverage = fmt.Sprintf("%v/%v tests passed (%v/%v acceptance)",
+		passed,
+		len(suite.Results),
+		acceptancePassed,
+		acceptance,
+	)
+
+	return q
+}
@@ -0,0 +1,45 @@
+package report
+
+import (
+	"time"
+
+	"github.com/portworx/torpedo/tests"
+)
+
+// Suite holds the results of a Torpedo run along with the drivers it was
+// run against.
+type Suite struct {
+	// Scheduler is the name of the scheduler driver.
+	Scheduler string
+	// Volume is the name of the volume driver.
+	Volume string
+	// Timestamp is the time at which the run started.
+	Timestamp time.Time
+	// Results of each test that was run.
+	Results []tests.Result
+	// Environment the tests were run in.  This is only used by the
+	// qualification report.
+	Environment *Environment
+}
+
+// Environment is a fingerprint of the environment the tests were run in.
+type Environment struct {
+	// Kernel is the kernel version of the nodes.
+	Kernel string
+	// Docker is the version of the Docker daemons of the nodes.
+	Docker string
+	// VolumeVersion is the version of the volume driver software.
+	VolumeVersion string
+	// Nodes is the list of nodes in the cluster.
+	Nodes []string
+}
+
+// Format is the format of a qualification report.
+type Format int
+
+const (
+	// Markdown report, suitable for a GitHub PR.
+	Markdown Format = iota
+	// HTML report.
+	HTML
+)
@@ -0,0 +1,33 @@
+package report
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/portworx/torpedo/tests"
+)
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+func errorString(result tests.Result) string {
+	if result.Err == nil {
+		return ""
+	}
+	return result.Err.Error()
+}
+
+func reasonString(result tests.Result) string {
+	if result.Status == tests.NotImplemented {
+		return tests.ErrNotImplemented.Error()
+	}
+	return result.Reason
+}
+
+// markdownCell makes a string safe to use in a single Markdown table cell.
+func markdownCell(s string) string {
+	s = strings.SplitN(s, "\n", 2)[0]
+	return strings.Replace(s, "|", "\\|", -1)
+}
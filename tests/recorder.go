@@ -0,0 +1,50 @@
+package tests
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/portworx/torpedo/drivers/scheduler"
+)
+
+// recorder wraps a scheduler driver and keeps track of every task context
+// created during a test, so that the workload output can be reported.
+type recorder struct {
+	scheduler.Driver
+	contexts []*scheduler.Context
+}
+
+func newRecorder(driver scheduler.Driver) *recorder {
+	return &recorder{Driver: driver}
+}
+
+func (r *recorder) Create(task scheduler.Task) (*scheduler.Context, error) {
+	ctx, err := r.Driver.Create(task)
+	if ctx != nil {
+		r.contexts = append(r.contexts, ctx)
+	}
+	return ctx, err
+}
+
+// output returns the combined stdout and stderr of all recorded tasks.  The
+// output of each task is prefixed with the task name when more than one
+// task produced output.
+func (r *recorder) output() (string, string) {
+	stdout := bytes.NewBuffer(nil)
+	stderr := bytes.NewBuffer(nil)
+	for _, ctx := range r.contexts {
+		r.write(stdout, ctx, ctx.Stdout)
+		r.write(stderr, ctx, ctx.Stderr)
+	}
+	return stdout.String(), stderr.String()
+}
+
+func (r *recorder) write(buf *bytes.Buffer, ctx *scheduler.Context, output string) {
+	if output == "" {
+		return
+	}
+	if len(r.contexts) > 1 {
+		fmt.Fprintf(buf, "==> %v (%v) <==\n", ctx.Task.Name, ctx.ID)
+	}
+	buf.WriteString(output)
+}
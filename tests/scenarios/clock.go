@@ -0,0 +1,20 @@
+package scenarios
+
+import (
+	"time"
+)
+
+// clock is the system clock.
+type clock struct{}
+
+func newClock() *clock {
+	return &clock{}
+}
+
+func (c *clock) Now() time.Time {
+	return time.Now()
+}
+
+func (c *clock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
@@ -0,0 +1,1228 @@
+package scenarios
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/portworx/torpedo/drivers/node"
+	"github.com/portworx/torpedo/drivers/node/network"
+	"github.com/portworx/torpedo/drivers/scheduler"
+	"github.com/portworx/torpedo/drivers/volume"
+	"github.com/portworx/torpedo/tests"
+)
+
+const (
+	dockerServiceName = "docker.service"
+
+	// Name of the external volume for the Torpedo tests.
+	volName = "torpedo_vol"
+
+	// How long to wait for a node to power off or on.
+	powerTimeout = 5 * time.Minute
+
+	// How long to keep trying to start a service, and the longest wait
+	// between two attempts.
+	serviceTimeout = 5 * time.Minute
+	serviceBackoff = 30 * time.Second
+
+	// Use the inline volume specification so that we can test
+	// volume options being dynamically parsed and used inline.
+	dynName = "size=10G,repl=2,name=" + volName
+)
+
+var (
+	// Docker image to use as the test workload.
+	testImage = "torpedo/fio"
+
+	// Test image command line arguments.  This is passed into the testImage.
+	testArgs = []string{
+		"fio",
+		"--blocksize=64k",
+		"--directory=/mnt/",
+		"--ioengine=libaio",
+		"--readwrite=write",
+		"--size=1G",
+		"--name=test",
+		"--verify=meta",
+		"--do_verify=1",
+		"--verify_pattern=0xDeadBeef",
+		"--direct=1",
+		"--gtod_reduce=1",
+		"--iodepth=1",
+		"--randrepeat=1",
+	}
+
+	// Test image command line arguments of a task that writes data for a
+	// later task to verify with verifyArgs.
+	seedArgs = job(testArgs, "seed")
+
+	// Test image command line arguments of a task that verifies the data
+	// written with seedArgs, without writing.
+	verifyArgs = append(job(testArgs, "seed"), "--verify_only")
+
+	// Test image command line arguments of a task that keeps writing to
+	// its volume for a while, so that it is still writing after a fault
+	// is healed.
+	writerArgs = reportIOError(append(append([]string{}, testArgs...),
+		"--time_based",
+		"--runtime=600",
+	))
+
+	// Test image command line arguments of a task that runs long enough to
+	// outlive a Docker daemon crash, and then completes.
+	liveRestoreArgs = append(append([]string{}, testArgs...),
+		"--time_based",
+		"--runtime=120",
+	)
+)
+
+// runner runs the scenarios in an environment.
+type runner struct {
+	env *Environment
+}
+
+func newRunner(env *Environment) *runner {
+	return &runner{env: env}
+}
+
+// specs returns the scenarios.  Tests are executed in the order in which
+// they are listed here.
+func (r *runner) specs() []tests.TestSpec {
+	// Add new test functions here.
+	return []tests.TestSpec{
+		{
+			Name:           "testDynamicVolume",
+			Description:    "Create dynamic volumes",
+			Category:       tests.Runtime,
+			MinNodes:       1,
+			ExpectedResult: "Expected to be able to create a volume with arbitrary parameters at runtime",
+			Func:           r.testDynamicVolume,
+		},
+		{
+			Name:           "testRemoteForceMount",
+			Description:    "Verify that the volume driver can deal with an uneven number of mounts and unmounts and allow the volume to get mounted on another node.",
+			Category:       tests.Runtime,
+			MinNodes:       2,
+			ExpectedResult: "Expected to pass",
+			Func:           r.testRemoteForceMount,
+		},
+		{
+			Name:           "testDriverDown",
+			Description:    "Volume Driver Plugin is down, unavailable - and the client container should not be impacted.",
+			Category:       tests.Acceptance,
+			MinNodes:       1,
+			ExpectedResult: "Client container does not get an IO error.",
+			Func:           r.testDriverDown,
+		},
+		{
+			Name:           "testDriverDownContainerDown",
+			Description:    "Volume driver plugin is down and the client container gets terminated. There is a lost unmount call in this case, but the container should be able to come up on another system and use the volume.",
+			Category:       tests.Acceptance,
+			MinNodes:       2,
+			ExpectedResult: "Expected to pass.",
+			Func:           r.testDriverDownContainerDown,
+		},
+		{
+			Name:           "testNodePowerOff",
+			Description:    "A container is using a volume on node X. Node X is now powered off.",
+			Category:       tests.Acceptance,
+			MinNodes:       2,
+			ExpectedResult: "The system must be able to create a new container on node Y and use the same volume using pod replace.",
+			Func:           r.testNodePowerOff,
+		},
+		{
+			Name:           "testPluginDown",
+			Description:    "Storage plugin is down. Scheduler tries to create a container using the provider's volume.",
+			Category:       tests.Acceptance,
+			MinNodes:       1,
+			ExpectedResult: "This should fail. The container should not start and the scheduler should receive an error.",
+			Func:           r.testPluginDown,
+		},
+		{
+			Name:           "testNetworkDown",
+			Description:    "A container is running on node X. Node X looses network access and is partitioned away. Node Y that is in the cluster can use the volume for another container.",
+			Category:       tests.Acceptance,
+			MinNodes:       2,
+			ExpectedResult: "When node X re-joins the network and hence joins the cluster, it is expected that the application that is running will get I/O errors since the block volume is attached on another node.",
+			Func:           r.testNetworkDown,
+		},
+		{
+			Name:           "testNetworkPartition",
+			Description:    "A container is running on node X. Node X can only see a subset of the storage cluster. That is, it can see the entire DC/OS cluster, but just the storage cluster gets a network partition. Node Y that is in the cluster can use the volume for another container.",
+			Category:       tests.Acceptance,
+			MinNodes:       3,
+			ExpectedResult: "When node X re-joins the storage network and hence joins the cluster, it is expected that the application that is running will get I/O errors since the block volume is attached on another node.",
+			Func:           r.testNetworkPartition,
+		},
+		{
+			Name:           "testDockerDownLiveRestore",
+			Description:    "Docker daemon crashes and live restore is enabled. This scenario should be a noop. Container does not crash.",
+			Category:       tests.Acceptance,
+			MinNodes:       1,
+			ExpectedResult: "Expected to pass",
+			Func:           r.testDockerDownLiveRestore,
+		},
+	}
+}
+
+// Create dynamic volumes.  Make sure that a task can use the dynamic volume
+// in the inline format as size=x,repl=x,compress=x,name=foo.
+// This test will fail if the storage driver is not able to parse the size correctly.
+func (r *runner) testDynamicVolume(
+	s scheduler.Driver,
+	v volume.Driver,
+) error {
+	taskName := "testDynamicVolume"
+
+	// Pick the first node to start the task
+	nodes, err := s.GetNodes()
+	if err != nil {
+		return err
+	}
+
+	host := nodes[0]
+
+	// Remove any container and volume for this test - previous run may have failed.
+	s.DestroyByName(host, taskName)
+	v.CleanupVolume(volName)
+
+	t := scheduler.Task{
+		Name: taskName,
+		Node: host,
+		Img:  testImage,
+		Tag:  "latest",
+		Cmd:  testArgs,
+		Vol: scheduler.Volume{
+			Driver: v.String(),
+			Name:   dynName,
+			Path:   "/mnt/",
+			Size:   10240,
+		},
+	}
+
+	ctx, err := s.Create(t)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if ctx != nil {
+			s.Destroy(ctx)
+		}
+		v.CleanupVolume(volName)
+	}()
+
+	// Run the task and wait for completion.  This task will exit and
+	// must not be re-started by the scheduler.
+	if err = s.Run(ctx); err != nil {
+		return err
+	}
+
+	if ctx.Status != 0 {
+		return fmt.Errorf("exit status %v\nStdout: %v\nStderr: %v",
+			ctx.Status,
+			ctx.Stdout,
+			ctx.Stderr,
+		)
+	}
+
+	// Verify that the volume properties are honored.
+	vol, err := s.InspectVolume(host, dynName)
+	if err != nil {
+		return err
+	}
+
+	if vol.Driver != v.String() {
+		return fmt.Errorf(
+			"dynamic volume creation failed, incorrect volume driver (driver = %v)",
+			vol.Driver,
+		)
+	}
+	return nil
+}
+
+// Volume Driver Plugin is down, unavailable - and the client container should
+// not be impacted.
+func (r *runner) testDriverDown(
+	s scheduler.Driver,
+	v volume.Driver,
+) error {
+	taskName := "testDriverDown"
+
+	// Pick the first node to start the task
+	nodes, err := s.GetNodes()
+	if err != nil {
+		return err
+	}
+
+	host := nodes[0]
+
+	// Remove any container and volume for this test - previous run may have failed.
+	s.DestroyByName(host, taskName)
+	v.CleanupVolume(volName)
+
+	t := scheduler.Task{
+		Name: taskName,
+		Node: host,
+		Img:  testImage,
+		Tag:  "latest",
+		Cmd:  testArgs,
+		Vol: scheduler.Volume{
+			Driver: v.String(),
+			Name:   dynName,
+			Path:   "/mnt/",
+			Size:   10240,
+		},
+	}
+
+	ctx, err := s.Create(t)
+
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if ctx != nil {
+			s.Destroy(ctx)
+		}
+		v.CleanupVolume(volName)
+	}()
+
+	if err = s.Schedule(ctx); err != nil {
+		return err
+	}
+
+	// Sleep for fio to get going...
+	r.env.Clock.Sleep(20 * time.Second)
+
+	// Stop the volume driver.
+	log.Printf("Stopping the %v volume driver\n", v.String())
+	if err = v.StopDriver(ctx.Task.Node); err != nil {
+		return err
+	}
+
+	// Sleep for fio to keep going...
+	r.env.Clock.Sleep(20 * time.Second)
+
+	// Restart the volume driver.
+	log.Printf("Starting the %v volume driver\n", v.String())
+	if err = v.StartDriver(ctx.Task.Node); err != nil {
+		return err
+	}
+
+	log.Printf("Waiting for the test task to exit\n")
+	if err = s.WaitDone(ctx); err != nil {
+		return err
+	}
+
+	if ctx.Status != 0 {
+		return fmt.Errorf("exit status %v\nStdout: %v\nStderr: %v",
+			ctx.Status,
+			ctx.Stdout,
+			ctx.Stderr,
+		)
+	}
+	return nil
+}
+
+// Volume driver plugin is down and the client container gets terminated.
+// There is a lost unmount call in this case. When the volume driver is
+// back up, we should be able to detach and delete the volume.
+func (r *runner) testDriverDownContainerDown(
+	s scheduler.Driver,
+	v volume.Driver,
+) error {
+	taskName := "testDriverDownContainerDown"
+
+	// Pick the first node to start the task
+	nodes, err := s.GetNodes()
+	if err != nil {
+		return err
+	}
+
+	host := nodes[0]
+
+	// Remove any container and volume for this test - previous run may have failed.
+	s.DestroyByName(host, taskName)
+	v.CleanupVolume(volName)
+
+	t := scheduler.Task{
+		Name: taskName,
+		Node: host,
+		Img:  testImage,
+		Tag:  "latest",
+		Cmd:  testArgs,
+		Vol: scheduler.Volume{
+			Driver: v.String(),
+			Name:   dynName,
+			Path:   "/mnt/",
+			Size:   10240,
+		},
+	}
+
+	ctx, err := s.Create(t)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if ctx != nil {
+			s.Destroy(ctx)
+		}
+		v.CleanupVolume(volName)
+	}()
+
+	if err = s.Schedule(ctx); err != nil {
+		return err
+	}
+
+	// Sleep for fio to get going...
+	r.env.Clock.Sleep(20 * time.Second)
+
+	// Stop the volume driver.
+	log.Printf("Stopping the %v volume driver\n", v.String())
+	if err = v.StopDriver(ctx.Task.Node); err != nil {
+		return err
+	}
+
+	// Wait for the task to exit. This will lead to a lost Unmount/Detach call.
+	log.Printf("Waiting for the test task to exit\n")
+	if err = s.WaitDone(ctx); err != nil {
+		return err
+	}
+
+	if ctx.Status == 0 {
+		return fmt.Errorf("unexpected success exit status %v\nStdout: %v\nStderr: %v",
+			ctx.Status,
+			ctx.Stdout,
+			ctx.Stderr,
+		)
+	}
+
+	// Restart the volume driver.
+	log.Printf("Starting the %v volume driver\n", v.String())
+	if err = v.StartDriver(ctx.Task.Node); err != nil {
+		return err
+	}
+
+	// Check to see if you can delete the volume from another node
+	log.Printf("Deleting the attached volume: %v from %v\n", volName, nodes[1].MgmtIP)
+	if err = s.DeleteVolume(nodes[1], volName); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Verify that the volume driver can deal with an event where Docker and the
+// client container crash on this system.  The volume should be able
+// to get moounted on another node.
+func (r *runner) testRemoteForceMount(
+	s scheduler.Driver,
+	v volume.Driver,
+) error {
+	taskName := "testRemoteForceMount"
+
+	// Pick the first node to start the task
+	nodes, err := s.GetNodes()
+	if err != nil {
+		return err
+	}
+
+	host := nodes[0]
+	executor := r.env.Executor(host)
+	if err = executor.IsReachable(); err != nil {
+		return tests.Skip("cannot run commands on %v: %v", host.MgmtIP, err)
+	}
+
+	// Remove any container and volume for this test - previous run may have failed.
+	s.DestroyByName(host, taskName)
+	v.CleanupVolume(volName)
+
+	t := scheduler.Task{
+		Name: taskName,
+		Img:  testImage,
+		Node: host,
+		Tag:  "latest",
+		Cmd:  testArgs,
+		Vol: scheduler.Volume{
+			Driver: v.String(),
+			Name:   dynName,
+			Path:   "/mnt/",
+			Size:   10240,
+		},
+	}
+
+	local, err := s.Create(t)
+	if err != nil {
+		return err
+	}
+
+	var ctx *scheduler.Context
+	defer func() {
+		if err := executor.StartService(dockerServiceName); err != nil {
+			log.Printf("Error while restarting Docker: %v\n", err)
+		}
+		if local != nil {
+			s.Destroy(local)
+		}
+		if ctx != nil {
+			s.Destroy(ctx)
+		}
+		v.CleanupVolume(volName)
+	}()
+
+	log.Printf("Starting test task on %v.\n", host.MgmtIP)
+	if err = s.Schedule(local); err != nil {
+		return err
+	}
+
+	// Sleep for fio to get going...
+	r.env.Clock.Sleep(20 * time.Second)
+
+	// Kill Docker.
+	log.Printf("Stopping Docker on %v.\n", host.MgmtIP)
+	if err = executor.StopService(dockerServiceName); err != nil {
+		return err
+	}
+
+	// 40 second grace period before we try to use the volume elsewhere.
+	r.env.Clock.Sleep(40 * time.Second)
+
+	// Start a task on a new system with this same volume.
+	log.Printf("Creating the test task on a new host.\n")
+	t.Placement = scheduler.ExternalHost
+	if ctx, err = s.Create(t); err != nil {
+		log.Printf("Error while creating remote task: %v\n", err)
+		return err
+	}
+
+	if err = s.Schedule(ctx); err != nil {
+		return err
+	}
+
+	// Sleep for fio to get going...
+	r.env.Clock.Sleep(20 * time.Second)
+
+	// Wait for the task to exit. This will lead to a lost Unmount/Detach call.
+	log.Printf("Waiting for the test task to exit\n")
+	if err = s.WaitDone(ctx); err != nil {
+		return err
+	}
+
+	if ctx.Status != 0 {
+		return fmt.Errorf("exit status %v\nStdout: %v\nStderr: %v",
+			ctx.Status,
+			ctx.Stdout,
+			ctx.Stderr,
+		)
+	}
+
+	// Restart Docker.
+	log.Printf("Restarting Docker on %v.\n", host.MgmtIP)
+	if err = r.startService(executor, dockerServiceName); err != nil {
+		return fmt.Errorf("could not restart Docker: %v", err)
+	}
+
+	// Wait for the volume driver to start.
+	log.Printf("Waiting for the %v volume driver to start back up\n", v.String())
+	if err = v.WaitStart(host); err != nil {
+		return err
+	}
+
+	// The container that was running when Docker was stopped still uses
+	// the volume, so it must be removed before the volume can be.
+	if err = s.Destroy(local); err != nil {
+		return err
+	}
+	local = nil
+
+	// Check to see if you can delete the volume.
+	log.Printf("Deleting the attached volume: %v from this host\n", volName)
+	if err = s.DeleteVolume(host, volName); err != nil {
+		return err
+	}
+	return nil
+}
+
+// A container is using a volume on node X.  Node X is now powered off.
+// The volume must be usable by a new container on node Y, the data written
+// on X before the power loss must read back on Y, and the data the new
+// container writes there must verify.
+func (r *runner) testNodePowerOff(
+	s scheduler.Driver,
+	v volume.Driver,
+) error {
+	taskName := "testNodePowerOff"
+
+	if r.env.Power == nil {
+		return tests.Skip("no power driver is configured")
+	}
+	if !r.env.Power.CanPowerOn() {
+		return tests.Skip("the %v power driver cannot power nodes back on", r.env.Power.String())
+	}
+
+	// Pick a node other than the one Torpedo runs on to start the task,
+	// since that node is powered off.
+	nodes, err := s.GetNodes()
+	if err != nil {
+		return err
+	}
+
+	host, err := remoteNode(nodes)
+	if err != nil {
+		return err
+	}
+
+	// Remove any container and volume for this test - previous run may have failed.
+	s.DestroyByName(host, taskName)
+	v.CleanupVolume(volName)
+
+	t := scheduler.Task{
+		Name: taskName,
+		Img:  testImage,
+		Node: host,
+		Tag:  "latest",
+		Cmd:  seedArgs,
+		Vol: scheduler.Volume{
+			Driver: v.String(),
+			Name:   dynName,
+			Path:   "/mnt/",
+			Size:   10240,
+		},
+	}
+
+	var writer, ctx *scheduler.Context
+	poweredOff := false
+	defer func() {
+		if poweredOff {
+			if err := r.powerOn(v, host); err != nil {
+				log.Printf("Error while powering %v back on: %v\n", host.MgmtIP, err)
+			}
+		}
+		for _, c := range []*scheduler.Context{ctx, writer} {
+			if c == nil {
+				continue
+			}
+			if err := s.Destroy(c); err != nil {
+				log.Printf("Error while deleting task %v: %v\n", c.ID, err)
+			}
+		}
+		v.CleanupVolume(volName)
+	}()
+
+	// Write the data that is read back on the new host.  fio writes it
+	// with direct I/O, so it is on the volume once the task exits.
+	log.Printf("Writing the test data on %v.\n", host.MgmtIP)
+	if ctx, err = s.Create(t); err != nil {
+		return err
+	}
+	if err = s.Run(ctx); err != nil {
+		return err
+	}
+	if ctx.Status != 0 {
+		return fmt.Errorf("could not write the test data, exit status %v\nStdout: %v\nStderr: %v",
+			ctx.Status,
+			ctx.Stdout,
+			ctx.Stderr,
+		)
+	}
+	if err = s.Destroy(ctx); err != nil {
+		return err
+	}
+	ctx = nil
+
+	t.Cmd = testArgs
+	if writer, err = s.Create(t); err != nil {
+		return err
+	}
+
+	log.Printf("Starting test task on %v.\n", host.MgmtIP)
+	if err = s.Schedule(writer); err != nil {
+		return err
+	}
+
+	// Sleep for fio to get going...
+	r.env.Clock.Sleep(20 * time.Second)
+
+	// Power off the node.
+	log.Printf("Powering off %v with the %v power driver.\n", host.MgmtIP, r.env.Power.String())
+	if err = r.env.Power.PowerOff(host); err != nil {
+		return err
+	}
+	poweredOff = true
+	if err = r.waitPower(host, false); err != nil {
+		return err
+	}
+
+	// 40 second grace period before we try to use the volume elsewhere.
+	r.env.Clock.Sleep(40 * time.Second)
+
+	// Read the data written on the old host back on a new host.
+	log.Printf("Verifying the test data on a new host.\n")
+	t.Cmd = verifyArgs
+	t.Placement = scheduler.ExternalHost
+	if ctx, err = s.Create(t); err != nil {
+		log.Printf("Error while creating remote task: %v\n", err)
+		return err
+	}
+	if err = s.Run(ctx); err != nil {
+		return err
+	}
+	if ctx.Status != 0 {
+		return fmt.Errorf("the data written on %v does not verify on %v, exit status %v\nStdout: %v\nStderr: %v",
+			host.MgmtIP,
+			ctx.Task.Node.MgmtIP,
+			ctx.Status,
+			ctx.Stdout,
+			ctx.Stderr,
+		)
+	}
+	if err = s.Destroy(ctx); err != nil {
+		return err
+	}
+
+	// Start a task on the new host with this same volume.  fio verifies
+	// the data it writes, so the task only succeeds if the volume works.
+	log.Printf("Creating the test task on the new host.\n")
+	t.Cmd = testArgs
+	t.Node = ctx.Task.Node
+	t.Placement = scheduler.LocalHost
+	if ctx, err = s.Create(t); err != nil {
+		log.Printf("Error while creating remote task: %v\n", err)
+		return err
+	}
+
+	if err = s.Schedule(ctx); err != nil {
+		return err
+	}
+
+	log.Printf("Waiting for the test task to exit\n")
+	if err = s.WaitDone(ctx); err != nil {
+		return err
+	}
+
+	if ctx.Status != 0 {
+		return fmt.Errorf("exit status %v\nStdout: %v\nStderr: %v",
+			ctx.Status,
+			ctx.Stdout,
+			ctx.Stderr,
+		)
+	}
+
+	// Power the node back on, so that the volume is cleaned up with it
+	// back in the cluster.
+	poweredOff = false
+	return r.powerOn(v, host)
+}
+
+// Storage plugin is down.  Scheduler tries to create a container using the
+// provider’s volume.
+func (r *runner) testPluginDown(
+	d scheduler.Driver,
+	v volume.Driver,
+) error {
+	return tests.ErrNotImplemented
+}
+
+// A container is running on node X.  Node X loses network access and is
+// partitioned away.  Node Y that is in the cluster can use the volume for
+// another container.  When node X rejoins, the container on node X must get
+// I/O errors rather than keep writing to the volume.
+func (r *runner) testNetworkDown(
+	s scheduler.Driver,
+	v volume.Driver,
+) error {
+	taskName := "testNetworkDown"
+
+	// Pick a node other than the one Torpedo runs on to start the task,
+	// since that node is isolated.
+	nodes, err := s.GetNodes()
+	if err != nil {
+		return err
+	}
+
+	host, err := remoteNode(nodes)
+	if err != nil {
+		return err
+	}
+	if err = r.env.Executor(host).IsReachable(); err != nil {
+		return tests.Skip("cannot run commands on %v: %v", host.MgmtIP, err)
+	}
+	fault := r.env.Network
+
+	// Remove any container and volume for this test - previous run may have failed.
+	s.DestroyByName(host, taskName)
+	v.CleanupVolume(volName)
+
+	t := scheduler.Task{
+		Name: taskName,
+		Img:  testImage,
+		Node: host,
+		Tag:  "latest",
+		Cmd:  writerArgs,
+		Vol: scheduler.Volume{
+			Driver: v.String(),
+			Name:   dynName,
+			Path:   "/mnt/",
+			Size:   10240,
+		},
+	}
+
+	writer, err := s.Create(t)
+	if err != nil {
+		return err
+	}
+
+	var ctx *scheduler.Context
+	isolated := false
+	defer func() {
+		if isolated {
+			if err := fault.Heal(host); err != nil {
+				log.Printf("Error while healing the network of %v: %v\n", host.MgmtIP, err)
+			}
+		}
+		s.Destroy(writer)
+		if ctx != nil {
+			s.Destroy(ctx)
+		}
+		v.CleanupVolume(volName)
+	}()
+
+	log.Printf("Starting the writer task on %v.\n", host.MgmtIP)
+	if err = s.Schedule(writer); err != nil {
+		return err
+	}
+
+	// Sleep for fio to get going...
+	r.env.Clock.Sleep(20 * time.Second)
+
+	if err = fault.Isolate(host); err != nil {
+		return err
+	}
+	isolated = true
+
+	// 40 second grace period before we try to use the volume elsewhere.
+	r.env.Clock.Sleep(40 * time.Second)
+
+	// Start a task on a new system with this same volume.
+	log.Printf("Creating the test task on a new host.\n")
+	t.Placement = scheduler.ExternalHost
+	t.Cmd = testArgs
+	if ctx, err = s.Create(t); err != nil {
+		log.Printf("Error while creating remote task: %v\n", err)
+		return err
+	}
+
+	if err = s.Schedule(ctx); err != nil {
+		return err
+	}
+
+	log.Printf("Waiting for the test task to exit\n")
+	if err = s.WaitDone(ctx); err != nil {
+		return err
+	}
+
+	if ctx.Status != 0 {
+		return fmt.Errorf("exit status %v\nStdout: %v\nStderr: %v",
+			ctx.Status,
+			ctx.Stdout,
+			ctx.Stderr,
+		)
+	}
+
+	// Let node X rejoin.  The writer on node X is now stale, since the
+	// volume was used on node Y.
+	if err = fault.Heal(host); err != nil {
+		return err
+	}
+	isolated = false
+
+	log.Printf("Waiting for the stale writer task on %v to exit\n", host.MgmtIP)
+	if err = s.WaitDone(writer); err != nil {
+		return err
+	}
+	if err = expectIOError(writer); err != nil {
+		return err
+	}
+
+	log.Printf("Waiting for the %v volume driver to start back up\n", v.String())
+	return v.WaitStart(host)
+}
+
+// A container is running on node X.  Node X can only see a subset of the
+// storage cluster.  That is, it can see the entire DC/OS cluster, but just the
+// storage cluster gets a network partition. Node Y that is in the cluster
+// can use the volume for another container.
+//
+// The nodes are split into a minority that includes node X and a majority
+// that includes node Y, and only the storage ports are partitioned.  The
+// volume must be usable from the majority, and node X must be fenced: its
+// container must get I/O errors rather than keep writing to the volume.
+func (r *runner) testNetworkPartition(
+	s scheduler.Driver,
+	v volume.Driver,
+) error {
+	taskName := "testNetworkPartition"
+
+	nodes, err := s.GetNodes()
+	if err != nil {
+		return err
+	}
+	if len(nodes) < 3 {
+		return tests.Skip("a storage partition needs at least 3 nodes, there are %v", len(nodes))
+	}
+	for _, n := range nodes {
+		if err = r.env.Executor(n).IsReachable(); err != nil {
+			return tests.Skip("cannot run commands on %v: %v", n.MgmtIP, err)
+		}
+	}
+
+	// The minority is smaller than half of the nodes.
+	minority := nodes[:(len(nodes)-1)/2]
+	majority := nodes[len(minority):]
+	host := minority[0]
+	fault := r.env.Network
+	ports := network.StoragePorts(r.env.Config, v.String())
+
+	// Remove any container and volume for this test - previous run may have failed.
+	s.DestroyByName(host, taskName)
+	v.CleanupVolume(volName)
+
+	t := scheduler.Task{
+		Name: taskName,
+		Img:  testImage,
+		Node: host,
+		Tag:  "latest",
+		Cmd:  writerArgs,
+		Vol: scheduler.Volume{
+			Driver: v.String(),
+			Name:   dynName,
+			Path:   "/mnt/",
+			Size:   10240,
+		},
+	}
+
+	writer, err := s.Create(t)
+	if err != nil {
+		return err
+	}
+
+	var ctx *scheduler.Context
+	partitioned := false
+	defer func() {
+		if partitioned {
+			for _, n := range nodes {
+				if err := fault.Heal(n); err != nil {
+					log.Printf("Error while healing the network of %v: %v\n", n.MgmtIP, err)
+				}
+			}
+		}
+		s.Destroy(writer)
+		if ctx != nil {
+			s.Destroy(ctx)
+		}
+		v.CleanupVolume(volName)
+	}()
+
+	log.Printf("Starting the writer task on %v.\n", host.MgmtIP)
+	if err = s.Schedule(writer); err != nil {
+		return err
+	}
+
+	// Sleep for fio to get going...
+	r.env.Clock.Sleep(20 * time.Second)
+
+	partitioned = true
+	if err = fault.Partition(minority, majority, ports); err != nil {
+		return err
+	}
+
+	// 40 second grace period before we try to use the volume elsewhere.
+	r.env.Clock.Sleep(40 * time.Second)
+
+	// Start a task on the majority side with this same volume.
+	log.Printf("Creating the test task on %v.\n", majority[0].MgmtIP)
+	t.Node = majority[0]
+	t.Cmd = testArgs
+	if ctx, err = s.Create(t); err != nil {
+		log.Printf("Error while creating the task on the majority: %v\n", err)
+		return err
+	}
+
+	if err = s.Schedule(ctx); err != nil {
+		return err
+	}
+
+	log.Printf("Waiting for the test task to exit\n")
+	if err = s.WaitDone(ctx); err != nil {
+		return err
+	}
+
+	if ctx.Status != 0 {
+		return fmt.Errorf("exit status %v\nStdout: %v\nStderr: %v",
+			ctx.Status,
+			ctx.Stdout,
+			ctx.Stderr,
+		)
+	}
+
+	// Let the minority rejoin.
+	for _, n := range nodes {
+		if err = fault.Heal(n); err != nil {
+			return err
+		}
+	}
+	partitioned = false
+
+	log.Printf("Waiting for the stale writer task on %v to exit\n", host.MgmtIP)
+	if err = s.WaitDone(writer); err != nil {
+		return err
+	}
+	if err = expectIOError(writer); err != nil {
+		return err
+	}
+
+	log.Printf("Waiting for the %v volume driver to start back up\n", v.String())
+	return v.WaitStart(host)
+}
+
+// Docker daemon crashes and live restore is enabled.  The container using
+// the volume must keep running through the crash, with its volume mounted,
+// and complete its I/O successfully.
+func (r *runner) testDockerDownLiveRestore(
+	s scheduler.Driver,
+	v volume.Driver,
+) error {
+	taskName := "testDockerDownLiveRestore"
+
+	// Pick the first node to start the task
+	nodes, err := s.GetNodes()
+	if err != nil {
+		return err
+	}
+
+	host := nodes[0]
+	if err = r.env.Executor(host).IsReachable(); err != nil {
+		return tests.Skip("cannot run commands on %v: %v", host.MgmtIP, err)
+	}
+	daemon := r.env.Docker
+
+	// Remove any container and volume for this test - previous run may have failed.
+	s.DestroyByName(host, taskName)
+	v.CleanupVolume(volName)
+
+	if err = daemon.SetLiveRestore(host, true); err != nil {
+		return err
+	}
+	defer func() {
+		if err := daemon.RestoreConfig(host); err != nil {
+			log.Printf("Error while restoring the Docker daemon configuration of %v: %v\n", host.MgmtIP, err)
+		}
+	}()
+
+	t := scheduler.Task{
+		Name: taskName,
+		Img:  testImage,
+		Node: host,
+		Tag:  "latest",
+		Cmd:  liveRestoreArgs,
+		Vol: scheduler.Volume{
+			Driver: v.String(),
+			Name:   dynName,
+			Path:   "/mnt/",
+			Size:   10240,
+		},
+	}
+
+	ctx, err := s.Create(t)
+	if err != nil {
+		return err
+	}
+
+	killed := false
+	defer func() {
+		if killed {
+			if err := daemon.Start(host); err != nil {
+				log.Printf("Error while starting the Docker daemon on %v: %v\n", host.MgmtIP, err)
+			}
+		}
+		s.Destroy(ctx)
+		v.CleanupVolume(volName)
+	}()
+
+	if err = s.Schedule(ctx); err != nil {
+		return err
+	}
+
+	// Sleep for fio to get going...
+	r.env.Clock.Sleep(20 * time.Second)
+
+	before, err := daemon.VolumeContainer(host, v.String(), t.Vol.Path)
+	if err != nil {
+		return err
+	}
+
+	killed = true
+	if err = daemon.Kill(host); err != nil {
+		return err
+	}
+
+	// Leave the daemon down while fio keeps writing.
+	r.env.Clock.Sleep(20 * time.Second)
+
+	if err = daemon.Start(host); err != nil {
+		return err
+	}
+	killed = false
+
+	// The container must be the same one, and must not have been
+	// restarted.
+	after, err := daemon.VolumeContainer(host, v.String(), t.Vol.Path)
+	if err != nil {
+		return err
+	}
+	if after.ID != before.ID || !after.State.StartedAt.Equal(before.State.StartedAt) {
+		return fmt.Errorf(
+			"the test task container on %v did not survive the Docker daemon crash: it was %v started at %v, it is %v started at %v",
+			host.MgmtIP,
+			before.ID,
+			before.State.StartedAt,
+			after.ID,
+			after.State.StartedAt,
+		)
+	}
+
+	log.Printf("Waiting for the test task to exit\n")
+	if err = s.WaitDone(ctx); err != nil {
+		return err
+	}
+
+	if ctx.Status != 0 {
+		return fmt.Errorf("exit status %v\nStdout: %v\nStderr: %v",
+			ctx.Status,
+			ctx.Stdout,
+			ctx.Stderr,
+		)
+	}
+
+	return nil
+}
+
+// expectIOError returns an error unless a task failed with an I/O error.  A
+// stale writer must get I/O errors, since writes that succeed may corrupt
+// the data of the node that took over the volume.
+func expectIOError(ctx *scheduler.Context) error {
+	if ctx.Status == 0 {
+		return fmt.Errorf(
+			"the stale writer task on %v did not get an I/O error, its writes may have corrupted the volume\nStdout: %v\nStderr: %v",
+			ctx.Task.Node.MgmtIP,
+			ctx.Stdout,
+			ctx.Stderr,
+		)
+	}
+	if ctx.Status != scheduler.IOErrorStatus {
+		return fmt.Errorf(
+			"the stale writer task on %v failed without an I/O error: exit status %v\nStdout: %v\nStderr: %v",
+			ctx.Task.Node.MgmtIP,
+			ctx.Status,
+			ctx.Stdout,
+			ctx.Stderr,
+		)
+	}
+	return nil
+}
+
+// remoteNode returns the first node that Torpedo does not run on, so that
+// a fault injected into it does not cut Torpedo off.  The scenario is
+// skipped if there is no such node.
+func remoteNode(nodes []node.Node) (node.Node, error) {
+	for _, n := range nodes {
+		if !n.Local {
+			return n, nil
+		}
+	}
+	return node.Node{}, tests.Skip("Torpedo runs on every node")
+}
+
+// powerOn powers a node on and waits for it and its volume driver to come
+// up.
+func (r *runner) powerOn(v volume.Driver, n node.Node) error {
+	log.Printf("Powering on %v with the %v power driver.\n", n.MgmtIP, r.env.Power.String())
+	if err := r.env.Power.PowerOn(n); err != nil {
+		return err
+	}
+	if err := r.waitPower(n, true); err != nil {
+		return err
+	}
+
+	log.Printf("Waiting for the %v volume driver to start back up\n", v.String())
+	return v.WaitStart(n)
+}
+
+// startService starts a service, and retries with a growing delay while
+// it fails to start.  It stops retrying once the node is unreachable, since
+// the service cannot be started then.
+func (r *runner) startService(executor node.Executor, unit string) error {
+	start := r.env.Clock.Now()
+	for delay := time.Second; ; delay *= 2 {
+		err := executor.StartService(unit)
+		if err == nil {
+			return nil
+		}
+		if reachErr := executor.IsReachable(); reachErr != nil {
+			return reachErr
+		}
+		if r.env.Clock.Now().Sub(start) >= serviceTimeout {
+			return err
+		}
+		if delay > serviceBackoff {
+			delay = serviceBackoff
+		}
+		log.Printf("%v did not start, retrying in %v: %v\n", unit, delay, err)
+		r.env.Clock.Sleep(delay)
+	}
+}
+
+// waitPower waits for a node to be powered on or off.
+func (r *runner) waitPower(n node.Node, up bool) error {
+	for start := r.env.Clock.Now(); r.env.Clock.Now().Sub(start) < powerTimeout; r.env.Clock.Sleep(5 * time.Second) {
+		isUp, err := r.env.Power.IsUp(n)
+		if err != nil {
+			return err
+		}
+		if isUp == up {
+			return nil
+		}
+	}
+	return fmt.Errorf("%v did not power on or off in time", n.MgmtIP)
+}
+
+// reportIOError wraps fio command line arguments in a shell, so that the
+// task exits with scheduler.IOErrorStatus if fio fails with EIO.  fio exits
+// with 1 whatever the error, so the errno is read from the error field of
+// its terse output.
+func reportIOError(args []string) []string {
+	script := `"$@" --output-format=terse --terse-version=3 --output=/tmp/fio.out; ` +
+		`status=$?; cat /tmp/fio.out; ` +
+		`if [ "$(head -n 1 /tmp/fio.out | cut -d ';' -f 5)" = ` + strconv.Itoa(scheduler.IOErrorStatus) + ` ]; then ` +
+		`exit ` + strconv.Itoa(scheduler.IOErrorStatus) + `; fi; exit $status`
+	return append([]string{"sh", "-c", script, "sh"}, args...)
+}
+
+// job returns a copy of fio command line arguments with the given job name.
+// fio names the files of a job after it, so jobs with different names do
+// not overwrite each other's data.
+func job(args []string, name string) []string {
+	renamed := make([]string, 0, len(args))
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--name=") {
+			arg = "--name=" + name
+		}
+		renamed = append(renamed, arg)
+	}
+	return renamed
+}
@@ -0,0 +1,67 @@
+package scenarios
+
+import (
+	"time"
+
+	"github.com/portworx/torpedo/config"
+	"github.com/portworx/torpedo/drivers/node"
+	"github.com/portworx/torpedo/drivers/node/docker"
+	"github.com/portworx/torpedo/drivers/node/network"
+	"github.com/portworx/torpedo/tests"
+)
+
+// Clock tells the time and waits.  Scenarios wait for workloads and faults
+// to take effect through it, so that they can be run without waiting.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// Sleep waits for the given duration.
+	Sleep(d time.Duration)
+}
+
+// Environment holds what the scenarios use besides the scheduler and volume
+// drivers to inject faults into the cluster.
+type Environment struct {
+	// Config is the configuration of the cluster.
+	Config *config.Config
+	// Power powers the nodes off and on.  It is nil if no power driver is
+	// configured, and the scenarios that need it are skipped.
+	Power node.Power
+	// Executor returns the executor that runs commands on a node.
+	Executor func(n node.Node) node.Executor
+	// Network injects network faults.
+	Network network.Fault
+	// Docker manipulates the Docker daemons.
+	Docker docker.Daemon
+	// Clock is the clock the scenarios wait with.
+	Clock Clock
+}
+
+// NewClock returns the system clock.
+func NewClock() Clock {
+	return newClock()
+}
+
+// NewEnvironment returns the environment of a cluster, which injects faults
+// with the executors and the network and Docker drivers of the nodes.
+// power may be nil.
+func NewEnvironment(cfg *config.Config, power node.Power) Environment {
+	return Environment{
+		Config: cfg,
+		Power:  power,
+		Executor: func(n node.Node) node.Executor {
+			return node.NewExecutor(cfg, n)
+		},
+		Network: network.New(cfg),
+		Docker:  docker.New(cfg),
+		Clock:   NewClock(),
+	}
+}
+
+// Specs returns the Torpedo test scenarios in the order they should run.
+// The scenarios use the environment env points to when they run, so it can
+// be set up after they are registered.
+func Specs(env *Environment) []tests.TestSpec {
+	return newRunner(env).specs()
+}
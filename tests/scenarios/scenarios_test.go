@@ -0,0 +1,587 @@
+package scenarios
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	dockerclient "github.com/fsouza/go-dockerclient"
+
+	"github.com/portworx/torpedo/config"
+	"github.com/portworx/torpedo/drivers/node"
+	"github.com/portworx/torpedo/drivers/scheduler"
+	fakescheduler "github.com/portworx/torpedo/drivers/scheduler/fake"
+	fakevolume "github.com/portworx/torpedo/drivers/volume/fake"
+	"github.com/portworx/torpedo/tests"
+)
+
+// harness runs the scenarios against the fake scheduler and volume drivers,
+// with fakes for the rest of the environment.
+type harness struct {
+	t         *testing.T
+	scheduler fakescheduler.Driver
+	volume    fakevolume.Driver
+	nodes     []node.Node
+	clock     *fakeClock
+	executors map[string]*fakeExecutor
+	daemon    *fakeDaemon
+	env       *Environment
+}
+
+func newHarness(t *testing.T, addresses ...string) *harness {
+	cfg := config.FromAddresses(addresses)
+	h := &harness{
+		t:         t,
+		scheduler: fakescheduler.New(),
+		volume:    fakevolume.New(),
+		clock:     &fakeClock{now: time.Unix(0, 0)},
+		executors: make(map[string]*fakeExecutor),
+		daemon:    &fakeDaemon{startedAt: time.Unix(0, 0)},
+	}
+	if err := h.scheduler.Init(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.volume.Init(cfg); err != nil {
+		t.Fatal(err)
+	}
+	h.scheduler.UseVolumeDriver(h.volume)
+
+	nodes, err := h.scheduler.GetNodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.nodes = nodes
+	for _, n := range nodes {
+		h.executors[n.ID] = &fakeExecutor{}
+	}
+
+	h.env = &Environment{
+		Config: cfg,
+		Executor: func(n node.Node) node.Executor {
+			return h.executors[n.ID]
+		},
+		Docker: h.daemon,
+		Clock:  h.clock,
+	}
+	return h
+}
+
+// run runs the named scenario and returns its result.
+func (h *harness) run(name string) tests.Result {
+	for _, spec := range Specs(h.env) {
+		if spec.Name == name {
+			return tests.Run(spec, h.scheduler, h.volume)
+		}
+	}
+	h.t.Fatalf("no such scenario %v", name)
+	return tests.Result{}
+}
+
+// expect fails the test unless the named scenario has the given status.
+func (h *harness) expect(name string, status tests.Status) tests.Result {
+	result := h.run(name)
+	if result.Status != status {
+		h.t.Fatalf(
+			"%v: expected status %v, got %v: %v %v",
+			name,
+			status,
+			result.Status,
+			result.Err,
+			result.Reason,
+		)
+	}
+	return result
+}
+
+func TestDynamicVolume(t *testing.T) {
+	h := newHarness(t, "192.0.2.1")
+	h.expect("testDynamicVolume", tests.Passed)
+}
+
+func TestScenariosReuseTheVolume(t *testing.T) {
+	// Each scenario cleans the volume up through the volume driver, and the
+	// next one must be able to create it again.
+	h := newHarness(t, "192.0.2.1", "192.0.2.2")
+	h.expect("testDynamicVolume", tests.Passed)
+	h.expect("testDriverDown", tests.Passed)
+	h.expect("testDynamicVolume", tests.Passed)
+}
+
+func TestDriverDown(t *testing.T) {
+	h := newHarness(t, "192.0.2.1")
+	h.expect("testDriverDown", tests.Passed)
+	if h.clock.slept < 40*time.Second {
+		t.Errorf("expected the scenario to wait for fio, it waited %v", h.clock.slept)
+	}
+}
+
+func TestDriverDownContainerDown(t *testing.T) {
+	h := newHarness(t, "192.0.2.1", "192.0.2.2")
+	h.expect("testDriverDownContainerDown", tests.Passed)
+
+	if h.volume.Exists(volName) {
+		t.Errorf("expected volume %v to be deleted", volName)
+	}
+}
+
+func TestDriverDownContainerDownDeleteFails(t *testing.T) {
+	h := newHarness(t, "192.0.2.1", "192.0.2.2")
+	h.scheduler.FailNext(fakescheduler.OpDeleteVolume, errors.New("volume is attached"))
+	h.expect("testDriverDownContainerDown", tests.Failed)
+}
+
+func TestRemoteForceMount(t *testing.T) {
+	h := newHarness(t, "192.0.2.1", "192.0.2.2")
+	// Stopping Docker kills the container, without unmounting its volume.
+	h.executors[h.nodes[0].ID].onStop = func(unit string) error {
+		return h.scheduler.Kill("testRemoteForceMount", 137)
+	}
+
+	h.expect("testRemoteForceMount", tests.Passed)
+	if e := h.executors[h.nodes[0].ID]; e.started[dockerServiceName] == 0 {
+		t.Errorf("expected Docker to be restarted")
+	}
+}
+
+func TestRemoteForceMountUnreachable(t *testing.T) {
+	h := newHarness(t, "192.0.2.1", "192.0.2.2")
+	h.executors[h.nodes[0].ID].unreachable = errors.New("connection refused")
+	h.expect("testRemoteForceMount", tests.Skipped)
+
+	if state, err := h.scheduler.TaskState("testRemoteForceMount"); err == nil {
+		t.Errorf("expected no task to be created, got one in state %v", state)
+	}
+}
+
+func TestRemoteForceMountDockerStartsSlowly(t *testing.T) {
+	h := newHarness(t, "192.0.2.1", "192.0.2.2")
+	e := h.executors[h.nodes[0].ID]
+	e.onStop = func(unit string) error {
+		e.startFailures = 3
+		return h.scheduler.Kill("testRemoteForceMount", 137)
+	}
+
+	h.expect("testRemoteForceMount", tests.Passed)
+	if e.started[dockerServiceName] != 4+1 {
+		t.Errorf("expected Docker to be started 4 times and once more on cleanup, got %v", e.started[dockerServiceName])
+	}
+	// The scenario sleeps 80 seconds itself, and 1, 2 and 4 seconds
+	// between the attempts to start Docker.
+	if want := 80*time.Second + 7*time.Second; h.clock.slept != want {
+		t.Errorf("expected the scenario to sleep %v, it slept %v", want, h.clock.slept)
+	}
+}
+
+func TestRemoteForceMountNodeLost(t *testing.T) {
+	h := newHarness(t, "192.0.2.1", "192.0.2.2")
+	e := h.executors[h.nodes[0].ID]
+	e.onStop = func(unit string) error {
+		e.startFailures = 100
+		e.unreachable = errors.New("connection refused")
+		return h.scheduler.Kill("testRemoteForceMount", 137)
+	}
+
+	h.expect("testRemoteForceMount", tests.Failed)
+	if e.started[dockerServiceName] != 1+1 {
+		t.Errorf("expected Docker to be started once and once more on cleanup, got %v", e.started[dockerServiceName])
+	}
+}
+
+func TestPluginDown(t *testing.T) {
+	h := newHarness(t, "192.0.2.1")
+	h.expect("testPluginDown", tests.NotImplemented)
+}
+
+func TestDockerDownLiveRestore(t *testing.T) {
+	h := newHarness(t, "192.0.2.1")
+	h.expect("testDockerDownLiveRestore", tests.Passed)
+
+	if !h.daemon.liveRestore {
+		t.Errorf("expected live restore to be enabled")
+	}
+	if h.daemon.restored != 1 {
+		t.Errorf("expected the daemon configuration to be restored once, got %v", h.daemon.restored)
+	}
+}
+
+func TestDockerDownLiveRestoreContainerRestarted(t *testing.T) {
+	h := newHarness(t, "192.0.2.1")
+	h.daemon.restartsContainers = true
+
+	h.expect("testDockerDownLiveRestore", tests.Failed)
+	if h.daemon.restored != 1 {
+		t.Errorf("expected the daemon configuration to be restored once, got %v", h.daemon.restored)
+	}
+	if h.daemon.killed {
+		t.Errorf("expected the daemon to be started again")
+	}
+}
+
+func TestDockerDownLiveRestoreUnreachable(t *testing.T) {
+	h := newHarness(t, "192.0.2.1")
+	h.executors[h.nodes[0].ID].unreachable = errors.New("connection refused")
+	h.expect("testDockerDownLiveRestore", tests.Skipped)
+}
+
+func TestNodePowerOffWithoutPowerDriver(t *testing.T) {
+	h := newHarness(t, "192.0.2.1", "192.0.2.2")
+	h.expect("testNodePowerOff", tests.Skipped)
+}
+
+func TestNodePowerOff(t *testing.T) {
+	h := newHarness(t, "192.0.2.1", "192.0.2.2")
+	power := h.usePower(true)
+	h.expect("testNodePowerOff", tests.Passed)
+
+	x := h.nodes[0].ID
+	if power.poweredOff[x] != 1 || power.off[x] {
+		t.Errorf("expected %v to be powered off once and back on", x)
+	}
+	if h.volume.Exists(volName) {
+		t.Errorf("expected volume %v to be deleted", volName)
+	}
+}
+
+func TestNodePowerOffSparesTheLocalNode(t *testing.T) {
+	h := newHarness(t, "localhost", "198.51.100.2")
+	power := h.usePower(true)
+	h.expect("testNodePowerOff", tests.Passed)
+
+	local, x := h.nodes[0].ID, h.nodes[1].ID
+	if power.poweredOff[local] != 0 {
+		t.Errorf("expected the local node %v not to be powered off", local)
+	}
+	if power.poweredOff[x] != 1 || power.off[x] {
+		t.Errorf("expected %v to be powered off once and back on", x)
+	}
+}
+
+func TestNodePowerOffOnlyLocalNodes(t *testing.T) {
+	h := newHarness(t, "localhost")
+	power := h.usePower(true)
+	h.expect("testNodePowerOff", tests.Skipped)
+
+	if len(power.poweredOff) != 0 {
+		t.Errorf("expected no node to be powered off, got %v", power.poweredOff)
+	}
+}
+
+func TestNodePowerOffWithoutPowerOn(t *testing.T) {
+	h := newHarness(t, "192.0.2.1", "192.0.2.2")
+	power := h.usePower(false)
+	h.expect("testNodePowerOff", tests.Skipped)
+
+	if len(power.poweredOff) != 0 {
+		t.Errorf("expected no node to be powered off, got %v", power.poweredOff)
+	}
+}
+
+func TestNetworkDown(t *testing.T) {
+	h := newHarness(t, "192.0.2.1", "192.0.2.2")
+	fault := h.useNetwork()
+	h.expect("testNetworkDown", tests.Passed)
+
+	x := h.nodes[0].ID
+	if fault.isolated[x] != 1 || len(fault.down) != 0 {
+		t.Errorf("expected %v to be isolated once and healed, got %v and %v down", x, fault.isolated, fault.down)
+	}
+}
+
+func TestNetworkDownSparesTheLocalNode(t *testing.T) {
+	h := newHarness(t, "localhost", "198.51.100.2")
+	fault := h.useNetwork()
+	h.expect("testNetworkDown", tests.Passed)
+
+	x := h.nodes[1].ID
+	if fault.isolated[x] != 1 || len(fault.down) != 0 {
+		t.Errorf("expected %v to be isolated once and healed, got %v and %v down", x, fault.isolated, fault.down)
+	}
+}
+
+func TestNetworkDownOnlyLocalNodes(t *testing.T) {
+	h := newHarness(t, "localhost")
+	fault := h.useNetwork()
+	h.expect("testNetworkDown", tests.Skipped)
+
+	if len(fault.isolated) != 0 {
+		t.Errorf("expected no node to be isolated, got %v", fault.isolated)
+	}
+}
+
+func TestExpectIOError(t *testing.T) {
+	for _, c := range []struct {
+		status int
+		stderr string
+		ok     bool
+	}{
+		{status: 0},
+		{status: 1, stderr: "fio: io_u error: Input/output error"},
+		{status: scheduler.IOErrorStatus, ok: true},
+	} {
+		ctx := &scheduler.Context{Status: c.status, Stderr: c.stderr}
+		if err := expectIOError(ctx); (err == nil) != c.ok {
+			t.Errorf("exit status %v: expected ok %v, got %v", c.status, c.ok, err)
+		}
+	}
+}
+
+func TestReportIOError(t *testing.T) {
+	// fio writes its terse output, whose fifth field is the errno of the
+	// job, and exits with 1 on any error.
+	fio := filepath.Join(t.TempDir(), "fio")
+	script := `#!/bin/sh
+for arg; do
+	case "$arg" in --output=*) out="${arg#--output=}";; esac
+done
+echo "3;fio-3.1;test;0;$1;0" >"$out"
+exit 1
+`
+	if err := os.WriteFile(fio, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for errno, want := range map[string]int{"5": scheduler.IOErrorStatus, "84": 1} {
+		args := reportIOError([]string{fio, errno})
+		err := exec.Command(args[0], args[1:]...).Run()
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok {
+			t.Fatalf("expected the task to fail, got %v", err)
+		}
+		if exitErr.ExitCode() != want {
+			t.Errorf("errno %v: expected exit status %v, got %v", errno, want, exitErr.ExitCode())
+		}
+	}
+}
+
+func TestNetworkPartition(t *testing.T) {
+	h := newHarness(t, "192.0.2.1", "192.0.2.2", "192.0.2.3")
+	fault := h.useNetwork()
+	h.expect("testNetworkPartition", tests.Passed)
+
+	if len(fault.down) != 0 {
+		t.Errorf("expected every node to be healed, got %v down", fault.down)
+	}
+}
+
+func TestNetworkPartitionTooFewNodes(t *testing.T) {
+	h := newHarness(t, "192.0.2.1", "192.0.2.2")
+	h.useNetwork()
+	h.expect("testNetworkPartition", tests.Skipped)
+}
+
+// useNetwork injects network faults with a fake network driver, which
+// stops the volume driver on the nodes it cuts off from the storage.
+func (h *harness) useNetwork() *fakeNetwork {
+	fault := &fakeNetwork{
+		volume:   h.volume,
+		down:     make(map[string]bool),
+		isolated: make(map[string]int),
+	}
+	h.env.Network = fault
+	return fault
+}
+
+// usePower powers nodes off and on with a fake power driver, which stops
+// the volume driver on the nodes it powers off.
+func (h *harness) usePower(canPowerOn bool) *fakePower {
+	power := &fakePower{
+		volume:     h.volume,
+		canPowerOn: canPowerOn,
+		off:        make(map[string]bool),
+		poweredOff: make(map[string]int),
+	}
+	h.env.Power = power
+	return power
+}
+
+// fakeClock advances when slept on.
+type fakeClock struct {
+	now   time.Time
+	slept time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.now = c.now.Add(d)
+	c.slept += d
+}
+
+// fakeExecutor records the services it starts and stops.  Starting a
+// service fails while startFailures is positive.
+type fakeExecutor struct {
+	unreachable   error
+	startFailures int
+	onStop        func(unit string) error
+	started       map[string]int
+	stopped       map[string]int
+}
+
+func (e *fakeExecutor) RunCommand(command string) (string, error) {
+	return "", nil
+}
+
+func (e *fakeExecutor) StartService(unit string) error {
+	if e.started == nil {
+		e.started = make(map[string]int)
+	}
+	e.started[unit]++
+	if e.startFailures > 0 {
+		e.startFailures--
+		return errors.New("job for " + unit + " failed")
+	}
+	return nil
+}
+
+func (e *fakeExecutor) StopService(unit string) error {
+	if e.stopped == nil {
+		e.stopped = make(map[string]int)
+	}
+	e.stopped[unit]++
+	if e.onStop != nil {
+		return e.onStop(unit)
+	}
+	return nil
+}
+
+func (e *fakeExecutor) ServiceStatus(unit string) (string, error) {
+	return "active", nil
+}
+
+func (e *fakeExecutor) CopyFile(src, dst string) error {
+	return nil
+}
+
+func (e *fakeExecutor) IsReachable() error {
+	return e.unreachable
+}
+
+// fakePower stops the volume driver on the nodes it powers off, and starts
+// it on the nodes it powers on.
+type fakePower struct {
+	volume     fakevolume.Driver
+	canPowerOn bool
+	off        map[string]bool
+	poweredOff map[string]int
+}
+
+func (p *fakePower) String() string {
+	return "fake"
+}
+
+func (p *fakePower) Init(cfg *config.Config) error {
+	return nil
+}
+
+func (p *fakePower) PowerOff(n node.Node) error {
+	p.off[n.ID] = true
+	p.poweredOff[n.ID]++
+	return p.volume.StopDriver(n)
+}
+
+func (p *fakePower) PowerOn(n node.Node) error {
+	if !p.canPowerOn {
+		return errors.New("cannot power nodes on")
+	}
+	p.off[n.ID] = false
+	return p.volume.StartDriver(n)
+}
+
+func (p *fakePower) CanPowerOn() bool {
+	return p.canPowerOn
+}
+
+func (p *fakePower) Reboot(n node.Node) error {
+	return nil
+}
+
+func (p *fakePower) IsUp(n node.Node) (bool, error) {
+	return !p.off[n.ID], nil
+}
+
+// fakeNetwork stops the volume driver on the nodes it isolates or puts in
+// the minority of a partition, and starts it on the nodes it heals.
+type fakeNetwork struct {
+	volume   fakevolume.Driver
+	down     map[string]bool
+	isolated map[string]int
+}
+
+func (f *fakeNetwork) Isolate(n node.Node) error {
+	if n.Local {
+		return fmt.Errorf("cannot isolate %v, the node Torpedo runs on", n.MgmtIP)
+	}
+	f.isolated[n.ID]++
+	return f.cut(n)
+}
+
+func (f *fakeNetwork) Partition(a, b []node.Node, ports []string) error {
+	for _, n := range a {
+		if err := f.cut(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fakeNetwork) Heal(n node.Node) error {
+	if !f.down[n.ID] {
+		return nil
+	}
+	delete(f.down, n.ID)
+	return f.volume.StartDriver(n)
+}
+
+func (f *fakeNetwork) cut(n node.Node) error {
+	f.down[n.ID] = true
+	return f.volume.StopDriver(n)
+}
+
+// fakeDaemon models a Docker daemon with a single workload container.
+type fakeDaemon struct {
+	liveRestore        bool
+	restored           int
+	killed             bool
+	restartsContainers bool
+	startedAt          time.Time
+}
+
+func (d *fakeDaemon) SetLiveRestore(n node.Node, enabled bool) error {
+	d.liveRestore = enabled
+	return nil
+}
+
+func (d *fakeDaemon) RestoreConfig(n node.Node) error {
+	d.restored++
+	return nil
+}
+
+func (d *fakeDaemon) Kill(n node.Node) error {
+	d.killed = true
+	return nil
+}
+
+func (d *fakeDaemon) Start(n node.Node) error {
+	if d.killed && (d.restartsContainers || !d.liveRestore) {
+		d.startedAt = d.startedAt.Add(time.Minute)
+	}
+	d.killed = false
+	return nil
+}
+
+func (d *fakeDaemon) VolumeContainer(
+	n node.Node,
+	volumeDriver string,
+	path string,
+) (*dockerclient.Container, error) {
+	return &dockerclient.Container{
+		ID:    "workload",
+		State: dockerclient.State{Running: true, StartedAt: d.startedAt},
+	}, nil
+}
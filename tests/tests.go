@@ -0,0 +1,208 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/portworx/torpedo/drivers/scheduler"
+	"github.com/portworx/torpedo/drivers/volume"
+)
+
+// Category classifies a test as described in the Torpedo test table.
+type Category int
+
+const (
+	// Acceptance tests must pass for a storage provider to qualify.
+	Acceptance Category = iota
+	// Runtime tests verify behavior during normal runtime operations.
+	Runtime
+)
+
+// Status is the outcome of a test.
+type Status int
+
+const (
+	// Passed indicates that the test ran and succeeded.
+	Passed Status = iota
+	// Failed indicates that the test ran and failed.
+	Failed
+	// Skipped indicates that the test could not be run in this environment.
+	Skipped
+	// NotImplemented indicates that the test does not exercise anything yet.
+	NotImplemented
+)
+
+// TestDriverFunc runs a specific external storage test case.  It takes
+// in a scheduler driver and an external volume provider as arguments.
+type TestDriverFunc func(scheduler.Driver, volume.Driver) error
+
+// TestSpec describes a test case and how to run it.
+type TestSpec struct {
+	// Name uniquely identifies the test.
+	Name string
+	// Description is a human readable description of the scenario.
+	Description string
+	// Category is either an Acceptance or a Runtime test.
+	Category Category
+	// MinNodes is the number of nodes the test requires in the cluster.
+	MinNodes int
+	// ExpectedResult describes the expected outcome of the scenario.
+	ExpectedResult string
+	// Func runs the test.
+	Func TestDriverFunc
+}
+
+// Result is the outcome of running a single test.
+type Result struct {
+	// Name of the test.
+	Name string
+	// Status of the test.
+	Status Status
+	// Reason explains why a test was skipped.
+	Reason string
+	// Err is the error a failed test returned.
+	Err error
+	// Duration is how long the test took to run.
+	Duration time.Duration
+	// Stdout is the output of the test workloads.
+	Stdout string
+	// Stderr is the error output of the test workloads.
+	Stderr string
+}
+
+// SkipError is returned by a test that cannot run in this environment.
+type SkipError struct {
+	Reason string
+}
+
+var (
+	// ErrNotImplemented is returned by a test that does not test anything yet.
+	ErrNotImplemented = errors.New("test is not implemented")
+
+	specs []TestSpec
+)
+
+// String returns the name of the category.
+func (c Category) String() string {
+	switch c {
+	case Acceptance:
+		return "Acceptance"
+	case Runtime:
+		return "Runtime"
+	}
+	return fmt.Sprintf("Category(%d)", int(c))
+}
+
+// String returns the name of the status.
+func (s Status) String() string {
+	switch s {
+	case Passed:
+		return "Passed"
+	case Failed:
+		return "Failed"
+	case Skipped:
+		return "Skipped"
+	case NotImplemented:
+		return "Not Implemented"
+	}
+	return fmt.Sprintf("Status(%d)", int(s))
+}
+
+// Error returns the reason the test was skipped.
+func (e *SkipError) Error() string {
+	return "test skipped: " + e.Reason
+}
+
+// Skip returns an error that marks a test as skipped for the given reason.
+func Skip(format string, args ...interface{}) error {
+	return &SkipError{Reason: fmt.Sprintf(format, args...)}
+}
+
+// Register adds a test to the registry.  Tests are run in the order in which
+// they are registered.
+func Register(spec TestSpec) error {
+	if spec.Name == "" {
+		return errors.New("test name must be specified")
+	}
+	if spec.Func == nil {
+		return fmt.Errorf("test %v does not have a test function", spec.Name)
+	}
+	if _, err := Get(spec.Name); err == nil {
+		return fmt.Errorf("test %v is already registered", spec.Name)
+	}
+	specs = append(specs, spec)
+	return nil
+}
+
+// Get returns a registered test by name.
+func Get(name string) (TestSpec, error) {
+	for _, spec := range specs {
+		if spec.Name == name {
+			return spec, nil
+		}
+	}
+	return TestSpec{}, fmt.Errorf("unknown test function %v", name)
+}
+
+// List returns all registered tests in registration order.
+func List() []TestSpec {
+	list := make([]TestSpec, len(specs))
+	copy(list, specs)
+	return list
+}
+
+// Run executes a test and classifies its outcome.  A test is skipped if the
+// cluster does not have enough nodes to run it.
+func Run(spec TestSpec, s scheduler.Driver, v volume.Driver) Result {
+	recorder := newRecorder(s)
+	start := time.Now()
+	result := run(spec, recorder, v)
+	result.Duration = time.Since(start)
+	result.Stdout, result.Stderr = recorder.output()
+	return result
+}
+
+func run(spec TestSpec, s scheduler.Driver, v volume.Driver) Result {
+	result := Result{Name: spec.Name}
+
+	nodes, err := s.GetNodes()
+	if err != nil {
+		result.Status = Failed
+		result.Err = err
+		return result
+	}
+	if len(nodes) < spec.MinNodes {
+		result.Status = Skipped
+		result.Reason = fmt.Sprintf(
+			"test requires %v nodes, cluster has %v",
+			spec.MinNodes,
+			len(nodes),
+		)
+		return result
+	}
+
+	return NewResult(spec.Name, spec.Func(s, v))
+}
+
+// NewResult classifies the error a test returned into a result.  A nil
+// error passes the test, a SkipError skips it, ErrNotImplemented marks it as
+// not implemented and any other error fails it.
+func NewResult(name string, err error) Result {
+	result := Result{Name: name}
+	switch e := err.(type) {
+	case nil:
+		result.Status = Passed
+	case *SkipError:
+		result.Status = Skipped
+		result.Reason = e.Reason
+	default:
+		if err == ErrNotImplemented {
+			result.Status = NotImplemented
+		} else {
+			result.Status = Failed
+			result.Err = err
+		}
+	}
+	return result
+}